@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/stumble/needle"
+	"github.com/stumble/needle/pkg/config"
+)
+
+// batchFailure is a config that failed to compile in batch mode.
+type batchFailure struct {
+	Path string
+	Err  error
+}
+
+// outputNames overrides names of the generated code of all configs.
+var outputNames config.Output
+
+// outputFlags registers flags of output names to @p flags.
+func outputFlags(flags *flag.FlagSet) {
+	flags.StringVar(&outputNames.Package, "pkg", "", "package name of the generated code")
+	flags.StringVar(&outputNames.Interface, "interface", "", "name of the generated interface")
+	flags.StringVar(&outputNames.Constructor, "constructor", "", "name of the generated constructor")
+	flags.StringVar(&outputNames.ImplStruct, "impl", "", "name of the generated implementation struct")
+	flags.StringVar(&outputNames.Nullable, "nullable", "",
+		"representation of nullable values: pointer, sql or generic")
+}
+
+// compileFile runs the whole pipeline on the config at @p path, returns the generated
+// code and the package name of it. Warnings are printed to stderr, as stdout may be
+// the code.
+func compileFile(path string) (code string, pkgName string, err error) {
+	rst, err := needle.Compile(context.Background(), needle.Options{Path: path, Output: outputNames})
+	if err != nil {
+		return "", "", err
+	}
+	for _, d := range rst.Diagnostics {
+		fmt.Fprintln(os.Stderr, d)
+	}
+	return rst.Code, rst.PkgName, nil
+}
+
+// runBatch compiles all needle configs under @p dir into @p outDir, and prints failures.
+// Returns the exit code.
+func runBatch(dir string, outDir string) int {
+	failures := compileDir(dir, outDir)
+	if len(failures) > 0 {
+		for _, f := range failures {
+			printError(f.Path, f.Err)
+		}
+		fmt.Fprintf(os.Stderr, "needle: %d config(s) failed to compile\n", len(failures))
+		return 1
+	}
+	return 0
+}
+
+// compileDir compiles all needle configs under @p dir, each output is written into
+// @p outDir/<name>repo/<config basename>.go. All failures are returned.
+func compileDir(dir string, outDir string) (failures []batchFailure) {
+	paths, err := findConfigs(dir)
+	if err != nil {
+		return []batchFailure{{Path: dir, Err: err}}
+	}
+
+	written := make(map[string]string)
+	for _, path := range paths {
+		code, pkgName, err := compileFile(path)
+		if err != nil {
+			failures = append(failures, batchFailure{Path: path, Err: err})
+			continue
+		}
+		if prev, ok := written[pkgName]; ok {
+			failures = append(failures, batchFailure{Path: path,
+				Err: fmt.Errorf("package %s is already generated by %s", pkgName, prev)})
+			continue
+		}
+		written[pkgName] = path
+
+		pkgDir := filepath.Join(outDir, pkgName)
+		err = os.MkdirAll(pkgDir, 0750)
+		if err != nil {
+			failures = append(failures, batchFailure{Path: path, Err: err})
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".go"
+		err = ioutil.WriteFile(filepath.Join(pkgDir, name), []byte(code), 0600)
+		if err != nil {
+			failures = append(failures, batchFailure{Path: path, Err: err})
+		}
+	}
+	return failures
+}
+
+// findConfigs returns all XML files under @p dir whose root element is <needle>, all
+// YAML files that have a schema, and all annotated SQL files. XML and YAML files that
+// are not well-formed are returned as well, compiling them reports the syntax errors.
+func findConfigs(dir string) ([]string, error) {
+	var rst []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if d.IsDir() || (ext != ".xml" && ext != ".yaml" && ext != ".yml" && ext != ".sql") {
+			return nil
+		}
+		isConfig, err := isNeedleConfig(path)
+		if err != nil {
+			return err
+		}
+		if isConfig {
+			rst = append(rst, path)
+		}
+		return nil
+	})
+	sort.Strings(rst)
+	return rst, err
+}
+
+func isNeedleConfig(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".sql":
+		src, err := ioutil.ReadAll(file)
+		if err != nil {
+			return false, err
+		}
+		return config.IsAnnotatedSQL(src), nil
+	case ".yaml", ".yml":
+		var doc yaml.Node
+		err := yaml.NewDecoder(file).Decode(&doc)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			// compiled, so that the syntax error is reported.
+			return true, nil
+		}
+		// documents of other shapes, e.g. lists, are not configs.
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			return false, nil
+		}
+		root := doc.Content[0]
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == "schema" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	decoder := xml.NewDecoder(file)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			// compiled, so that the syntax error is reported.
+			return true, nil
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local == "needle", nil
+		}
+	}
+}
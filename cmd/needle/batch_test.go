@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const validXML = `<needle>
+  <schema name="Users" mainObj="User">
+    <sql>CREATE TABLE Users (ID BIGINT NOT NULL, Name VARCHAR(64), PRIMARY KEY (ID));</sql>
+  </schema>
+  <stmts>
+    <query name="GetUser" type="single">
+      <sql>SELECT * FROM Users WHERE ID = ?;</sql>
+    </query>
+  </stmts>
+</needle>`
+
+const invalidXML = `<needle>
+  <schema name="Orders" mainObj="Order">
+    <sql>CREATE TABLE Orders (ID BIGINT NOT NULL, PRIMARY KEY (ID));</sql>
+  </schema>
+  <stmts>
+    <query name="GetOrder" type="single">
+      <sql>SELECT * FROM Orders WHERE Missing = ?;</sql>
+    </query>
+  </stmts>
+</needle>`
+
+type batchTestSuite struct {
+	suite.Suite
+	dir string
+	out string
+}
+
+func (suite *batchTestSuite) SetupTest() {
+	suite.dir = suite.T().TempDir()
+	suite.out = suite.T().TempDir()
+	for name, src := range map[string]string{
+		"users.xml":         validXML,
+		"nested/orders.xml": invalidXML,
+		// broken before the root element, reported rather than skipped.
+		"broken/users.xml":  "<needle\n  <schema>",
+		"broken/songs.yaml": "schema:\n  name: Songs\n   mainObj: [Song\n",
+		// YAML of other shapes, skipped.
+		"compose.yaml": "services:\n  db:\n    image: mysql\n",
+		"list.yml":     "- a\n- b\n",
+		// not a needle config, skipped.
+		"pom.xml": `<project></project>`,
+	} {
+		path := filepath.Join(suite.dir, name)
+		suite.Require().NoError(os.MkdirAll(filepath.Dir(path), 0750))
+		suite.Require().NoError(os.WriteFile(path, []byte(src), 0600))
+	}
+}
+
+func (suite *batchTestSuite) TestCompileDir() {
+	failures := compileDir(suite.dir, suite.out)
+	suite.Require().Len(failures, 3)
+	suite.Equal(filepath.Join(suite.dir, "broken", "songs.yaml"), failures[0].Path)
+	suite.Equal(filepath.Join(suite.dir, "broken", "users.xml"), failures[1].Path)
+	suite.Contains(failures[1].Err.Error(), "XML syntax error")
+	suite.Equal(filepath.Join(suite.dir, "nested", "orders.xml"), failures[2].Path)
+
+	code, err := os.ReadFile(filepath.Join(suite.out, "usersrepo", "users.go"))
+	suite.Require().NoError(err)
+	suite.Contains(string(code), "package usersrepo")
+	_, err = os.Stat(filepath.Join(suite.out, "ordersrepo"))
+	suite.True(os.IsNotExist(err))
+}
+
+func (suite *batchTestSuite) TestExitCode() {
+	suite.Equal(1, runBatch(suite.dir, suite.out))
+	_, err := os.Stat(filepath.Join(suite.out, "usersrepo", "users.go"))
+	suite.NoError(err)
+
+	suite.Require().NoError(os.Remove(filepath.Join(suite.dir, "nested", "orders.xml")))
+	suite.Equal(1, runBatch(suite.dir, suite.T().TempDir()))
+	suite.Require().NoError(os.RemoveAll(filepath.Join(suite.dir, "broken")))
+	suite.Equal(0, runBatch(suite.dir, suite.T().TempDir()))
+}
+
+func TestBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(batchTestSuite))
+}
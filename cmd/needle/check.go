@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stumble/needle"
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+// runCheck implements `needle check`, it validates configs without generating any
+// code. Returns the exit code.
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	dirPath := flags.String("dir", "", "check all needle configs under this directory")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: needle check [-dir configs/] [file.xml...]\n")
+		flags.PrintDefaults()
+	}
+	diagnosticsFlag(flags)
+	_ = flags.Parse(args)
+
+	paths := flags.Args()
+	if *dirPath != "" {
+		found, err := findConfigs(*dirPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *dirPath, err)
+			return 1
+		}
+		paths = append(paths, found...)
+	}
+	if len(paths) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	nFailed := 0
+	for _, path := range paths {
+		err := checkFile(path)
+		if err != nil {
+			printError(path, err)
+			nFailed++
+		}
+	}
+	if nFailed > 0 {
+		fmt.Fprintf(os.Stderr, "needle: %d of %d config(s) failed the check\n", nFailed, len(paths))
+		return 1
+	}
+	return 0
+}
+
+// checkFile compiles the config at @p path without writing the code, returns all
+// diagnostics found as error.
+func checkFile(path string) error {
+	rst, err := needle.Compile(context.Background(), needle.Options{Path: path})
+	if err == nil || rst == nil || rst.Repo == nil {
+		return err
+	}
+
+	var failed []string
+	for _, q := range rst.Repo.Queries {
+		if q.Poisoned() {
+			failed = append(failed, q.Config.Name)
+		}
+	}
+	for _, m := range rst.Repo.Mutations {
+		if m.Poisoned() {
+			failed = append(failed, m.Config.Name)
+		}
+	}
+	diags := rst.Diagnostics
+	if len(failed) > 0 {
+		diags.Errorf(diagnostic.CategoryConfig, diagnostic.Position{File: path}, "",
+			"%d statement(s) failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return diags
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitFS is the file system of a git revision. Names are OS paths like those of
+// config.OSFS, they are looked up relative to dir, a directory of the working tree.
+type gitFS struct {
+	rev string
+	dir string
+}
+
+var (
+	_ fs.ReadFileFS = gitFS{}
+	_ fs.StatFS     = gitFS{}
+	_ fs.ReadDirFS  = gitFS{}
+)
+
+// newGitFS returns the file system of git revision @p rev of the repo of @p dir.
+func newGitFS(rev string, dir string) (gitFS, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return gitFS{}, err
+	}
+	return gitFS{rev: rev, dir: abs}, nil
+}
+
+// object returns the git object name of @p name, e.g. HEAD:./schema/users.sql.
+func (g gitFS) object(name string) (string, error) {
+	abs, err := filepath.Abs(filepath.FromSlash(name))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(g.dir, abs)
+	if err != nil {
+		return "", err
+	}
+	return g.rev + ":./" + filepath.ToSlash(rel), nil
+}
+
+// git runs git in dir with @p args, and returns its output.
+func (g gitFS) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", g.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// Stat implements fs.StatFS.
+func (g gitFS) Stat(name string) (fs.FileInfo, error) {
+	obj, err := g.object(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	kind, err := g.git("cat-file", "-t", obj)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	info := gitFileInfo{name: filepath.Base(filepath.FromSlash(name))}
+	switch strings.TrimSpace(string(kind)) {
+	case "tree":
+		info.mode = fs.ModeDir | 0755
+	case "blob":
+		size, err := g.git("cat-file", "-s", obj)
+		if err != nil {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+		}
+		info.mode = 0644
+		info.size, _ = strconv.ParseInt(strings.TrimSpace(string(size)), 10, 64)
+	default:
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	return info, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (g gitFS) ReadFile(name string) ([]byte, error) {
+	obj, err := g.object(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	src, err := g.git("cat-file", "blob", obj)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return src, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (g gitFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	obj, err := g.object(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	out, err := g.git("ls-tree", obj)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	var entries []fs.DirEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		// <mode> SP <type> SP <object> TAB <file>, entries are sorted by name.
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		info := gitFileInfo{name: fields[1], mode: 0644}
+		if strings.Contains(fields[0], " tree ") {
+			info.mode = fs.ModeDir | 0755
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+// Open implements fs.FS.
+func (g gitFS) Open(name string) (fs.File, error) {
+	info, err := g.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	file := &gitFile{info: info}
+	if info.IsDir() {
+		file.entries, err = g.ReadDir(name)
+	} else {
+		var src []byte
+		src, err = g.ReadFile(name)
+		file.Reader = bytes.NewReader(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+type gitFileInfo struct {
+	name string
+	size int64
+	mode fs.FileMode
+}
+
+func (i gitFileInfo) Name() string       { return i.name }
+func (i gitFileInfo) Size() int64        { return i.size }
+func (i gitFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i gitFileInfo) ModTime() time.Time { return time.Time{} }
+func (i gitFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i gitFileInfo) Sys() interface{}   { return nil }
+
+// gitFile is a file or a directory read from git.
+type gitFile struct {
+	*bytes.Reader
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (f *gitFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *gitFile) Read(p []byte) (int, error) {
+	if f.Reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.Name(), Err: fs.ErrInvalid}
+	}
+	return f.Reader.Read(p)
+}
+
+func (f *gitFile) Close() error { return nil }
+
+// ReadDir implements fs.ReadDirFile.
+func (f *gitFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.entries) {
+		n = len(f.entries)
+	}
+	entries := f.entries[:n]
+	f.entries = f.entries[n:]
+	return entries, nil
+}
@@ -1,24 +1,55 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/stumble/needle/pkg/config"
-	"github.com/stumble/needle/pkg/driver"
-	"github.com/stumble/needle/pkg/passes"
+	"github.com/stumble/needle/pkg/lsp"
 	"github.com/stumble/needle/pkg/vcs"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			zerolog.SetGlobalLevel(zerolog.WarnLevel)
+			os.Exit(runCheck(os.Args[2:]))
+		case "verify":
+			zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+			os.Exit(runVerify(os.Args[2:]))
+		case "migrate":
+			zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+			os.Exit(runMigrate(os.Args[2:]))
+		case "lsp":
+			zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+			err := lsp.NewServer(os.Stdin, os.Stdout).Run(context.Background())
+			if err != nil {
+				fatalf("%s", err)
+			}
+			return
+		}
+	}
+
 	genTemplate := flag.String("t", "", "generate a needle template")
 	filePath := flag.String("f", "", "Input file path")
 	outputPath := flag.String("o", "", "output file path")
+	dirPath := flag.String("dir", "", "compile all needle configs under this directory")
+	outDir := flag.String("out", "", "output directory of -dir, one <name>repo package per config")
+	watchMode := flag.Bool("watch", false, "recompile -f into -o whenever the config or its references change")
+	interval := flag.Duration("interval", 500*time.Millisecond, "polling interval of -watch")
 	debug := flag.Bool("debug", false, "sets log level to debug")
+	diagnosticsFlag(flag.CommandLine)
+	outputFlags(flag.CommandLine)
 	flag.Parse()
 
 	log.Info().Msgf("needle version: %s", vcs.Commit)
@@ -31,52 +62,55 @@ func main() {
 
 	if *genTemplate != "" {
 		if *outputPath == "" {
-			panic("-o template filepath not provided ")
+			fatalf("-o template filepath not provided")
 		}
 		tmpl, err := config.GenTemplate(*genTemplate)
 		if err != nil {
-			panic(err)
+			fatalf("%s", err)
 		}
 		err = ioutil.WriteFile(*outputPath, []byte(tmpl), 0600)
 		if err != nil {
-			panic(err)
+			fatalf("%s", err)
 		}
 		return
 	}
 
-	if *filePath == "" {
-		panic("filepath not provided")
-	}
-
-	config, err := config.ParseConfigFromFile(*filePath)
-	if err != nil {
-		panic(err)
+	if *dirPath != "" {
+		if *outDir == "" {
+			fatalf("-out output directory not provided")
+		}
+		if code := runBatch(*dirPath, *outDir); code != 0 {
+			os.Exit(code)
+		}
+		return
 	}
 
-	repo, err := driver.NewRepoFromConfig(config)
-	if err != nil {
-		panic(err)
+	if *filePath == "" {
+		fatalf("filepath not provided")
 	}
 
-	midend := &passes.NormalizePass{}
-	err = midend.Run(repo)
-	if err != nil {
-		panic(err)
+	if *watchMode {
+		if *outputPath == "" {
+			fatalf("-o output file path not provided")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		watch(ctx, *filePath, *outputPath, *interval)
+		return
 	}
 
-	backend := &passes.CodegenPass{}
-	err = backend.Run(repo)
+	code, _, err := compileFile(*filePath)
 	if err != nil {
-		panic(err)
+		printError(*filePath, err)
+		os.Exit(1)
 	}
 
-	code := backend.Code
 	if *outputPath == "" {
 		fmt.Println(code)
 	} else {
 		err := ioutil.WriteFile(*outputPath, []byte(code), 0600)
 		if err != nil {
-			panic(err)
+			fatalf("%s", err)
 		}
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stumble/needle/pkg/config"
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/driver"
+	"github.com/stumble/needle/pkg/migration"
+	"github.com/stumble/needle/pkg/schema"
+)
+
+// runMigrate implements `needle migrate`, it compares main tables of two versions of a
+// config, and prints the DDL that migrates the old tables to the new ones. Destructive
+// changes are reported as warnings. Returns the exit code.
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	oldPath := flags.String("old", "", "config of the old schema")
+	newPath := flags.String("new", "", "config of the new schema")
+	rev := flags.String("rev", "", "git revision of -new to read the old schema from, e.g. HEAD")
+	outputPath := flags.String("o", "", "output file path of the migration, stdout if not set")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(),
+			"usage: needle migrate -old v1.xml -new v2.xml | -rev HEAD -new v2.xml [-o migration.sql]\n")
+		flags.PrintDefaults()
+	}
+	diagnosticsFlag(flags)
+	_ = flags.Parse(args)
+
+	if *newPath == "" || (*oldPath == "") == (*rev == "") {
+		flags.Usage()
+		return 2
+	}
+
+	oldName := *oldPath
+	var oldSrc []byte
+	var oldFS fs.FS
+	var err error
+	if *rev != "" {
+		// -new and the schemas it references are all read at the revision.
+		oldName = *newPath
+		oldFS, err = newGitFS(*rev, filepath.Dir(*newPath))
+		if err == nil {
+			oldSrc, err = fs.ReadFile(oldFS, filepath.ToSlash(*newPath))
+		}
+	} else {
+		oldSrc, err = ioutil.ReadFile(*oldPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", oldName, err)
+		return 1
+	}
+	oldTables, _, err := mainTables(oldSrc, oldName, oldFS)
+	if err != nil {
+		printError(oldName, err)
+		return 1
+	}
+	newSrc, err := ioutil.ReadFile(*newPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", *newPath, err)
+		return 1
+	}
+	newTables, mains, err := mainTables(newSrc, *newPath, nil)
+	if err != nil {
+		printError(*newPath, err)
+		return 1
+	}
+
+	stmts, err := migration.Diff(oldTables, newTables)
+	if err != nil {
+		printError(*newPath, err)
+		return 1
+	}
+	if len(stmts) == 0 {
+		fmt.Fprintf(os.Stderr, "needle: no schema change\n")
+		return 0
+	}
+
+	tablePos := make(map[string]diagnostic.Position)
+	for _, main := range mains {
+		tablePos[strings.ToLower(main.Table.Name())] = main.Config.SQLPos
+	}
+	var warnings diagnostic.List
+	var out bytes.Buffer
+	for _, stmt := range stmts {
+		if stmt.Warning != "" {
+			fmt.Fprintf(&out, "-- WARNING: %s\n", stmt.Warning)
+			pos, ok := tablePos[strings.ToLower(stmt.Table)]
+			if !ok {
+				pos = diagnostic.Position{File: *newPath}
+			}
+			warnings.Warnf(diagnostic.CategoryMigration, pos, "", "%s", stmt.Warning)
+		}
+		fmt.Fprintf(&out, "%s;\n", stmt.SQL)
+	}
+	if len(warnings) > 0 {
+		printError(*newPath, warnings)
+	}
+
+	if *outputPath == "" {
+		fmt.Print(out.String())
+		return 0
+	}
+	if err := ioutil.WriteFile(*outputPath, out.Bytes(), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", *outputPath, err)
+		return 1
+	}
+	return 0
+}
+
+// mainTables returns main tables of the config @p src at @p path, referenced schemas
+// are read from @p fsys, or from the OS file system if it is nil.
+func mainTables(src []byte, path string, fsys fs.FS) ([]schema.SQLTable, []driver.MainTable, error) {
+	cfg, err := config.ParseConfig(src, path, fsys)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, err := driver.NewRepoFromConfig(cfg)
+	if repo == nil {
+		return nil, nil, err
+	}
+	// statements are not needed to diff tables, so their errors are ignored.
+	tables := make([]schema.SQLTable, 0, len(repo.Mains))
+	for _, main := range repo.Mains {
+		tables = append(tables, main.Table)
+	}
+	return tables, repo.Mains, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const usersSrcXML = `<needle>
+  <schema src="schema/users.sql" mainObj="User"/>
+  <stmts>
+    <query name="GetUser" type="single">
+      <sql>SELECT * FROM Users WHERE ID = ?;</sql>
+    </query>
+  </stmts>
+</needle>`
+
+type migrateTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (suite *migrateTestSuite) git(args ...string) {
+	cmd := exec.Command("git", append([]string{"-C", suite.dir}, args...)...)
+	out, err := cmd.CombinedOutput()
+	suite.Require().NoError(err, string(out))
+}
+
+func (suite *migrateTestSuite) write(name string, src string) {
+	path := filepath.Join(suite.dir, name)
+	suite.Require().NoError(os.MkdirAll(filepath.Dir(path), 0750))
+	suite.Require().NoError(os.WriteFile(path, []byte(src), 0600))
+}
+
+func (suite *migrateTestSuite) SetupTest() {
+	if _, err := exec.LookPath("git"); err != nil {
+		suite.T().Skip("git not found")
+	}
+	suite.dir = suite.T().TempDir()
+	suite.write("users.xml", usersSrcXML)
+	suite.write("schema/users.sql",
+		"CREATE TABLE Users (ID BIGINT NOT NULL, Name VARCHAR(64), PRIMARY KEY (ID));")
+	suite.git("init", "-q")
+	suite.git("add", "-A")
+	suite.git("-c", "user.name=test", "-c", "user.email=test@example.com",
+		"commit", "-q", "-m", "users")
+}
+
+func (suite *migrateTestSuite) TestRevRefs() {
+	// only the referenced schema changes, the config itself does not.
+	suite.write("schema/users.sql",
+		"CREATE TABLE Users (ID BIGINT NOT NULL, Name VARCHAR(64), Age INT, PRIMARY KEY (ID));")
+	out := filepath.Join(suite.T().TempDir(), "migration.sql")
+	suite.Require().Equal(0, runMigrate([]string{
+		"-rev", "HEAD", "-new", filepath.Join(suite.dir, "users.xml"), "-o", out}))
+	sql, err := os.ReadFile(out)
+	suite.Require().NoError(err)
+	suite.Contains(string(sql), "ADD COLUMN")
+	suite.Contains(string(sql), "Age")
+}
+
+func (suite *migrateTestSuite) TestRevMissing() {
+	suite.Equal(1, runMigrate([]string{
+		"-rev", "HEAD", "-new", filepath.Join(suite.dir, "missing.xml")}))
+}
+
+func TestMigrateTestSuite(t *testing.T) {
+	suite.Run(t, new(migrateTestSuite))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+const (
+	diagnosticsText = "text"
+	diagnosticsJSON = "json"
+)
+
+// diagnosticsFormat is how errors are printed, text to stderr, or JSON lines to stdout.
+var diagnosticsFormat = diagnosticsText
+
+// diagnosticsFlag registers the -diagnostics flag to @p flags.
+func diagnosticsFlag(flags *flag.FlagSet) {
+	flags.Func("diagnostics", "diagnostics output format: text or json (default text)",
+		func(v string) error {
+			if v != diagnosticsText && v != diagnosticsJSON {
+				return fmt.Errorf("unknown format %s", v)
+			}
+			diagnosticsFormat = v
+			return nil
+		})
+}
+
+// printError prints @p err of the config at @p path, one line per diagnostic.
+func printError(path string, err error) {
+	var diags diagnostic.List
+	if !errors.As(err, &diags) {
+		diags = diagnostic.FromError(err, diagnostic.Position{File: path}, "")
+	}
+	for _, d := range diags {
+		if d.Pos.File == "" {
+			d.Pos.File = path
+		}
+		if diagnosticsFormat == diagnosticsJSON {
+			line, err := json.Marshal(d)
+			if err != nil {
+				fatalf("%s", err)
+			}
+			fmt.Println(string(line))
+		} else {
+			fmt.Fprintln(os.Stderr, d)
+		}
+	}
+}
+
+// fatalf prints the message and exits with code 1.
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "needle: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stumble/needle/pkg/codegen"
+)
+
+// errStale the checked-in generated code does not match its inputs.
+var errStale = errors.New("generated code is stale")
+
+// runVerify implements `needle verify`, it regenerates code in memory and compares it
+// with the checked-in output. Returns the exit code.
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	filePath := flags.String("f", "", "Input file path")
+	outputPath := flags.String("o", "", "checked-in output file path")
+	dirPath := flags.String("dir", "", "verify all needle configs under this directory")
+	outDir := flags.String("out", "", "checked-in output directory of -dir")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(),
+			"usage: needle verify -f file.xml -o file.go | -dir configs/ -out gen/\n")
+		flags.PrintDefaults()
+	}
+	diagnosticsFlag(flags)
+	outputFlags(flags)
+	_ = flags.Parse(args)
+
+	var failures []batchFailure
+	switch {
+	case *filePath != "" && *outputPath != "":
+		if err := verifyFile(*filePath, *outputPath); err != nil {
+			failures = append(failures, batchFailure{Path: *filePath, Err: err})
+		}
+	case *dirPath != "" && *outDir != "":
+		failures = verifyDir(*dirPath, *outDir)
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	if len(failures) > 0 {
+		for _, f := range failures {
+			printError(f.Path, f.Err)
+		}
+		fmt.Fprintf(os.Stderr, "needle: %d config(s) failed to verify, please regenerate\n",
+			len(failures))
+		return 1
+	}
+	return 0
+}
+
+// verifyFile returns nil if the code in @p outputPath is what @p path generates.
+func verifyFile(path string, outputPath string) error {
+	code, _, err := compileFile(path)
+	if err != nil {
+		return err
+	}
+	return compareGenerated(code, outputPath)
+}
+
+// verifyDir verifies the output of compileDir.
+func verifyDir(dir string, outDir string) (failures []batchFailure) {
+	paths, err := findConfigs(dir)
+	if err != nil {
+		return []batchFailure{{Path: dir, Err: err}}
+	}
+	for _, path := range paths {
+		code, pkgName, err := compileFile(path)
+		if err != nil {
+			failures = append(failures, batchFailure{Path: path, Err: err})
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".go"
+		err = compareGenerated(code, filepath.Join(outDir, pkgName, name))
+		if err != nil {
+			failures = append(failures, batchFailure{Path: path, Err: err})
+		}
+	}
+	return failures
+}
+
+func compareGenerated(code string, outputPath string) error {
+	existing, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errStale, err)
+	}
+	if bytes.Equal(existing, []byte(code)) {
+		return nil
+	}
+	expected := codegen.ParseInputHash([]byte(code))
+	actual := codegen.ParseInputHash(existing)
+	if expected != actual {
+		return fmt.Errorf("%w: %s was generated from different inputs (%s, expected %s)",
+			errStale, outputPath, actual, expected)
+	}
+	return fmt.Errorf("%w: %s differs from the generated code, was it edited by hand?",
+		errStale, outputPath)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stumble/needle"
+)
+
+// fileStamp is what we know about a watched file, zero if it does not exist.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func stampOf(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// watch polls the config at @p path and all of its dependencies every @p interval,
+// recompiles it on any change and rewrites @p outputPath. Diagnostics are printed
+// and the output is kept as is when the compilation fails. Returns when @p ctx is done.
+func watch(ctx context.Context, path string, outputPath string, interval time.Duration) {
+	stamps := map[string]fileStamp{path: {}}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		changed := false
+		for dep, stamp := range stamps {
+			if curr := stampOf(dep); curr != stamp {
+				stamps[dep] = curr
+				changed = true
+			}
+		}
+		if changed {
+			deps := watchCompile(ctx, path, outputPath)
+			// XXX(yumin): keep watching dependencies of previous runs, a broken config
+			// may not tell all of them, e.g. refs of a <ref src> that is being written.
+			for _, dep := range deps {
+				if _, ok := stamps[dep]; !ok {
+					stamps[dep] = stampOf(dep)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchCompile compiles the config at @p path once, returns the files it depends on.
+func watchCompile(ctx context.Context, path string, outputPath string) (deps []string) {
+	rst, err := needle.Compile(ctx, needle.Options{Path: path, Output: outputNames})
+	if rst != nil {
+		for _, dep := range rst.Deps {
+			deps = append(deps, filepath.FromSlash(dep))
+		}
+	}
+	if err != nil {
+		printError(path, err)
+		fmt.Fprintf(os.Stderr, "needle: %s failed to compile, waiting for changes\n", path)
+		return deps
+	}
+
+	prev, _ := ioutil.ReadFile(outputPath)
+	if bytes.Equal(prev, []byte(rst.Code)) {
+		return deps
+	}
+	err = ioutil.WriteFile(outputPath, []byte(rst.Code), 0600)
+	if err != nil {
+		printError(path, err)
+		return deps
+	}
+	fmt.Fprintf(os.Stderr, "needle: %s regenerated\n", outputPath)
+	return deps
+}
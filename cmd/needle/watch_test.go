@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const songsXML = `<needle>
+  <schema name="Songs" mainObj="Song">
+    <sql>CREATE TABLE Songs (ID BIGINT NOT NULL, SingerID BIGINT NOT NULL, PRIMARY KEY (ID));</sql>
+    <ref src="singers.xml"/>
+  </schema>
+  <stmts>
+    <query name="GetSong" type="single">
+      <sql>SELECT * FROM Songs WHERE ID = ?;</sql>
+    </query>
+  </stmts>
+</needle>`
+
+type watchTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (suite *watchTestSuite) SetupTest() {
+	suite.dir = suite.T().TempDir()
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.dir, "songs.xml"), []byte(songsXML), 0600))
+}
+
+func (suite *watchTestSuite) TestMissingRef() {
+	path := filepath.Join(suite.dir, "songs.xml")
+	out := filepath.Join(suite.dir, "songs.go")
+	deps := watchCompile(context.Background(), path, out)
+	// the missing ref is watched, so that the config is compiled once it is written.
+	suite.Contains(deps, filepath.Join(suite.dir, "singers.xml"))
+	_, err := os.Stat(out)
+	suite.True(os.IsNotExist(err))
+
+	singers := `<needle><schema name="Singers" mainObj="Singer">
+    <sql>CREATE TABLE Singers (ID BIGINT NOT NULL, PRIMARY KEY (ID));</sql></schema></needle>`
+	suite.Require().NoError(os.WriteFile(filepath.Join(suite.dir, "singers.xml"), []byte(singers), 0600))
+	deps = watchCompile(context.Background(), path, out)
+	suite.Equal([]string{path, filepath.Join(suite.dir, "singers.xml")}, deps)
+	_, err = os.Stat(out)
+	suite.NoError(err)
+}
+
+func TestWatchTestSuite(t *testing.T) {
+	suite.Run(t, new(watchTestSuite))
+}
@@ -0,0 +1,126 @@
+// Package needle compiles needle configs into Go repositories. It is the API used by
+// the needle command, for embedding needle in other generators and tests.
+package needle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/stumble/needle/pkg/config"
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/driver"
+	"github.com/stumble/needle/pkg/passes"
+	"github.com/stumble/needle/pkg/visitors"
+)
+
+// Options of a compilation.
+type Options struct {
+	// Path of the config. It is read from FS if Config is empty, otherwise it only
+	// names the config in diagnostics and resolves the schemas it references.
+	Path string
+	// Config is the content of the config.
+	Config []byte
+	// FS where the config and the schemas it references are read from, the file system
+	// of the operating system if nil.
+	FS fs.FS
+	// Output overrides names of the generated code, on top of the ones in config.
+	Output config.Output
+}
+
+// Result of a compilation.
+type Result struct {
+	// Code is the generated Go source. When some statements failed to compile, it only
+	// contains the statements that did not.
+	Code string
+	// PkgName is the package name of Code.
+	PkgName string
+	// Diagnostics found in all stages, including warnings, e.g. queries that are not
+	// cached.
+	Diagnostics diagnostic.List
+	// Repo is the intermediate representation, nil if the config cannot be loaded.
+	// Statements that failed to compile are poisoned.
+	Repo *driver.Repo
+	// Deps are paths of files that the compilation read or tried to read, e.g. the
+	// config and its references. Unlike sources of Repo, they are known even if the
+	// config cannot be loaded, like a <ref> to a file that does not exist yet.
+	Deps []string
+}
+
+// depsFS records names of files opened on it, whether they exist or not.
+type depsFS struct {
+	fs.FS
+	names []string
+	seen  map[string]bool
+}
+
+// Open implements fs.FS.
+func (d *depsFS) Open(name string) (fs.File, error) {
+	if !d.seen[name] {
+		d.seen[name] = true
+		d.names = append(d.names, name)
+	}
+	return d.FS.Open(name)
+}
+
+// Compile runs the whole pipeline on the config of @p opts. Result is returned as long
+// as the compilation is not canceled, error is the diagnostics if any of them is an error.
+func Compile(ctx context.Context, opts Options) (rst *Result, err error) {
+	if opts.Path == "" && len(opts.Config) == 0 {
+		return nil, errors.New("neither config path nor content is provided")
+	}
+	rst = &Result{}
+	filePos := diagnostic.Position{File: opts.Path}
+	// XXX(yumin): a panic here is a bug of needle, report it as a diagnostic so that
+	// the caller can carry on, e.g. compile other configs.
+	defer func() {
+		if r := recover(); r != nil {
+			rst.Diagnostics.Errorf(visitors.ErrCompilerError.String(), filePos, "", "%v", r)
+			err = rst.Diagnostics
+		}
+	}()
+
+	fsys := &depsFS{FS: opts.FS, seen: make(map[string]bool)}
+	if fsys.FS == nil {
+		fsys.FS = config.OSFS
+	}
+	var conf *config.NeedleConfig
+	if len(opts.Config) > 0 {
+		fsys.seen[opts.Path] = true
+		fsys.names = append(fsys.names, opts.Path)
+		conf, err = config.ParseConfig(opts.Config, opts.Path, fsys)
+	} else {
+		conf, err = config.ParseConfigFromFS(fsys, opts.Path)
+	}
+	rst.Deps = fsys.names
+	if err != nil {
+		rst.Diagnostics = diagnostic.FromError(err, filePos, "")
+		return rst, rst.Diagnostics
+	}
+
+	rst.Diagnostics = conf.Warnings
+	rst.Repo, err = driver.NewRepoFromConfig(conf)
+	rst.Diagnostics = append(rst.Diagnostics, diagnostic.FromError(err, filePos, "")...)
+	if rst.Repo == nil {
+		return rst, rst.Diagnostics
+	}
+
+	stages := []func(repo *driver.Repo) error{
+		(&passes.NormalizePass{}).Run,
+		func(repo *driver.Repo) error {
+			backend := &passes.CodegenPass{Output: opts.Output}
+			err := backend.Run(repo)
+			rst.Code, rst.PkgName = backend.Code, backend.PkgName
+			return err
+		},
+	}
+	for _, stage := range stages {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("compile %s: %w", opts.Path, err)
+		}
+		err = stage(rst.Repo)
+		rst.Diagnostics = append(rst.Diagnostics, diagnostic.FromError(err, filePos, "")...)
+	}
+	return rst, rst.Diagnostics.Err()
+}
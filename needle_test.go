@@ -0,0 +1,765 @@
+package needle
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/stumble/needle/pkg/config"
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+const singersXML = `<needle>
+  <schema name="Singers" mainObj="Singer">
+    <sql>
+      CREATE TABLE Singers (
+        ID INT NOT NULL,
+        Name VARCHAR(255) NOT NULL,
+        PRIMARY KEY (ID)
+      );
+    </sql>
+  </schema>
+  <stmts></stmts>
+</needle>`
+
+const songsXML = `<needle>
+  <schema name="Songs" mainObj="Song">
+    <sql>
+      CREATE TABLE Songs (
+        ID INT NOT NULL,
+        SingerID INT NOT NULL,
+        Title VARCHAR(255) NOT NULL,
+        PRIMARY KEY (ID)
+      );
+    </sql>
+    <ref src="../singers/singers.xml"></ref>
+  </schema>
+  <stmts>
+    <query name="GetSongsBySinger" type="many" cacheDuration="5m">
+      <sql>
+        SELECT Songs.Title FROM Songs
+        INNER JOIN Singers ON Songs.SingerID = Singers.ID
+        WHERE Singers.Name = ?;
+      </sql>
+    </query>
+    <query name="GetBadSongs" type="many" cacheDuration="5m">
+      <sql>
+        SELECT Titel FROM Songs;
+      </sql>
+    </query>
+    <mutation name="InsertSong">
+      <sql>
+        INSERT INTO Songs (ID, SingerID, Title) VALUES (?, ?, ?);
+      </sql>
+    </mutation>
+  </stmts>
+</needle>`
+
+const ordersXML = `<needle>
+  <schema name="Orders" mainObj="Order">
+    <sql>
+      CREATE TABLE Orders (
+        ID INT NOT NULL,
+        PRIMARY KEY (ID)
+      );
+    </sql>
+    <table mainObj="OrderItem">
+      <sql>
+        CREATE TABLE OrderItems (
+          ID INT NOT NULL,
+          OrderID INT NOT NULL,
+          Price INT NOT NULL,
+          PRIMARY KEY (ID)
+        );
+      </sql>
+    </table>
+  </schema>
+  <stmts>
+    <query name="GetOrderItems" type="many" cacheDuration="5m">
+      <sql>
+        SELECT * FROM OrderItems WHERE OrderID = ?;
+      </sql>
+    </query>
+    <mutation name="InsertOrderItem" invalidate="GetOrderItems">
+      <sql>
+        INSERT INTO OrderItems (ID, OrderID, Price) VALUES (?, ?, ?);
+      </sql>
+    </mutation>
+  </stmts>
+</needle>`
+
+type compileTestSuite struct {
+	suite.Suite
+	fsys fstest.MapFS
+}
+
+const filtersXML = `<fragments>
+  <fragment name="ByName">Name = ?</fragment>
+  <fragment name="ByNickname">Nickname = ?</fragment>
+</fragments>`
+
+const fragmentsXML = `<needle>
+  <schema name="Singers" mainObj="Singer">
+    <sql>CREATE TABLE Singers (ID INT NOT NULL, Name VARCHAR(255) NOT NULL, PRIMARY KEY (ID));</sql>
+    <ref src="../common/filters.xml"/>
+  </schema>
+  <stmts>
+    <query name="GetSingersByName" type="many" cacheDuration="5m">
+      <sql>SELECT * FROM Singers WHERE ${ByName};</sql>
+    </query>
+    <query name="GetSingersByNickname" type="many" cacheDuration="5m">
+      <sql>SELECT * FROM Singers WHERE ${ByNickname};</sql>
+    </query>
+  </stmts>
+</needle>`
+
+const typesXML = `<needle>
+  <schema name="Accounts" mainObj="Account">
+    <sql>CREATE TABLE Accounts (
+      ID CHAR(36) NOT NULL,
+      Balance BIGINT NOT NULL,
+      Credit BIGINT,
+      PRIMARY KEY (ID));</sql>
+  </schema>
+  <types>
+    <type column="Accounts.ID" go="github.com/google/uuid.UUID"/>
+    <type sqlType="bigint" go="github.com/acme/money.Cents"/>
+    <type column="Accounts.Missing" go="string"/>
+  </types>
+  <stmts>
+    <query name="GetAccount" type="single" cacheDuration="5m">
+      <sql>SELECT ID AS AccountID, Balance FROM Accounts WHERE ID = ?;</sql>
+    </query>
+    <query name="GetAccountsByIDs" type="many" cacheDuration="5m">
+      <sql>SELECT * FROM Accounts WHERE ID IN (?);</sql>
+    </query>
+  </stmts>
+</needle>`
+
+const aliasesXML = `<needle>
+  <schema name="Accounts" mainObj="Account">
+    <sql>CREATE TABLE Accounts (
+      ID CHAR(36) NOT NULL,
+      Kind ENUM('personal', 'business') NOT NULL,
+      Meta JSON,
+      PRIMARY KEY (ID));</sql>
+    <table mainObj="Owner">
+      <sql>CREATE TABLE Owners (
+        AccountID CHAR(36) NOT NULL,
+        Name VARCHAR(64) NOT NULL,
+        PRIMARY KEY (AccountID));</sql>
+    </table>
+  </schema>
+  <types>
+    <type column="Accounts.ID" go="github.com/google/uuid.UUID"/>
+    <type column="Owners.AccountID" go="github.com/google/uuid.UUID"/>
+    <type column="Accounts.Meta" json="github.com/acme/meta.Meta"/>
+  </types>
+  <stmts>
+    <query name="GetAccountByKind" type="single" cacheDuration="5m">
+      <sql>SELECT a.ID, a.Kind, a.Meta FROM Accounts a WHERE a.Kind = ? AND a.ID = ?;</sql>
+    </query>
+    <query name="GetOwners" type="many" cacheDuration="5m">
+      <sql>SELECT o.AccountID, o.Name, acc.Kind AS AccountKind FROM Owners o
+        JOIN Accounts acc ON acc.ID = o.AccountID WHERE acc.Meta = ? AND acc.ID IN (?);</sql>
+    </query>
+  </stmts>
+</needle>`
+
+const productsXML = `<needle>
+  <schema name="Products" mainObj="Product">
+    <sql>CREATE TABLE Products (
+      ID BIGINT UNSIGNED NOT NULL,
+      Price DECIMAL(10, 2) NOT NULL,
+      Weight DECIMAL(10, 3),
+      Hash BINARY(32) NOT NULL,
+      Image BLOB,
+      PRIMARY KEY (ID));</sql>
+  </schema>
+  <stmts>
+    <query name="GetProductByHash" type="single" cacheDuration="5m">
+      <sql>SELECT * FROM Products WHERE Hash = ?;</sql>
+    </query>
+    <query name="GetPriceStats" type="single" cacheDuration="5m">
+      <sql>SELECT SUM(Price) AS Total, AVG(Price) AS Average, MAX(ID) AS MaxID,
+        Price * 2 AS Doubled, ID + 1.5 AS Shifted FROM Products WHERE Price > ?;</sql>
+    </query>
+  </stmts>
+</needle>`
+
+const enumsXML = `<needle>
+  <schema name="Orders" mainObj="Order">
+    <sql>CREATE TABLE Orders (
+      ID BIGINT NOT NULL,
+      Status ENUM('new', 'in-progress', 'paid') NOT NULL DEFAULT 'new',
+      Flags SET('gift', 'express'),
+      PRIMARY KEY (ID));</sql>
+  </schema>
+  <stmts>
+    <query name="GetOrdersByStatus" type="many" cacheDuration="5m">
+      <sql>SELECT ID, Status AS OrderStatus, Flags FROM Orders WHERE Status IN (?) AND Flags = ?;</sql>
+    </query>
+    <mutation name="UpdateStatus">
+      <sql>UPDATE Orders SET Status = ? WHERE ID = ?;</sql>
+    </mutation>
+  </stmts>
+</needle>`
+
+const jsonXML = `<needle>
+  <schema name="Orders" mainObj="Order">
+    <sql>CREATE TABLE Orders (
+      ID BIGINT NOT NULL,
+      Meta JSON NOT NULL,
+      Extra JSON,
+      PRIMARY KEY (ID));</sql>
+  </schema>
+  <types>
+    <type column="Orders.Meta" json="github.com/acme/order.Meta"/>
+    <type column="Orders.Extra" json="github.com/acme/order.Meta"/>
+  </types>
+  <stmts>
+    <query name="GetOrderNotes" type="many" cacheDuration="5m">
+      <sql>SELECT ID, Meta->>'$.note' AS Note, Meta->'$.tags' AS Tags,
+        JSON_EXTRACT(Extra, '$.gift') AS Gift, Extra FROM Orders WHERE Meta = ?;</sql>
+    </query>
+    <mutation name="UpdateMeta">
+      <sql>UPDATE Orders SET Meta = ?, Extra = ? WHERE ID = ?;</sql>
+    </mutation>
+  </stmts>
+</needle>`
+
+const nullableXML = `<needle>
+  <schema name="Users" mainObj="User">
+    <sql>CREATE TABLE Users (
+      ID BIGINT NOT NULL,
+      Name VARCHAR(64),
+      Born DATETIME,
+      Visits BIGINT UNSIGNED,
+      PRIMARY KEY (ID));</sql>
+  </schema>
+  <output nullable="sql"/>
+  <stmts>
+    <query name="GetMaxVisits" type="single" cacheDuration="5m">
+      <sql>SELECT MAX(Visits) AS MaxVisits, MAX(Name) AS MaxName FROM Users;</sql>
+    </query>
+    <mutation name="UpdateUser">
+      <sql>UPDATE Users SET Name = ?, Born = ? WHERE ID = ?;</sql>
+    </mutation>
+  </stmts>
+</needle>`
+
+// runtimeXML is compiled and run with testdata/runtime/users_test.go.
+const runtimeXML = `<needle>
+  <schema name="Users" mainObj="User">
+    <sql>CREATE TABLE Users (
+      ID BIGINT NOT NULL,
+      Name VARCHAR(64),
+      Visits BIGINT UNSIGNED,
+      Role ENUM('admin', 'member') NOT NULL,
+      Flags SET('new', 'vip'),
+      Tags JSON,
+      PRIMARY KEY (ID));</sql>
+  </schema>
+  <types>
+    <type column="Users.Tags" json="[]string"/>
+  </types>
+  <output nullable="generic"/>
+  <stmts>
+    <query name="GetUser" type="single" cacheDuration="5m">
+      <sql>SELECT * FROM Users WHERE ID = ?;</sql>
+    </query>
+    <mutation name="InsertUser" invalidate="GetUser">
+      <sql>INSERT INTO Users (ID, Name, Visits, Role, Flags, Tags) VALUES (?, ?, ?, ?, ?, ?);</sql>
+    </mutation>
+  </stmts>
+</needle>`
+
+const caseXML = `<needle>
+  <schema name="Users" mainObj="User">
+    <sql>CREATE TABLE Users (
+      ID BIGINT NOT NULL,
+      Name VARCHAR(64) NOT NULL,
+      Nick VARCHAR(64),
+      Status ENUM('new', 'active') NOT NULL,
+      Score INT NOT NULL,
+      PRIMARY KEY (ID));</sql>
+  </schema>
+  <stmts>
+    <query name="ListUsers" type="many">
+      <sql>SELECT ID, CASE Status WHEN ? THEN 'fresh' ELSE Nick END AS Label,
+        CASE WHEN Score > ? THEN ? ELSE 0 END AS Bonus, CASE WHEN Score > 10 THEN Name END AS Top
+        FROM Users ORDER BY CASE WHEN Name = ? THEN 0 ELSE 1 END, Score;</sql>
+    </query>
+    <mutation name="UpdateStatus">
+      <sql>UPDATE Users SET Status = CASE WHEN Score > ? THEN ? ELSE Status END WHERE ID = ?;</sql>
+    </mutation>
+  </stmts>
+</needle>`
+
+// Events has a column of TIME, which has no Go type.
+const unsupportedXML = `<needle>
+  <schema name="Events" mainObj="Event">
+    <sql>CREATE TABLE Events (
+      ID BIGINT NOT NULL,
+      Duration TIME NOT NULL,
+      PRIMARY KEY (ID));</sql>
+  </schema>
+  <stmts>
+    <query name="GetDuration" type="single" cacheDuration="5m">
+      <sql>SELECT Duration FROM Events WHERE ID = ?;</sql>
+    </query>
+    <query name="GetEventIDs" type="many" cacheDuration="5m">
+      <sql>SELECT ID FROM Events WHERE Missing = ?;</sql>
+    </query>
+  </stmts>
+</needle>`
+
+func TestCompileTestSuite(t *testing.T) {
+	suite.Run(t, new(compileTestSuite))
+}
+
+func (suite *compileTestSuite) SetupTest() {
+	suite.fsys = fstest.MapFS{
+		"singers/singers.xml": {Data: []byte(singersXML)},
+		"songs/songs.xml":     {Data: []byte(songsXML)},
+		"orders/orders.xml":   {Data: []byte(ordersXML)},
+		"common/filters.xml":  {Data: []byte(filtersXML)},
+	}
+}
+
+func (suite *compileTestSuite) TestFS() {
+	rst, err := Compile(context.Background(), Options{Path: "singers/singers.xml", FS: suite.fsys})
+	suite.Require().NoError(err)
+	suite.Equal("singersrepo", rst.PkgName)
+	suite.Contains(rst.Code, "package singersrepo")
+	suite.Empty(rst.Diagnostics)
+	suite.Require().NotNil(rst.Repo)
+	suite.Equal("Singers", rst.Repo.Config.Schema.Name)
+}
+
+func (suite *compileTestSuite) TestDeps() {
+	// songs.xml has a statement that fails to compile.
+	rst, _ := Compile(context.Background(), Options{Path: "songs/songs.xml", FS: suite.fsys})
+	suite.Require().NotNil(rst.Repo)
+	suite.Equal([]string{"songs/songs.xml", "singers/singers.xml"}, rst.Deps)
+
+	// a ref that does not exist yet is a dependency as well.
+	delete(suite.fsys, "singers/singers.xml")
+	rst, err := Compile(context.Background(), Options{Path: "songs/songs.xml", FS: suite.fsys})
+	suite.Require().Error(err)
+	suite.Nil(rst.Repo)
+	suite.Equal([]string{"songs/songs.xml", "singers/singers.xml"}, rst.Deps)
+}
+
+func (suite *compileTestSuite) TestOutput() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "singers/singers.xml",
+		FS:     suite.fsys,
+		Output: config.Output{Package: "singers", Constructor: "NewRepo", ImplStruct: "repo"},
+	})
+	suite.Require().NoError(err)
+	suite.Equal("singers", rst.PkgName)
+	suite.Contains(rst.Code, "package singers\n")
+	suite.Contains(rst.Code, "type Singers interface {")
+	suite.Contains(rst.Code, "func NewRepo(c Cache, exec DBExecuter) Singers {")
+	suite.Contains(rst.Code, "type repo struct {")
+
+	_, err = Compile(context.Background(), Options{
+		Path:   "singers/singers.xml",
+		FS:     suite.fsys,
+		Output: config.Output{Interface: "Singer"},
+	})
+	suite.ErrorContains(err, "Singer conflicts with the mainObj name")
+}
+
+func (suite *compileTestSuite) TestWarnings() {
+	src := strings.Replace(singersXML, "<stmts></stmts>", `<stmts>
+    <query name="GetSinger" type="single">
+      <sql>SELECT * FROM Singers WHERE ID = ?;</sql>
+    </query>
+  </stmts>`, 1)
+	rst, err := Compile(context.Background(), Options{Path: "singers.xml", Config: []byte(src)})
+	suite.Require().NoError(err)
+	suite.Require().Len(rst.Diagnostics, 1)
+	d := rst.Diagnostics[0]
+	suite.Equal(diagnostic.SeverityWarning, d.Severity)
+	suite.Equal("GetSinger", d.Stmt)
+	suite.Equal(diagnostic.Position{File: "singers.xml", Line: 12, Column: 5}, d.Pos)
+	suite.Contains(d.Message, "not cached")
+}
+
+func (suite *compileTestSuite) TestTables() {
+	rst, err := Compile(context.Background(), Options{Path: "orders/orders.xml", FS: suite.fsys})
+	suite.Require().NoError(err)
+	suite.Require().Len(rst.Repo.Mains, 2)
+	suite.Contains(rst.Code, "type OrderItem struct {")
+	suite.Contains(rst.Code, "GetOrderItems(ctx context.Context, args *GetOrderItemsArgs, options ...Option) ([]OrderItem, error)")
+	suite.Contains(rst.Code, "InsertOrderItem(ctx context.Context, args *OrderItem,")
+	suite.Contains(rst.Code, "LoadOrderItem(ctx context.Context, data []byte) error")
+	suite.Contains(rst.Code, "DumpOrderItem(ctx context.Context, beforeDump ...BeforeDumpOrderItem) ([]byte, error)")
+	suite.Contains(rst.Code, "var CreateTableOrderItemStmt = ")
+	suite.Contains(rst.Code, "Dump(ctx context.Context, beforeDump ...BeforeDump) ([]byte, error)")
+}
+
+func (suite *compileTestSuite) TestBytes() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "songs/songs.xml",
+		Config: []byte(songsXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().Error(err)
+	suite.Require().NotNil(rst)
+	suite.Require().NotNil(rst.Repo)
+	suite.Require().Len(rst.Repo.Config.Sources, 2)
+	suite.Equal("singers/singers.xml", rst.Repo.Config.Sources[1].Path)
+
+	// only the bad query fails, others are still generated.
+	suite.Require().NotEmpty(rst.Diagnostics)
+	for _, d := range rst.Diagnostics {
+		suite.Equal("GetBadSongs", d.Stmt)
+		suite.Equal("songs/songs.xml", d.Pos.File)
+	}
+	suite.Contains(rst.Code, "GetSongsBySinger")
+	suite.Contains(rst.Code, "InsertSong")
+	suite.NotContains(rst.Code, "GetBadSongs")
+}
+
+func (suite *compileTestSuite) TestFragments() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "singers/fragments.xml",
+		Config: []byte(fragmentsXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().Error(err)
+	suite.Contains(rst.Code, "GetSingersByName(ctx context.Context, args *GetSingersByNameArgs")
+	suite.Contains(rst.Code, "Name string")
+
+	// errors in fragments are reported where they are.
+	suite.Require().NotEmpty(rst.Diagnostics)
+	for _, d := range rst.Diagnostics {
+		suite.Equal("GetSingersByNickname", d.Stmt)
+		suite.Equal("common/filters.xml", d.Pos.File)
+		suite.Equal(3, d.Pos.Line)
+	}
+}
+
+func (suite *compileTestSuite) TestUnsupportedType() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "events/events.xml",
+		Config: []byte(unsupportedXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().Error(err)
+	// the column, the output of its query, and the other query are all diagnosed.
+	var lines []int
+	for _, d := range rst.Diagnostics {
+		lines = append(lines, d.Pos.Line)
+		suite.NotContains(d.Message, "CompilerError")
+	}
+	suite.ElementsMatch([]int{5, 10, 13, 13}, lines)
+	for _, d := range rst.Diagnostics {
+		switch d.Pos.Line {
+		case 5:
+			suite.Equal(7, d.Pos.Column)
+			suite.Contains(d.Message, "column Duration: unsupported type: time")
+		case 10:
+			suite.Equal("GetDuration", d.Stmt)
+			suite.Contains(d.Message, "unsupported type: time")
+		}
+	}
+}
+
+func (suite *compileTestSuite) TestYAMLBlockScalar() {
+	src := `schema:
+  name: Users
+  mainObj: User
+  sql: |
+    CREATE TABLE Users (
+      ID BIGINT NOT NULL,
+      PRIMARY KEY (ID));
+stmts:
+  queries:
+    - name: GetUser
+      type: single
+      sql: |
+        SELECT * FROM Users
+        WHERE Missing = ?;
+`
+	rst, err := Compile(context.Background(), Options{Path: "users.yaml", Config: []byte(src)})
+	suite.Require().Error(err)
+	suite.Require().NotEmpty(rst.Diagnostics)
+	for _, d := range rst.Diagnostics {
+		suite.Equal("GetUser", d.Stmt)
+		if d.Severity == diagnostic.SeverityWarning {
+			suite.Contains(d.Message, "not cached")
+			continue
+		}
+		suite.Equal(14, d.Pos.Line)
+		suite.Equal(15, d.Pos.Column)
+	}
+}
+
+func (suite *compileTestSuite) TestTypes() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "accounts/accounts.xml",
+		Config: []byte(typesXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().Error(err)
+	suite.Require().Len(rst.Diagnostics, 1)
+	suite.Equal(12, rst.Diagnostics[0].Pos.Line)
+	suite.Contains(rst.Diagnostics[0].Message, "type mapping of unknown column Accounts.Missing")
+
+	suite.Contains(rst.Code, "\tuuid \"github.com/google/uuid\"\n")
+	suite.Contains(rst.Code, "\tmoney \"github.com/acme/money\"\n")
+	suite.Contains(rst.Code, "Id      uuid.UUID    `json:\"id,omitempty\"`")
+	suite.Contains(rst.Code, "Balance money.Cents  `json:\"balance,omitempty\"`")
+	suite.Contains(rst.Code, "Credit  *money.Cents `json:\"credit,omitempty\"`")
+	suite.Contains(rst.Code, "AccountID uuid.UUID")
+	suite.Contains(rst.Code, "IDList []uuid.UUID")
+
+	// columns of aliased tables are mapped as those of the tables.
+	rst, err = Compile(context.Background(), Options{
+		Path:   "accounts/aliases.xml",
+		Config: []byte(aliasesXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	suite.Contains(rst.Code, "type GetAccountByKindArgs struct {\n\tKind AccountKind\n\tId   uuid.UUID\n}")
+	suite.Contains(rst.Code,
+		"type GetAccountByKindRst struct {\n\tId   uuid.UUID\n\tKind AccountKind\n\tMeta *meta.Meta\n}")
+	suite.Contains(rst.Code, "AccountID   uuid.UUID")
+	suite.Contains(rst.Code, "AccountKind AccountKind")
+	suite.Contains(rst.Code, "type GetOwnersArgs struct {\n\tMeta   meta.Meta\n\tIDList []uuid.UUID\n}")
+}
+
+func (suite *compileTestSuite) TestNumbersAndBinaries() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "products/products.xml",
+		Config: []byte(productsXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	suite.Contains(rst.Code, "Id     uint64  `json:\"id,omitempty\"`")
+	suite.Contains(rst.Code, "Price  string  `json:\"price,omitempty\"`")
+	suite.Contains(rst.Code, "Weight *string `json:\"weight,omitempty\"`")
+	suite.Contains(rst.Code, "Hash   []byte  `json:\"hash,omitempty\"`")
+	suite.Contains(rst.Code, "Image  *[]byte `json:\"image,omitempty\"`")
+	suite.Contains(rst.Code, "Total   *string")
+	suite.Contains(rst.Code, "Average *string")
+	suite.Contains(rst.Code, "MaxID   *uint64")
+	suite.Contains(rst.Code, "Doubled string")
+	suite.Contains(rst.Code, "Shifted string")
+	suite.Contains(rst.Code, "hex.EncodeToString(b)")
+
+	// decimals can be mapped to other types.
+	mapped := strings.Replace(productsXML, "<stmts>",
+		`<types><type sqlType="DECIMAL" go="float64"/></types><stmts>`, 1)
+	rst, err = Compile(context.Background(), Options{
+		Path:   "products/products.xml",
+		Config: []byte(mapped),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	suite.Contains(rst.Code, "Price  float64  `json:\"price,omitempty\"`")
+	suite.Contains(rst.Code, "Total   *float64")
+}
+
+func (suite *compileTestSuite) TestEnums() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "orders/enums.xml",
+		Config: []byte(enumsXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	suite.Contains(rst.Code, "type OrderStatus string")
+	suite.Contains(rst.Code, "OrderStatusInProgress OrderStatus = \"in-progress\"")
+	suite.Contains(rst.Code, "func (e OrderStatus) Valid() bool {")
+	suite.Contains(rst.Code, "func (e *OrderStatus) UnmarshalJSON(data []byte) error {")
+	suite.Contains(rst.Code, "type OrderFlags []OrderFlagsItem")
+	suite.Contains(rst.Code, "OrderFlagsItemGift    OrderFlagsItem = \"gift\"")
+	suite.Contains(rst.Code, "func (s *OrderFlags) Scan(src interface{}) error {")
+
+	suite.Contains(rst.Code, "Status OrderStatus `json:\"status,omitempty\"`")
+	suite.Contains(rst.Code, "Flags  *OrderFlags `json:\"flags,omitempty\"`")
+	suite.Contains(rst.Code, "StatusList []OrderStatus")
+	suite.Contains(rst.Code, "OrderStatus OrderStatus")
+	suite.Contains(rst.Code, "Status OrderStatus\n\tId     int64")
+
+	// mapped columns are not generated.
+	mapped := strings.Replace(enumsXML, "<stmts>",
+		`<types><type sqlType="SET" go="string"/></types><stmts>`, 1)
+	rst, err = Compile(context.Background(), Options{
+		Path:   "orders/enums.xml",
+		Config: []byte(mapped),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	suite.NotContains(rst.Code, "OrderFlags")
+	suite.Contains(rst.Code, "type OrderStatus string")
+}
+
+func (suite *compileTestSuite) TestJSON() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "orders/json.xml",
+		Config: []byte(jsonXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	suite.Contains(rst.Code, "\torder \"github.com/acme/order\"\n")
+	suite.Contains(rst.Code, "Meta  order.Meta  `json:\"meta,omitempty\"`")
+	suite.Contains(rst.Code, "Extra *order.Meta `json:\"extra,omitempty\"`")
+	suite.Contains(rst.Code, "jsonField{&r.Meta},\n\t\tjsonField{&r.Extra})")
+	suite.Contains(rst.Code, "args = append(args, jsonField{r.Meta})")
+	suite.Contains(rst.Code, "valueToString(jsonField{r.Meta})")
+
+	// JSON path operators and functions.
+	suite.Contains(rst.Code, "Note  *string")
+	suite.Contains(rst.Code, "Tags  *json.RawMessage")
+	suite.Contains(rst.Code, "Gift  *json.RawMessage")
+}
+
+func (suite *compileTestSuite) TestNullable() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "users/users.xml",
+		Config: []byte(nullableXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	suite.Contains(rst.Code, "Name   sql.NullString `json:\"name\"`")
+	suite.Contains(rst.Code, "Born   sql.NullTime   `json:\"born\"`")
+	// types that database/sql has no nullable type of are pointers.
+	suite.Contains(rst.Code, "Visits *uint64        `json:\"visits,omitempty\"`")
+	suite.Contains(rst.Code, "MaxVisits *uint64\n\tMaxName   sql.NullString")
+	suite.Contains(rst.Code, "Name sql.NullString\n\tBorn sql.NullTime\n\tId   int64")
+	suite.NotContains(rst.Code, "type Null[T any] struct")
+
+	rst, err = Compile(context.Background(), Options{
+		Path:   "users/users.xml",
+		Config: []byte(nullableXML),
+		FS:     suite.fsys,
+		Output: config.Output{Nullable: config.NullableGeneric},
+	})
+	suite.Require().NoError(err)
+	suite.Contains(rst.Code, "type Null[T any] struct")
+	suite.Contains(rst.Code, "Name   Null[string]    `json:\"name\"`")
+	suite.Contains(rst.Code, "Born   Null[time.Time] `json:\"born\"`")
+	suite.Contains(rst.Code, "Visits Null[uint64]    `json:\"visits\"`")
+	suite.Contains(rst.Code, "MaxVisits Null[uint64]\n\tMaxName   Null[string]")
+
+	_, err = Compile(context.Background(), Options{
+		Path:   "users/users.xml",
+		Config: []byte(nullableXML),
+		FS:     suite.fsys,
+		Output: config.Output{Nullable: "optional"},
+	})
+	suite.ErrorContains(err, "nullable must be one of pointer, sql and generic")
+}
+
+func (suite *compileTestSuite) TestImports() {
+	for _, c := range []struct {
+		path   string
+		src    string
+		output config.Output
+		driver bool
+		hex    bool
+	}{
+		{"users/users.xml", nullableXML, config.Output{Nullable: config.NullablePointer}, false, false},
+		{"users/users.xml", nullableXML, config.Output{}, true, false},
+		{"users/users.xml", nullableXML, config.Output{Nullable: config.NullableGeneric}, true, false},
+		{"products/products.xml", productsXML, config.Output{}, false, true},
+		{"orders/enums.xml", enumsXML, config.Output{}, true, false},
+		{"orders/json.xml", jsonXML, config.Output{}, true, true},
+	} {
+		rst, err := Compile(context.Background(), Options{
+			Path:   c.path,
+			Config: []byte(c.src),
+			FS:     suite.fsys,
+			Output: c.output,
+		})
+		suite.Require().NoError(err, c.path)
+		suite.Equal(c.driver, strings.Contains(rst.Code, `"database/sql/driver"`), c.path)
+		suite.Equal(c.hex, strings.Contains(rst.Code, `"encoding/hex"`), c.path)
+	}
+}
+
+// TestRuntime builds the generated package, and runs its test that round-trips rows
+// through a fake database/sql driver.
+func (suite *compileTestSuite) TestRuntime() {
+	if testing.Short() {
+		suite.T().Skip("builds the generated package")
+	}
+	rst, err := Compile(context.Background(), Options{
+		Path:   "users/users.xml",
+		Config: []byte(runtimeXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal("usersrepo", rst.PkgName)
+	test, err := os.ReadFile(filepath.Join("testdata", "runtime", "users_test.go"))
+	suite.Require().NoError(err)
+
+	dir := suite.T().TempDir()
+	for name, src := range map[string]string{
+		"go.mod":        "module usersrepo\n\ngo 1.18\n",
+		"users.go":      rst.Code,
+		"users_test.go": string(test),
+	} {
+		suite.Require().NoError(os.WriteFile(filepath.Join(dir, name), []byte(src), 0600))
+	}
+	cmd := exec.Command("go", "test", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=")
+	out, err := cmd.CombinedOutput()
+	suite.Require().NoError(err, string(out))
+}
+
+func (suite *compileTestSuite) TestCase() {
+	rst, err := Compile(context.Background(), Options{
+		Path:   "users/users.xml",
+		Config: []byte(caseXML),
+		FS:     suite.fsys,
+	})
+	suite.Require().NoError(err)
+	// WHEN of a CASE of a column is the column, THEN of a selected CASE is by its alias.
+	suite.Contains(rst.Code, `type ListUsersArgs struct {
+	Status    UserStatus
+	Score     int64
+	BonusThen int64
+	Name      string
+}`)
+	// no ELSE, or a nullable result, is nullable.
+	suite.Contains(rst.Code, `type ListUsersRst struct {
+	Id    int64
+	Label *string
+	Bonus int64
+	Top   *string
+}`)
+	// results of a CASE assigned to a column are the column.
+	suite.Contains(rst.Code, `type UpdateStatusArgs struct {
+	Score  int64
+	Status UserStatus
+	Id     int64
+}`)
+}
+
+func (suite *compileTestSuite) TestInvalid() {
+	_, err := Compile(context.Background(), Options{})
+	suite.Error(err)
+
+	rst, err := Compile(context.Background(), Options{Path: "missing.xml", FS: suite.fsys})
+	suite.Require().Error(err)
+	suite.Nil(rst.Repo)
+	suite.Len(rst.Diagnostics, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Compile(ctx, Options{Path: "singers/singers.xml", FS: suite.fsys})
+	suite.ErrorIs(err, context.Canceled)
+}
@@ -0,0 +1,45 @@
+package codegen
+
+import (
+	"bytes"
+	"text/template"
+
+	codetemplates "github.com/stumble/needle/pkg/codegen/template"
+)
+
+var enumTemplate *template.Template
+
+func init() {
+	var err error
+	enumTemplate, err = template.New("Enum").Parse(codetemplates.GetEnumTemplate())
+	if err != nil {
+		panic(err)
+	}
+}
+
+// EnumValue - a constant of an enum type.
+type EnumValue struct {
+	Name  string
+	Value string
+}
+
+// EnumTemplate - the named string type of an ENUM column, or the slice type of a SET
+// column, whose items are of the named string type ItemName.
+type EnumTemplate struct {
+	Name     string
+	ItemName string
+	// Column is Table.Column that the type is generated for.
+	Column string
+	Values []EnumValue
+	IsSet  bool
+}
+
+// Generate string template
+func (e EnumTemplate) Generate() (string, error) {
+	buf := bytes.NewBufferString("")
+	err := enumTemplate.Execute(buf, e)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -18,9 +18,11 @@ func init() {
 	}
 }
 
-// LoadDumpFuncTemplate - the load and dump functions.
+// LoadDumpFuncTemplate - the load and dump functions. Suffix is appended to their
+// names, and to BeforeDump, for tables other than the one of the schema.
 type LoadDumpFuncTemplate struct {
 	RepoName       string
+	Suffix         string
 	MainStructName string
 	SelectAllSQL   string
 	InsertRowSQL   string
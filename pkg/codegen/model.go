@@ -3,9 +3,12 @@ package codegen
 import (
 	"bytes"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
+	"unicode"
 
 	"github.com/iancoleman/strcase"
 
@@ -31,30 +34,76 @@ type {{.Name}} struct {
 
 // GoType - a simple type in go.
 // If both pointer and list, it represents []*T, not *[]T, i.e. nullability is on the inner
-// type.
+// type. Pkg is the import path, the package is imported as PkgName(Pkg). Values of
+// IsJSON types are stored as JSON, they are marshaled and unmarshaled by jsonField.
+// IsNull is like IsPointer, but it represents Null[T] of the generated generic type.
 type GoType struct {
 	Pkg       string
 	ID        string
 	IsPointer bool
+	IsNull    bool
 	IsList    bool
+	IsJSON    bool
 }
 
 func (g GoType) String() string {
 	rst := g.ID
 	if g.Pkg != "" {
-		i := strings.LastIndex(g.Pkg, "/")
-		pkgname := g.Pkg[i+1:]
-		rst = pkgname + "." + rst
+		rst = PkgName(g.Pkg) + "." + rst
 	}
 	if g.IsPointer {
 		rst = "*" + rst
 	}
+	if g.IsNull {
+		rst = "Null[" + rst + "]"
+	}
 	if g.IsList {
 		rst = "[]" + rst
 	}
 	return rst
 }
 
+var majorVersionRegexp = regexp.MustCompile(`[./]v[0-9]+$`)
+
+// PkgName returns the name that the package of import path @p pkg is imported as,
+// the last element of the path without the major version, e.g. yaml of gopkg.in/yaml.v3,
+// and with characters that are not allowed in identifiers removed.
+func PkgName(pkg string) string {
+	pkg = majorVersionRegexp.ReplaceAllString(pkg, "")
+	name := pkg[strings.LastIndex(pkg, "/")+1:]
+	name = strings.TrimSuffix(strings.TrimPrefix(name, "go-"), "-go")
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// Imports returns import specs of packages used by fields of @p structs, except for
+// ones in @p exclude, sorted by path.
+func Imports(structs []*GoStruct, exclude ...string) []string {
+	excluded := make(map[string]bool)
+	for _, pkg := range exclude {
+		excluded[pkg] = true
+	}
+	pkgs := make([]string, 0)
+	for _, s := range structs {
+		for _, f := range s.Fields {
+			if f.Type.Pkg != "" && !excluded[f.Type.Pkg] {
+				excluded[f.Type.Pkg] = true
+				pkgs = append(pkgs, f.Type.Pkg)
+			}
+		}
+	}
+	sort.Strings(pkgs)
+	rst := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		rst = append(rst, fmt.Sprintf("%s %q", PkgName(pkg), pkg))
+	}
+	return rst
+}
+
 // GoField - a struct field.
 type GoField struct {
 	Name string
@@ -102,6 +151,10 @@ func (g GoStruct) IsEmpty() bool {
 func (g GoStruct) ScanFunc() string {
 	fieldnames := make([]string, 0)
 	for _, f := range g.Fields {
+		if f.Type.IsJSON {
+			fieldnames = append(fieldnames, "jsonField{&r."+f.Name+"}")
+			continue
+		}
 		fieldnames = append(fieldnames, "&r."+f.Name)
 	}
 	fieldstr := strings.Join(fieldnames, ",\n")
@@ -122,6 +175,10 @@ func (g GoStruct) KeyFunc(prefix string) string {
 	}
 	fieldnames := make([]string, 0)
 	for _, f := range g.Fields {
+		if f.Type.IsJSON {
+			fieldnames = append(fieldnames, "valueToString(jsonField{r."+f.Name+"})")
+			continue
+		}
 		fieldnames = append(fieldnames, "valueToString(r."+f.Name+")")
 	}
 	fieldstr := strings.Join(fieldnames, ",\n")
@@ -135,14 +192,19 @@ func (g GoStruct) KeyFunc(prefix string) string {
 func (g GoStruct) ArglistFunc() string {
 	var builder strings.Builder
 	for _, f := range g.Fields {
+		arg := "%s"
+		if f.Type.IsJSON {
+			arg = "jsonField{%s}"
+		}
 		if !f.Type.IsList {
-			builder.WriteString(fmt.Sprintf("args = append(args, %s)\n", "r."+f.Name))
+			builder.WriteString(fmt.Sprintf("args = append(args, %s)\n",
+				fmt.Sprintf(arg, "r."+f.Name)))
 		} else {
 			tpl := `for _, v := range %s {
-	args = append(args, v)
+	args = append(args, %s)
 }
 `
-			builder.WriteString(fmt.Sprintf(tpl, "r."+f.Name))
+			builder.WriteString(fmt.Sprintf(tpl, "r."+f.Name, fmt.Sprintf(arg, "v")))
 			builder.WriteString(fmt.Sprintf("inlens = append(inlens, len(%s))\n", "r."+f.Name))
 		}
 	}
@@ -2,6 +2,7 @@ package codegen
 
 import (
 	"bytes"
+	"regexp"
 	"text/template"
 
 	codetemplates "github.com/stumble/needle/pkg/codegen/template"
@@ -25,18 +26,33 @@ type SQLStatementDecl struct {
 
 // RepoTemplate template for render a repo.
 type RepoTemplate struct {
-	NeedleVersion       string
-	TableSchema         string
-	PkgName             string
+	NeedleVersion string
+	InputHash     string
+	TableSchema   string
+	TableSchemas  []SQLStatementDecl
+	PkgName       string
+	// Imports are specs of packages of user types, e.g. uuid "github.com/google/uuid".
+	Imports             []string
 	InterfaceName       string
+	ConstructorName     string
 	InterfaceSignatures []string
 	RepoName            string
-	MainStruct          string
-	MainStructName      string
-	LoadDump            string
-	Statements          []SQLStatementDecl
-	Queries             []string
-	Mutations           []string
+	// Enums are types of ENUM and SET columns.
+	Enums string
+	// NullableGeneric generates the generic type Null[T] of nullable values.
+	NullableGeneric bool
+	// JSONFields generates jsonField, which scans and binds fields stored as JSON.
+	JSONFields bool
+	// Valuers prints values of driver.Valuer in cache keys, e.g. sql.NullString.
+	Valuers bool
+	// Bytes prints byte slices in cache keys as hex.
+	Bytes          bool
+	MainStruct     string
+	MainStructName string
+	LoadDump       string
+	Statements     []SQLStatementDecl
+	Queries        []string
+	Mutations      []string
 }
 
 // Generate string template
@@ -48,3 +64,15 @@ func (q RepoTemplate) Generate() (string, error) {
 	}
 	return buf.String(), nil
 }
+
+var inputHashRegexp = regexp.MustCompile(`(?m)^// needle:inputs (\S+)$`)
+
+// ParseInputHash returns the input hash in the header of a generated repo, empty
+// string if not found.
+func ParseInputHash(code []byte) string {
+	m := inputHashRegexp.FindSubmatch(code)
+	if m == nil {
+		return ""
+	}
+	return string(m[1])
+}
@@ -35,3 +35,11 @@ var repoTemplate string
 func GetRepoTemplate() string {
 	return repoTemplate
 }
+
+//go:embed templates/enum.tmpl
+var enumTemplate string
+
+// GetEnumTemplate - return an enum or set type template
+func GetEnumTemplate() string {
+	return enumTemplate
+}
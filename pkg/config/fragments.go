@@ -0,0 +1,261 @@
+package config
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+// Fragment is a reusable piece of SQL, e.g. a predicate shared by queries. It is
+// referenced as ${Name} in statements and other fragments, and expanded before the
+// statement is parsed.
+type Fragment struct {
+	Name string  `xml:"name,attr" yaml:"name"`
+	SQL  SQLStmt `xml:",chardata" yaml:"sql"`
+
+	Pos    diagnostic.Position `xml:"-" yaml:"-"`
+	SQLPos diagnostic.Position `xml:"-" yaml:"-"`
+}
+
+// fragmentLibrary is a file of fragments only, which configs import by references.
+// Its root is <fragments> in XML, or a YAML document with fragments but no schema.
+type fragmentLibrary struct {
+	XMLName   xml.Name   `xml:"fragments" yaml:"-"`
+	Fragments []Fragment `xml:"fragment" yaml:"fragments"`
+}
+
+var fragmentRefRegexp = regexp.MustCompile(`\$\{\s*(\w*)\s*\}`)
+
+// SQLMap maps offsets of a statement whose fragments are expanded to positions in
+// the sources, the statement itself and fragments. Nil if nothing is expanded.
+type SQLMap []sqlSpan
+
+// sqlSpan is a piece of an expanded statement that is copied from a source.
+type sqlSpan struct {
+	// start offset in the expanded statement.
+	start int
+	// text of the source, which is at pos, and the span is text[offset:offset+length].
+	text   string
+	pos    diagnostic.Position
+	offset int
+	length int
+}
+
+// PosOf returns the position in sources of the byte at @p offset of the expanded
+// statement @p sql, which is at @p start if it is not expanded. Like SQLStmt.PosOf,
+// offset 0 is considered as the statement itself.
+func (m SQLMap) PosOf(sql SQLStmt, start diagnostic.Position, offset int) diagnostic.Position {
+	if len(m) == 0 {
+		return sql.PosOf(start, offset)
+	}
+	if offset == 0 {
+		offset = len(sql) - len(strings.TrimLeftFunc(string(sql), unicode.IsSpace))
+	}
+	for i := len(m) - 1; i >= 0; i-- {
+		span := m[i]
+		if offset >= span.start {
+			delta := offset - span.start
+			if delta > span.length {
+				delta = span.length
+			}
+			return span.pos.Advance(span.text, span.offset+delta)
+		}
+	}
+	return sql.PosOf(start, offset)
+}
+
+// isFragmentLibrary returns true if @p src at @p path is a fragment library.
+func isFragmentLibrary(path string, src []byte) bool {
+	if isYAML(path) {
+		var doc map[string]interface{}
+		if err := yaml.Unmarshal(src, &doc); err != nil {
+			return false
+		}
+		_, hasFragments := doc["fragments"]
+		_, hasSchema := doc["schema"]
+		return hasFragments && !hasSchema
+	}
+	if isSQL(path) {
+		return false
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(src))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local == "fragments"
+		}
+	}
+}
+
+// decodeFragmentLibrary decodes the fragment library @p src, and locates fragments.
+func decodeFragmentLibrary(path string, src []byte) ([]Fragment, error) {
+	fileStart := diagnostic.Position{File: path, Line: 1, Column: 1}
+	var lib fragmentLibrary
+	var locations sourceMap
+	if isYAML(path) {
+		decoder := yaml.NewDecoder(bytes.NewReader(src))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&lib); err != nil && err != io.EOF {
+			return nil, diagnostic.List{errorAt(fileStart, "", "parse YAML", err)}
+		}
+		var root yaml.Node
+		if err := yaml.Unmarshal(src, &root); err == nil {
+			locations = locateYAML(path, src, &root)
+		}
+	} else {
+		if err := xml.Unmarshal(src, &lib); err != nil {
+			return nil, diagnostic.List{errorAt(fileStart, "", "parse XML", err)}
+		}
+		locations = locateElements(path, src)
+	}
+	data := NeedleConfig{Fragments: lib.Fragments}
+	locations.apply(&data, fileStart)
+	if diags := validateFragments(data.Fragments); diags.HasErrors() {
+		return nil, diags
+	}
+	return data.Fragments, nil
+}
+
+// validateFragments checks names of @p fragments.
+func validateFragments(fragments []Fragment) diagnostic.List {
+	var diags diagnostic.List
+	names := make(map[string]bool)
+	for i, f := range fragments {
+		section := fmt.Sprintf("validate %d-th fragment %s", i, f.Name)
+		if err := validName(f.Name); err != nil {
+			diags = append(diags, errorAt(f.Pos, "", section, err))
+			continue
+		}
+		if names[f.Name] {
+			diags = append(diags, errorAt(f.Pos, "", section,
+				errors.New("duplicated fragment name: "+f.Name)))
+			continue
+		}
+		names[f.Name] = true
+	}
+	return diags
+}
+
+// importFragments adds @p fragments imported by the reference @p ref to @p data. A
+// fragment that is defined again the same way is dropped, and one that is defined
+// differently is an error at the reference.
+func importFragments(data *NeedleConfig, ref Reference, fragments []Fragment) diagnostic.List {
+	var diags diagnostic.List
+	for _, f := range fragments {
+		prev, dup := data.fragment(f.Name)
+		if !dup {
+			data.Fragments = append(data.Fragments, f)
+			continue
+		}
+		if strings.TrimSpace(string(prev.SQL)) != strings.TrimSpace(string(f.SQL)) {
+			diags = append(diags, errorAt(ref.Pos, "", "import referenced fragments: "+ref.Src,
+				fmt.Errorf("fragment %s of %s conflicts with the one of %s",
+					f.Name, f.Pos.File, prev.Pos.File)))
+		}
+	}
+	return diags
+}
+
+func (n *NeedleConfig) fragment(name string) (Fragment, bool) {
+	for _, f := range n.Fragments {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Fragment{}, false
+}
+
+// expandFragments expands fragments referenced by queries and mutations, their SQLMap
+// are set if anything is expanded.
+func expandFragments(data *NeedleConfig) diagnostic.List {
+	var diags diagnostic.List
+	for i, q := range data.Stmts.Queries {
+		sql, sqlMap, err := data.expand(q.SQL, q.SQLPos, nil)
+		if err != nil {
+			diags = append(diags, withStmt(err, q.Name)...)
+			continue
+		}
+		data.Stmts.Queries[i].SQL, data.Stmts.Queries[i].SQLMap = sql, sqlMap
+	}
+	for i, m := range data.Stmts.Mutations {
+		sql, sqlMap, err := data.expand(m.SQL, m.SQLPos, nil)
+		if err != nil {
+			diags = append(diags, withStmt(err, m.Name)...)
+			continue
+		}
+		data.Stmts.Mutations[i].SQL, data.Stmts.Mutations[i].SQLMap = sql, sqlMap
+	}
+	return diags
+}
+
+// expand returns @p sql at @p pos with fragments expanded recursively, @p stack is
+// fragments being expanded, to detect cycles. The map is nil if nothing is expanded.
+func (n *NeedleConfig) expand(sql SQLStmt, pos diagnostic.Position, stack []string) (
+	SQLStmt, SQLMap, diagnostic.List) {
+	refs := fragmentRefRegexp.FindAllStringSubmatchIndex(string(sql), -1)
+	if len(refs) == 0 {
+		return sql, nil, nil
+	}
+	var out strings.Builder
+	var rst SQLMap
+	copySrc := func(from, to int) {
+		if from < to {
+			rst = append(rst, sqlSpan{start: out.Len(), text: string(sql), pos: pos,
+				offset: from, length: to - from})
+			out.WriteString(string(sql)[from:to])
+		}
+	}
+	cursor := 0
+	for _, ref := range refs {
+		copySrc(cursor, ref[0])
+		cursor = ref[1]
+		name := string(sql)[ref[2]:ref[3]]
+		refPos := sql.PosOf(pos, ref[0])
+		for i, s := range stack {
+			if s == name {
+				cycle := append(append([]string{}, stack[i:]...), name)
+				return "", nil, diagnostic.List{errorAt(refPos, "", "expand fragment "+name,
+					fmt.Errorf("fragment cycle: %s", strings.Join(cycle, " -> ")))}
+			}
+		}
+		f, ok := n.fragment(name)
+		if !ok {
+			return "", nil, diagnostic.List{errorAt(refPos, "", "expand fragment "+name,
+				errors.New("unknown fragment"))}
+		}
+		body, bodyMap, err := n.expand(f.SQL, f.SQLPos, append(stack, name))
+		if err != nil {
+			return "", nil, err
+		}
+		if bodyMap == nil {
+			bodyMap = SQLMap{{text: string(f.SQL), pos: f.SQLPos, length: len(f.SQL)}}
+		}
+		for _, span := range bodyMap {
+			span.start += out.Len()
+			rst = append(rst, span)
+		}
+		out.WriteString(string(body))
+	}
+	copySrc(cursor, len(sql))
+	return SQLStmt(out.String()), rst, nil
+}
+
+// withStmt sets the statement of @p diags to @p stmt.
+func withStmt(diags diagnostic.List, stmt string) diagnostic.List {
+	for i := range diags {
+		diags[i].Stmt = stmt
+	}
+	return diags
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// osFS is the file system of the operating system. Unlike os.DirFS, names are not
+// restricted to valid fs.FS paths, so that configs can be loaded by absolute paths and
+// reference files like ../schema.xml.
+type osFS struct{}
+
+// OSFS is the file system of the operating system that configs are read from by default.
+var OSFS fs.FS = osFS{}
+
+// Open implements fs.FS.
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
+
+// refPath returns the path of @p src referenced by the file at @p from.
+func refPath(from string, src string) string {
+	return path.Join(path.Dir(filepath.ToSlash(from)), filepath.ToSlash(src))
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"encoding/xml"
+	"regexp"
+	"strings"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+const cdataPrefix = "<![CDATA["
+
+var cacheDurationAttrRegexp = regexp.MustCompile(`\scacheDuration\s*=`)
+
+// sourceMap holds positions of elements in a config file, in document order.
+type sourceMap struct {
+	output       diagnostic.Position
+	schema       diagnostic.Position
+	schemaSQL    diagnostic.Position
+	tables       []diagnostic.Position
+	tableSQLs    []diagnostic.Position
+	refs         []diagnostic.Position
+	queries      []diagnostic.Position
+	querySQLs    []diagnostic.Position
+	queryCaches  []diagnostic.Position
+	mutations    []diagnostic.Position
+	mutationSQLs []diagnostic.Position
+	fragments    []diagnostic.Position
+	fragmentSQLs []diagnostic.Position
+	types        []diagnostic.Position
+}
+
+// locateElements finds out where elements are in @p src, a config or a fragment
+// library. It is best-effort: unknown positions are left invalid, and offsets inside
+// <sql> and <fragment> are not adjusted for escaped characters like &lt;.
+func locateElements(path string, src []byte) sourceMap {
+	var rst sourceMap
+	posOf := func(offset int64) diagnostic.Position {
+		return diagnostic.PositionOfOffset(path, src, int(offset))
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(src))
+	var stack []string
+	var sqlTarget *diagnostic.Position // non-nil when in a <sql> not located yet.
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch v := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, v.Name.Local)
+			switch strings.Join(stack, "/") {
+			case "needle/output":
+				rst.output = posOf(offset)
+			case "needle/schema":
+				rst.schema = posOf(offset)
+			case "needle/schema/sql":
+				sqlTarget = &rst.schemaSQL
+			case "needle/schema/table":
+				rst.tables = append(rst.tables, posOf(offset))
+			case "needle/schema/table/sql":
+				rst.tableSQLs = append(rst.tableSQLs, diagnostic.Position{})
+				sqlTarget = &rst.tableSQLs[len(rst.tableSQLs)-1]
+			case "needle/schema/ref":
+				rst.refs = append(rst.refs, posOf(offset))
+			case "needle/stmts/query":
+				rst.queries = append(rst.queries, posOf(offset))
+				cache := diagnostic.Position{}
+				tag := src[offset:decoder.InputOffset()]
+				if loc := cacheDurationAttrRegexp.FindIndex(tag); loc != nil {
+					cache = posOf(offset + int64(loc[0]) + 1)
+				}
+				rst.queryCaches = append(rst.queryCaches, cache)
+			case "needle/stmts/query/sql":
+				rst.querySQLs = append(rst.querySQLs, diagnostic.Position{})
+				sqlTarget = &rst.querySQLs[len(rst.querySQLs)-1]
+			case "needle/stmts/mutation":
+				rst.mutations = append(rst.mutations, posOf(offset))
+			case "needle/stmts/mutation/sql":
+				rst.mutationSQLs = append(rst.mutationSQLs, diagnostic.Position{})
+				sqlTarget = &rst.mutationSQLs[len(rst.mutationSQLs)-1]
+			case "needle/types/type":
+				rst.types = append(rst.types, posOf(offset))
+			case "needle/fragment", "fragments/fragment":
+				// the body of a fragment is its text, there is no <sql>.
+				rst.fragments = append(rst.fragments, posOf(offset))
+				rst.fragmentSQLs = append(rst.fragmentSQLs, diagnostic.Position{})
+				sqlTarget = &rst.fragmentSQLs[len(rst.fragmentSQLs)-1]
+			}
+		case xml.CharData:
+			if sqlTarget != nil {
+				if bytes.HasPrefix(src[offset:], []byte(cdataPrefix)) {
+					offset += int64(len(cdataPrefix))
+				}
+				*sqlTarget = posOf(offset)
+				sqlTarget = nil
+			}
+		case xml.EndElement:
+			if sqlTarget != nil {
+				// empty sql.
+				*sqlTarget = posOf(offset)
+				sqlTarget = nil
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return rst
+}
+
+func positionAt(positions []diagnostic.Position, i int, fallback diagnostic.Position) diagnostic.Position {
+	if i < len(positions) {
+		return positions[i]
+	}
+	return fallback
+}
+
+// apply sets positions of elements of @p data, @p fileStart is the fallback of
+// elements that are not located.
+func (m sourceMap) apply(data *NeedleConfig, fileStart diagnostic.Position) {
+	data.Output.Pos = m.output
+	data.Schema.Pos = m.schema
+	data.Schema.SQLPos = m.schemaSQL
+	for i := range data.Schema.Tables {
+		data.Schema.Tables[i].Pos = positionAt(m.tables, i, data.Schema.Pos)
+		data.Schema.Tables[i].SQLPos = positionAt(m.tableSQLs, i, data.Schema.Tables[i].Pos)
+	}
+	for i := range data.Schema.Refs {
+		data.Schema.Refs[i].Pos = positionAt(m.refs, i, data.Schema.Pos)
+	}
+	for i := range data.Stmts.Queries {
+		data.Stmts.Queries[i].Pos = positionAt(m.queries, i, fileStart)
+		data.Stmts.Queries[i].SQLPos = positionAt(m.querySQLs, i, data.Stmts.Queries[i].Pos)
+		data.Stmts.Queries[i].CacheDurationPos = data.Stmts.Queries[i].Pos
+		if pos := positionAt(m.queryCaches, i, diagnostic.Position{}); pos.IsValid() {
+			data.Stmts.Queries[i].CacheDurationPos = pos
+		}
+	}
+	for i := range data.Stmts.Mutations {
+		data.Stmts.Mutations[i].Pos = positionAt(m.mutations, i, fileStart)
+		data.Stmts.Mutations[i].SQLPos = positionAt(
+			m.mutationSQLs, i, data.Stmts.Mutations[i].Pos)
+	}
+	for i := range data.Types {
+		data.Types[i].Pos = positionAt(m.types, i, fileStart)
+	}
+	for i := range data.Fragments {
+		data.Fragments[i].Pos = positionAt(m.fragments, i, fileStart)
+		data.Fragments[i].SQLPos = positionAt(m.fragmentSQLs, i, data.Fragments[i].Pos)
+	}
+}
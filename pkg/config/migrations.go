@@ -0,0 +1,87 @@
+package config
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/parser"
+	"github.com/stumble/needle/pkg/utils"
+)
+
+// isDir returns true if @p name is a directory of @p fsys.
+func isDir(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	return err == nil && info.IsDir()
+}
+
+// replayMigrations replays .sql files in the migration directory @p dir, ordered by
+// their names, and returns the final definitions of tables. As the SQL of a table is
+// restored from the replayed AST, its SQLPos is where the table is created, and
+// positions inside it are approximate.
+func replayMigrations(fsys fs.FS, dir string) ([]RefTable, []Source, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() && isSQL(entry.Name()) {
+			files = append(files, path.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+
+	replayer := parser.NewReplayer()
+	createdAt := make(map[string]diagnostic.Position)
+	// the directory itself is a source, so that adding a migration is a change.
+	sources := []Source{{Path: dir, Hash: sha256.Sum256([]byte(strings.Join(files, "\n")))}}
+	for _, file := range files {
+		src, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, Source{Path: file, Hash: sha256.Sum256(src)})
+		start := diagnostic.Position{File: file, Line: 1, Column: 1}
+		stmts, offsets, err := SQLStmt(src).ParseAll()
+		if err != nil {
+			offset, _ := parser.ErrorOffset(string(src), err)
+			return nil, nil, diagnostic.List{errorAt(start.Advance(string(src), offset), "",
+				"parse migration", err)}
+		}
+		for i, stmt := range stmts {
+			pos := SQLStmt(stmt.Text()).PosOf(start.Advance(string(src), offsets[i]), 0)
+			if err := replayer.Apply(stmt); err != nil {
+				return nil, nil, diagnostic.List{errorAt(pos, "", "replay migration", err)}
+			}
+			// tables that are dropped forget where they were created.
+			current := make(map[string]diagnostic.Position)
+			for _, tb := range replayer.Tables() {
+				name := strings.ToLower(tb.Table.Name.O)
+				current[name] = pos
+				if prev, ok := createdAt[name]; ok {
+					current[name] = prev
+				}
+			}
+			createdAt = current
+		}
+	}
+
+	rst := make([]RefTable, 0)
+	for _, tb := range replayer.Tables() {
+		rst = append(rst, RefTable{
+			Name:   tb.Table.Name.O,
+			SQL:    SQLStmt(utils.RestoreNode(tb)),
+			SQLPos: createdAt[strings.ToLower(tb.Table.Name.O)],
+			Path:   dir,
+		})
+	}
+	if len(rst) == 0 {
+		return nil, nil, errors.New("no table is created by migrations")
+	}
+	return rst, sources, nil
+}
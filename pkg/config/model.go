@@ -1,19 +1,20 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"go/token"
+	"io/fs"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/pingcap/tidb/parser/ast"
-	"github.com/rs/zerolog/log"
 
+	"github.com/stumble/needle/pkg/diagnostic"
 	"github.com/stumble/needle/pkg/parser"
 )
 
@@ -35,20 +36,171 @@ func (s SQLStmt) Parse() (ast.StmtNode, error) {
 	return p.ParseOneStmt(string(s))
 }
 
-// NeedleConfig the root structure of a needle xml config file
+// ParseAll parses all statements of the SQL, returns them and their offsets.
+func (s SQLStmt) ParseAll() ([]ast.StmtNode, []int, error) {
+	p := parser.NewSQLParser()
+	stmts, err := p.Parse(string(s))
+	if err != nil {
+		return nil, nil, err
+	}
+	// statements are in order, each one starts where its text is found first.
+	offsets := make([]int, len(stmts))
+	cursor := 0
+	for i, stmt := range stmts {
+		if idx := strings.Index(string(s)[cursor:], stmt.Text()); idx >= 0 {
+			offsets[i] = cursor + idx
+			cursor += idx + len(stmt.Text())
+		} else {
+			offsets[i] = cursor
+		}
+	}
+	return stmts, offsets, nil
+}
+
+// PosOf returns the position of the byte at @p offset of the statement, @p start is
+// the position of the statement. Offset 0 is considered as the statement itself, so
+// leading spaces are skipped.
+func (s SQLStmt) PosOf(start diagnostic.Position, offset int) diagnostic.Position {
+	if offset == 0 {
+		offset = len(s) - len(strings.TrimLeftFunc(string(s), unicode.IsSpace))
+	}
+	return start.Advance(string(s), offset)
+}
+
+// NeedleConfig the root structure of a needle xml or yaml config file
 type NeedleConfig struct {
-	XMLName xml.Name `xml:"needle"`
-	Schema  Schema   `xml:"schema"`
-	Stmts   Stmts    `xml:"stmts"`
+	XMLName xml.Name `xml:"needle" yaml:"-"`
+	Output  Output   `xml:"output" yaml:"output"`
+	Schema  Schema   `xml:"schema" yaml:"schema"`
+	Stmts   Stmts    `xml:"stmts" yaml:"stmts"`
+	// Fragments of this config, followed by the ones imported by references.
+	Fragments []Fragment `xml:"fragment" yaml:"fragments"`
+	// Types maps columns and SQL types to user Go types.
+	Types []TypeMapping `xml:"types>type" yaml:"types"`
+
+	// Sources are files that this config is compiled from, itself comes first.
+	Sources []Source `xml:"-" yaml:"-"`
+	// Warnings found in parsing, e.g. queries that are not cached.
+	Warnings diagnostic.List `xml:"-" yaml:"-"`
+}
+
+// Source is a file that the config is compiled from.
+type Source struct {
+	Path string
+	Hash [sha256.Size]byte
+}
+
+// Path of the config file.
+func (c NeedleConfig) Path() string {
+	if len(c.Sources) == 0 {
+		return ""
+	}
+	return c.Sources[0].Path
+}
+
+// Digest returns a hex encoded sha256 of the content of all sources. Paths are not
+// included, so moving files around does not change the digest.
+func (c NeedleConfig) Digest() string {
+	h := sha256.New()
+	for _, src := range c.Sources {
+		h.Write(src.Hash[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Output overrides names of the generated code, empty ones are derived from the schema
+// name: package <name>repo, interface <Name>, constructor New<Name>, struct <name>.
+// Nullable is how nullable values are represented, one of Nullable*, pointers if empty.
+type Output struct {
+	Package     string `xml:"package,attr" yaml:"package"`
+	Interface   string `xml:"interface,attr" yaml:"interface"`
+	Constructor string `xml:"constructor,attr" yaml:"constructor"`
+	ImplStruct  string `xml:"implStruct,attr" yaml:"implStruct"`
+	Nullable    string `xml:"nullable,attr" yaml:"nullable"`
+
+	Pos diagnostic.Position `xml:"-" yaml:"-"`
+}
+
+const (
+	// NullablePointer represents nullable values by pointers, e.g. *string.
+	NullablePointer = "pointer"
+	// NullableSQL represents nullable values by types of database/sql, e.g. sql.NullString,
+	// and by pointers if there is no such type.
+	NullableSQL = "sql"
+	// NullableGeneric represents nullable values by the generated generic type Null[T].
+	NullableGeneric = "generic"
+)
+
+// Merge returns a copy of @p o, with names overridden by non-empty ones of @p override.
+func (o Output) Merge(override Output) Output {
+	if override.Package != "" {
+		o.Package = override.Package
+	}
+	if override.Interface != "" {
+		o.Interface = override.Interface
+	}
+	if override.Constructor != "" {
+		o.Constructor = override.Constructor
+	}
+	if override.ImplStruct != "" {
+		o.ImplStruct = override.ImplStruct
+	}
+	if override.Nullable != "" {
+		o.Nullable = override.Nullable
+	}
+	return o
 }
 
-// Schema schema of this config and imported sources.
+// IsValid return nil if all non-empty names are valid.
+func (o Output) IsValid() error {
+	if o.Package != "" {
+		if !token.IsIdentifier(o.Package) || o.Package != strings.ToLower(o.Package) {
+			return fmt.Errorf("%w, package must be a lower-cased Go identifier, but %s is not",
+				ErrInvalidIdentifier, o.Package)
+		}
+	}
+	for _, name := range []string{o.Interface, o.Constructor} {
+		if name != "" && !token.IsExported(name) {
+			return fmt.Errorf("%w, interface and constructor must be exported, but %s is not",
+				ErrInvalidIdentifier, name)
+		}
+	}
+	switch o.Nullable {
+	case "", NullablePointer, NullableSQL, NullableGeneric:
+	default:
+		return fmt.Errorf("nullable must be one of %s, %s and %s, but it is %s",
+			NullablePointer, NullableSQL, NullableGeneric, o.Nullable)
+	}
+	names := map[string]bool{}
+	for _, name := range []string{o.Interface, o.Constructor, o.ImplStruct} {
+		if name == "" {
+			continue
+		}
+		if !token.IsIdentifier(name) {
+			return fmt.Errorf("%w, %s is not a Go identifier", ErrInvalidIdentifier, name)
+		}
+		if names[name] {
+			return fmt.Errorf("%s is used by more than one of interface, constructor and implStruct", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// Schema schema of this config and imported sources. SQL is read from Src if set,
+// and Name defaults to the name of the table then. Src can be a directory of
+// migrations, which are replayed to get the table named Name.
 type Schema struct {
-	HiddenFieldsStr string      `xml:"hiddenFields,attr"`
-	Name            string      `xml:"name,attr"`
-	MainObj         string      `xml:"mainObj,attr"`
-	SQL             SQLStmt     `xml:"sql"`
-	Refs            []Reference `xml:"ref"`
+	HiddenFieldsStr string      `xml:"hiddenFields,attr" yaml:"hiddenFields"`
+	Name            string      `xml:"name,attr" yaml:"name"`
+	MainObj         string      `xml:"mainObj,attr" yaml:"mainObj"`
+	Src             string      `xml:"src,attr" yaml:"src"`
+	SQL             SQLStmt     `xml:"sql" yaml:"sql"`
+	Tables          []Table     `xml:"table" yaml:"tables"`
+	Refs            []Reference `xml:"ref" yaml:"refs"`
+
+	Pos    diagnostic.Position `xml:"-" yaml:"-"`
+	SQLPos diagnostic.Position `xml:"-" yaml:"-"`
 }
 
 // HiddenFields return hidden fields of this schema.
@@ -70,20 +222,56 @@ func (s Schema) IsValid() error {
 	return nil
 }
 
+// MainTables returns tables owned by this schema, the one of the schema itself first.
+func (s Schema) MainTables() []Table {
+	rst := []Table{{
+		MainObj:         s.MainObj,
+		HiddenFieldsStr: s.HiddenFieldsStr,
+		SQL:             s.SQL,
+		Pos:             s.Pos,
+		SQLPos:          s.SQLPos,
+	}}
+	return append(rst, s.Tables...)
+}
+
+// Table is another table owned by the schema, it has its own main struct and Load
+// and Dump, named Load<MainObj> and Dump<MainObj>. SQL is read from Src if set.
+type Table struct {
+	// Name of the table in Src if it is a migration directory.
+	Name            string  `xml:"name,attr" yaml:"name"`
+	HiddenFieldsStr string  `xml:"hiddenFields,attr" yaml:"hiddenFields"`
+	MainObj         string  `xml:"mainObj,attr" yaml:"mainObj"`
+	Src             string  `xml:"src,attr" yaml:"src"`
+	SQL             SQLStmt `xml:"sql" yaml:"sql"`
+
+	Pos    diagnostic.Position `xml:"-" yaml:"-"`
+	SQLPos diagnostic.Position `xml:"-" yaml:"-"`
+}
+
+// HiddenFields return hidden fields of this table.
+func (t Table) HiddenFields() []string {
+	return commaSplitList(t.HiddenFieldsStr)
+}
+
 // Reference is imported schemas. stmts like join may need stmts from others.
-// SQL is set after importing from source.
+// SQL is set after importing from source, and Tables are all tables it imports,
+// including the ones referenced by the source in turn, except for duplicated ones.
 type Reference struct {
-	Src string `xml:"src,attr"`
-	SQL SQLStmt
+	Src    string     `xml:"src,attr" yaml:"src"`
+	SQL    SQLStmt    `yaml:"-"`
+	Tables []RefTable `xml:"-" yaml:"-"`
+
+	Pos    diagnostic.Position `xml:"-" yaml:"-"`
+	SQLPos diagnostic.Position `xml:"-" yaml:"-"`
 }
 
 // Stmts -
 type Stmts struct {
-	Queries   []Query    `xml:"query"`
-	Mutations []Mutation `xml:"mutation"`
+	Queries   []Query    `xml:"query" yaml:"queries"`
+	Mutations []Mutation `xml:"mutation" yaml:"mutations"`
 
-	QueryMap    map[string]*Query
-	MutationMap map[string]*Mutation
+	QueryMap    map[string]*Query    `yaml:"-"`
+	MutationMap map[string]*Mutation `yaml:"-"`
 }
 
 const (
@@ -93,11 +281,18 @@ const (
 
 // Query is the type of select statement.
 type Query struct {
-	XMLName          xml.Name `xml:"query"`
-	Name             string   `xml:"name,attr"`
-	Type             string   `xml:"type,attr"`
-	CacheDurationStr string   `xml:"cacheDuration,attr"`
-	SQL              SQLStmt  `xml:"sql"`
+	XMLName          xml.Name `xml:"query" yaml:"-"`
+	Name             string   `xml:"name,attr" yaml:"name"`
+	Type             string   `xml:"type,attr" yaml:"type"`
+	CacheDurationStr string   `xml:"cacheDuration,attr" yaml:"cacheDuration"`
+	SQL              SQLStmt  `xml:"sql" yaml:"sql"`
+
+	Pos    diagnostic.Position `xml:"-" yaml:"-"`
+	SQLPos diagnostic.Position `xml:"-" yaml:"-"`
+	// CacheDurationPos is the position of cacheDuration, Pos if not located.
+	CacheDurationPos diagnostic.Position `xml:"-" yaml:"-"`
+	// SQLMap maps offsets of SQL to sources if fragments are expanded.
+	SQLMap SQLMap `xml:"-" yaml:"-"`
 }
 
 // IsValid nil if Query is valid.
@@ -108,18 +303,6 @@ func (q Query) IsValid() error {
 	if !(q.Type == single || q.Type == many) {
 		return errors.New("query type illegal:" + q.Name)
 	}
-	if q.CacheDurationStr != "" && q.CacheDurationStr != cacheForever {
-		v, err := time.ParseDuration(q.CacheDurationStr)
-		if err != nil {
-			return err
-		}
-		if v <= 0 {
-			return errors.New("cache-duration <= 0s is invalid: " + q.CacheDurationStr)
-		}
-	}
-	if q.CacheDurationStr == "" {
-		log.Warn().Msgf("WARNING: query %s is not cached\n", q.Name)
-	}
 	return nil
 }
 
@@ -132,27 +315,36 @@ func (q Query) IsSingleRow() bool {
 // CacheDuration cache duration of query result.
 // nil = nocache
 // 0 time.Duration indicates cache forever.
-func (q Query) CacheDuration() *time.Duration {
+// returns an error if the duration is invalid or not positive.
+func (q Query) CacheDuration() (*time.Duration, error) {
 	if q.CacheDurationStr == "" {
-		return nil
+		return nil, nil
 	}
 	if q.CacheDurationStr == cacheForever {
 		v := time.Duration(0)
-		return &v
+		return &v, nil
 	}
 	d, err := time.ParseDuration(q.CacheDurationStr)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if d <= 0 {
+		return nil, errors.New("cache-duration <= 0s is invalid: " + q.CacheDurationStr)
 	}
-	return &d
+	return &d, nil
 }
 
 // Mutation are one of Insert/Update/Delete
 type Mutation struct {
-	XMLName       xml.Name `xml:"mutation"`
-	Name          string   `xml:"name,attr"`
-	InvalidateStr string   `xml:"invalidate,attr"`
-	SQL           SQLStmt  `xml:"sql"`
+	XMLName       xml.Name `xml:"mutation" yaml:"-"`
+	Name          string   `xml:"name,attr" yaml:"name"`
+	InvalidateStr string   `xml:"invalidate,attr" yaml:"invalidate"`
+	SQL           SQLStmt  `xml:"sql" yaml:"sql"`
+
+	Pos    diagnostic.Position `xml:"-" yaml:"-"`
+	SQLPos diagnostic.Position `xml:"-" yaml:"-"`
+	// SQLMap maps offsets of SQL to sources if fragments are expanded.
+	SQLMap SQLMap `xml:"-" yaml:"-"`
 }
 
 // IsValid - return nil if valid.
@@ -168,69 +360,159 @@ func (m Mutation) InvalidateQueries() []string {
 	return commaSplitList(m.InvalidateStr)
 }
 
-// parseConfig
-func parseConfig(config io.Reader, path string, recursiveImport bool) (*NeedleConfig, error) {
-	bytes, err := ioutil.ReadAll(config)
+// parseConfig returns a diagnostic.List as error if config is invalid. Referenced
+// schemas are imported transitively by @p imp. The format is chosen by the extension
+// of @p path, YAML for .yaml and .yml, annotated SQL for .sql, otherwise XML.
+func parseConfig(imp *importer, bytes []byte, path string) (*NeedleConfig, error) {
+	fsys := imp.fsys
+	decode := decodeXML
+	switch {
+	case isYAML(path):
+		decode = decodeYAML
+	case isSQL(path):
+		decode = decodeSQL
+	}
+	data, err := decode(path, bytes)
 	if err != nil {
-		return nil, errorFormatter(path, "load XML", err)
+		return nil, err
 	}
-	var data NeedleConfig
-	err = xml.Unmarshal(bytes, &data)
+	data.Sources = []Source{{Path: path, Hash: sha256.Sum256(bytes)}}
+
+	var diags diagnostic.List
+
+	// validate output names
+	err = data.Output.IsValid()
 	if err != nil {
-		return nil, errorFormatter(path, "parse XML", err)
+		diags = append(diags, errorAt(data.Output.Pos, "", "validate output names", err))
+	}
+
+	// load schema from file
+	if data.Schema.Src != "" {
+		err := loadSQLSrc(fsys, path, data, data.Schema.Src, data.Schema.Name,
+			&data.Schema.SQL, &data.Schema.SQLPos)
+		if err != nil {
+			diags = append(diags, loadErrors(data.Schema.Pos, "load schema: "+data.Schema.Src, err)...)
+		} else if data.Schema.Name == "" {
+			data.Schema.Name = tableName(data.Schema.SQL)
+		}
+	}
+	for i, tb := range data.Schema.Tables {
+		if tb.Src == "" {
+			continue
+		}
+		err := loadSQLSrc(fsys, path, data, tb.Src, tb.Name,
+			&data.Schema.Tables[i].SQL, &data.Schema.Tables[i].SQLPos)
+		if err != nil {
+			diags = append(diags, loadErrors(tb.Pos, "load table: "+tb.Src, err)...)
+		}
 	}
 
 	// validate schema
 	err = data.Schema.IsValid()
 	if err != nil {
-		return nil, errorFormatter(path, "validate schema names", err)
+		diags = append(diags, errorAt(data.Schema.Pos, "", "validate schema names", err))
+	}
+	mainObjs := map[string]bool{data.Schema.MainObj: true}
+	for i, tb := range data.Schema.Tables {
+		section := fmt.Sprintf("validate %d-th table %s", i, tb.MainObj)
+		if err := validName(tb.MainObj); err != nil {
+			diags = append(diags, errorAt(tb.Pos, "", section, err))
+			continue
+		}
+		if mainObjs[tb.MainObj] || tb.MainObj == data.Schema.Name {
+			diags = append(diags, errorAt(tb.Pos, "", section,
+				errors.New("duplicated mainObj name: "+tb.MainObj)))
+			continue
+		}
+		mainObjs[tb.MainObj] = true
+	}
+	// names of Load and Dump of other main tables.
+	loadDumpNames := make(map[string]bool)
+	for _, tb := range data.Schema.Tables {
+		loadDumpNames["Load"+tb.MainObj] = true
+		loadDumpNames["Dump"+tb.MainObj] = true
 	}
 
-	// import referenced schemas, but do not recursively import all.
-	if recursiveImport {
-		for i, imp := range data.Schema.Refs {
-			src := filepath.Join(filepath.Dir(path), imp.Src)
-			importedConf, err := parseConfigFromFileImport(src, false)
-			if err != nil {
-				return nil, errorFormatter(path, "import referenced schema: "+src, err)
-			}
-			data.Schema.Refs[i].SQL = importedConf.Schema.SQL
+	// validate type mappings.
+	mapped := make(map[string]bool)
+	for i, t := range data.Types {
+		section := fmt.Sprintf("validate %d-th type mapping", i)
+		if err := t.IsValid(); err != nil {
+			diags = append(diags, errorAt(t.Pos, "", section, err))
+			continue
 		}
+		key := strings.ToLower("column " + t.Column + " sqlType " + t.SQLType)
+		if mapped[key] {
+			diags = append(diags, errorAt(t.Pos, "", section,
+				errors.New("duplicated type mapping of "+t.Column+t.SQLType)))
+			continue
+		}
+		mapped[key] = true
+	}
+
+	// import referenced schemas and fragments transitively, then expand fragments.
+	diags = append(diags, validateFragments(data.Fragments)...)
+	diags = append(diags, imp.importRefs(path, data)...)
+	if !diags.HasErrors() {
+		diags = append(diags, expandFragments(data)...)
 	}
 
 	// validate queries.
+	var warnings diagnostic.List
 	data.Stmts.QueryMap = make(map[string]*Query)
 	for i, q := range data.Stmts.Queries {
+		section := fmt.Sprintf("validate %d-th query %s", i, q.Name)
 		if err := q.IsValid(); err != nil {
-			return nil, errorFormatter(path,
-				fmt.Sprintf("validate %d-th query %s", i, q.Name), err)
+			diags = append(diags, errorAt(q.Pos, q.Name, section, err))
+			continue
+		}
+		if _, err := q.CacheDuration(); err != nil {
+			diags = append(diags, errorAt(q.CacheDurationPos, q.Name, section, err))
+			continue
+		}
+		if loadDumpNames[q.Name] {
+			diags = append(diags, errorAt(q.Pos, q.Name, section,
+				errors.New("query name conflicts with Load or Dump of a table: "+q.Name)))
+			continue
 		}
 		_, has := data.Stmts.QueryMap[q.Name]
 		if has {
-			return nil, errorFormatter(path, fmt.Sprintf("validate %d-th query %s", i, q.Name),
-				errors.New("duplicated query name: "+q.Name))
+			diags = append(diags, errorAt(q.Pos, q.Name, section,
+				errors.New("duplicated query name: "+q.Name)))
+			continue
 		}
 		data.Stmts.QueryMap[q.Name] = &data.Stmts.Queries[i]
+		if q.CacheDurationStr == "" {
+			warnings.Warnf(diagnostic.CategoryConfig, q.Pos, q.Name, "query %s is not cached", q.Name)
+		}
 	}
 
 	// validate mutations.
 	data.Stmts.MutationMap = make(map[string]*Mutation)
 	for i, m := range data.Stmts.Mutations {
+		section := fmt.Sprintf("validate %d-th mutation %s", i, m.Name)
 		if err := m.IsValid(); err != nil {
-			return nil, errorFormatter(path,
-				fmt.Sprintf("validate %d-th mutation %s", i, m.Name), err)
+			diags = append(diags, errorAt(m.Pos, m.Name, section, err))
+			continue
 		}
 
 		// name check
+		if loadDumpNames[m.Name] {
+			diags = append(diags, errorAt(m.Pos, m.Name, section,
+				errors.New("mutation name conflicts with Load or Dump of a table: "+m.Name)))
+			continue
+		}
 		_, dupName := data.Stmts.QueryMap[m.Name]
 		if dupName {
-			return nil, errorFormatter(path, fmt.Sprintf("validate %d-th mutation %s", i, m.Name),
-				errors.New("mutation name conflicts with query name: "+m.Name))
+			diags = append(diags, errorAt(m.Pos, m.Name, section,
+				errors.New("mutation name conflicts with query name: "+m.Name)))
+			continue
 		}
 		_, dupName = data.Stmts.MutationMap[m.Name]
 		if dupName {
-			return nil, errorFormatter(path, fmt.Sprintf("validate %d-th mutation %s", i, m.Name),
-				errors.New("mutation name conflicts: "+m.Name))
+			diags = append(diags, errorAt(m.Pos, m.Name, section,
+				errors.New("mutation name conflicts: "+m.Name)))
+			continue
 		}
 		data.Stmts.MutationMap[m.Name] = &data.Stmts.Mutations[i]
 
@@ -238,31 +520,124 @@ func parseConfig(config io.Reader, path string, recursiveImport bool) (*NeedleCo
 		for _, q := range invalidates {
 			query, has := data.Stmts.QueryMap[q]
 			if !has {
-				return nil, errorFormatter(path, fmt.Sprintf("validate %d-th mutation %s", i, m.Name),
-					fmt.Errorf("failed to find the query %s", q))
+				diags = append(diags, errorAt(m.Pos, m.Name, section,
+					fmt.Errorf("failed to find the query %s", q)))
+				continue
 			}
-			if query.CacheDuration() == nil {
-				return nil, errorFormatter(path, fmt.Sprintf("validate %d-th mutation %s", i, m.Name),
-					fmt.Errorf("query %s in invalidate list is not cached: ", q))
+			if d, _ := query.CacheDuration(); d == nil {
+				diags = append(diags, errorAt(m.Pos, m.Name, section,
+					fmt.Errorf("query %s in invalidate list is not cached: ", q)))
 			}
 		}
 	}
 
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	data.Warnings = warnings
+	return data, nil
+}
+
+// loadSQLSrc reads @p src relative to @p path into @p sql, which must be empty, and
+// adds it to sources of @p data. If src is a migration directory, the table @p name
+// is read, which can be omitted if there is only one table.
+func loadSQLSrc(fsys fs.FS, path string, data *NeedleConfig, src string, name string,
+	sql *SQLStmt, sqlPos *diagnostic.Position) error {
+	if strings.TrimSpace(string(*sql)) != "" {
+		return errors.New("both src and sql are set")
+	}
+	src = refPath(path, src)
+	if isDir(fsys, src) {
+		tables, sources, err := replayMigrations(fsys, src)
+		if err != nil {
+			return err
+		}
+		data.Sources = append(data.Sources, sources...)
+		for _, tb := range tables {
+			if tb.Name == name || (name == "" && len(tables) == 1) {
+				*sql = tb.SQL
+				*sqlPos = tb.SQLPos
+				return nil
+			}
+		}
+		if name == "" {
+			return errors.New("name is required to choose a table of migrations")
+		}
+		return fmt.Errorf("table %s is not found in migrations", name)
+	}
+	bytes, err := fs.ReadFile(fsys, src)
+	if err != nil {
+		return err
+	}
+	*sql = SQLStmt(bytes)
+	*sqlPos = diagnostic.Position{File: src, Line: 1, Column: 1}
+	data.Sources = append(data.Sources, Source{Path: src, Hash: sha256.Sum256(bytes)})
+	return nil
+}
+
+// loadErrors returns diagnostics of @p err of loading a src at @p pos, diagnostics
+// found in the src, e.g. of migrations, are kept as they are.
+func loadErrors(pos diagnostic.Position, section string, err error) diagnostic.List {
+	var nested diagnostic.List
+	if errors.As(err, &nested) {
+		return append(diagnostic.List{errorAt(pos, "", section, errors.New("src is invalid"))}, nested...)
+	}
+	return diagnostic.List{errorAt(pos, "", section, err)}
+}
+
+// tableName returns the name of the table created by @p sql, empty if it is not a
+// valid CREATE TABLE statement.
+func tableName(sql SQLStmt) string {
+	stmt, err := sql.Parse()
+	if err != nil {
+		return ""
+	}
+	create, ok := stmt.(*ast.CreateTableStmt)
+	if !ok {
+		return ""
+	}
+	return create.Table.Name.O
+}
+
+// decodeXML decodes an XML config, and locates its elements.
+func decodeXML(path string, bytes []byte) (*NeedleConfig, error) {
+	fileStart := diagnostic.Position{File: path, Line: 1, Column: 1}
+	var data NeedleConfig
+	err := xml.Unmarshal(bytes, &data)
+	if err != nil {
+		pos := fileStart
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			pos.Line = syntaxErr.Line
+		}
+		return nil, diagnostic.List{errorAt(pos, "", "parse XML", err)}
+	}
+	locateElements(path, bytes).apply(&data, fileStart)
 	return &data, nil
 }
 
-func parseConfigFromFileImport(path string, recursiveImport bool) (*NeedleConfig, error) {
-	file, err := os.Open(path)
+// ParseConfigFromFile parses the config at @p path of the OS file system.
+func ParseConfigFromFile(path string) (*NeedleConfig, error) {
+	return ParseConfigFromFS(osFS{}, path)
+}
+
+// ParseConfigFromFS parses the config at @p path of @p fsys, referenced schemas are
+// read from @p fsys as well.
+func ParseConfigFromFS(fsys fs.FS, path string) (*NeedleConfig, error) {
+	bytes, err := fs.ReadFile(fsys, path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	return parseConfig(file, path, recursiveImport)
+	return ParseConfig(bytes, path, fsys)
 }
 
-// ParseConfigFromFile -
-func ParseConfigFromFile(path string) (*NeedleConfig, error) {
-	return parseConfigFromFileImport(path, true)
+// ParseConfig parses the config @p src named @p path. Referenced schemas are read
+// from @p fsys relative to @p path, or from the OS file system if @p fsys is nil.
+func ParseConfig(src []byte, path string, fsys fs.FS) (*NeedleConfig, error) {
+	if fsys == nil {
+		fsys = osFS{}
+	}
+	return parseConfig(newImporter(fsys, path), src, path)
 }
 
 func commaSplitList(str string) []string {
@@ -305,6 +680,12 @@ func startWithUpper(str string) bool {
 	return strings.ToUpper(f) == f
 }
 
-func errorFormatter(file string, section string, err error) error {
-	return fmt.Errorf("Compiling %s, %s, error found: %w", file, section, err)
+func errorAt(pos diagnostic.Position, stmt string, section string, err error) diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityError,
+		Category: diagnostic.CategoryConfig,
+		Pos:      pos,
+		Stmt:     stmt,
+		Message:  fmt.Sprintf("%s, error found: %s", section, err),
+	}
 }
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/suite"
+
+	"github.com/stumble/needle/pkg/diagnostic"
 )
 
 type modelTestSuite struct {
@@ -20,3 +27,473 @@ func (suite *modelTestSuite) TestBasic() {
 	suite.Equal("Orders", config.Schema.Name)
 	suite.Equal("Order", config.Schema.MainObj)
 }
+
+func (suite *modelTestSuite) TestSources() {
+	config, err := ParseConfigFromFile("testdata/orders.xml")
+	suite.Require().NoError(err)
+	suite.Require().Len(config.Sources, 2)
+	suite.Equal("testdata/orders.xml", config.Sources[0].Path)
+	suite.Equal("testdata/customers.xml", config.Sources[1].Path)
+
+	again, err := ParseConfigFromFile("testdata/orders.xml")
+	suite.Require().NoError(err)
+	suite.Equal(config.Digest(), again.Digest())
+
+	customers, err := ParseConfigFromFile("testdata/customers.xml")
+	suite.Require().NoError(err)
+	suite.NotEqual(config.Digest(), customers.Digest())
+}
+
+func (suite *modelTestSuite) TestPositions() {
+	config, err := ParseConfigFromFile("testdata/orders.xml")
+	suite.Require().NoError(err)
+	suite.Equal(diagnostic.Position{File: "testdata/orders.xml", Line: 2, Column: 3},
+		config.Schema.Pos)
+	suite.Equal(diagnostic.Position{File: "testdata/orders.xml", Line: 3, Column: 10},
+		config.Schema.SQLPos)
+	suite.Equal(diagnostic.Position{File: "testdata/orders.xml", Line: 13, Column: 5},
+		config.Schema.Refs[0].Pos)
+	suite.Equal(diagnostic.Position{File: "testdata/customers.xml", Line: 3, Column: 10},
+		config.Schema.Refs[0].SQLPos)
+
+	q := config.Stmts.Queries[0]
+	suite.Equal(16, q.Pos.Line)
+	suite.Equal(diagnostic.Position{File: "testdata/orders.xml", Line: 18, Column: 9},
+		q.SQL.PosOf(q.SQLPos, 0))
+}
+
+func (suite *modelTestSuite) TestDiagnostics() {
+	_, err := ParseConfigFromFile("testdata/invalid.xml")
+	suite.Require().Error(err)
+	var diags diagnostic.List
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 2)
+	suite.Equal(diagnostic.Position{File: "testdata/invalid.xml", Line: 10, Column: 5}, diags[0].Pos)
+	suite.Equal("getOrders", diags[0].Stmt)
+	suite.Equal(diagnostic.Position{File: "testdata/invalid.xml", Line: 15, Column: 5}, diags[1].Pos)
+	suite.Equal("UpdateOrder", diags[1].Stmt)
+}
+
+func (suite *modelTestSuite) TestOutput() {
+	src := []byte(`<needle>
+  <output package="orders" interface="OrderRepo" constructor="OrderRepo"/>
+  <schema name="Orders" mainObj="Order">
+    <sql>CREATE TABLE Orders (ID int);</sql>
+  </schema>
+</needle>`)
+	_, err := ParseConfig(src, "output.xml", nil)
+	var diags diagnostic.List
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	suite.Equal(diagnostic.Position{File: "output.xml", Line: 2, Column: 3}, diags[0].Pos)
+	suite.Contains(diags[0].Message, "OrderRepo is used by more than one")
+
+	src = bytes.Replace(src, []byte(`constructor="OrderRepo"`), []byte(`implStruct="orderRepo"`), 1)
+	config, err := ParseConfig(src, "output.xml", nil)
+	suite.Require().NoError(err)
+	suite.Equal(Output{Package: "orders", Interface: "OrderRepo", ImplStruct: "orderRepo",
+		Pos: diagnostic.Position{File: "output.xml", Line: 2, Column: 3}}, config.Output)
+	suite.Equal("NewOrderRepo", config.Output.Merge(Output{Constructor: "NewOrderRepo"}).Constructor)
+	suite.Equal(NullableSQL, config.Output.Merge(Output{Nullable: NullableSQL}).Nullable)
+
+	src = bytes.Replace(src, []byte(`implStruct="orderRepo"`), []byte(`nullable="optional"`), 1)
+	_, err = ParseConfig(src, "output.xml", nil)
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	suite.Contains(diags[0].Message, "nullable must be one of pointer, sql and generic")
+}
+
+func (suite *modelTestSuite) TestTables() {
+	src := []byte(`<needle>
+  <schema name="Orders" mainObj="Order">
+    <sql>CREATE TABLE Orders (ID int);</sql>
+    <table mainObj="OrderItem" hiddenFields="CreatedAt">
+      <sql>CREATE TABLE OrderItems (ID int, CreatedAt datetime);</sql>
+    </table>
+  </schema>
+  <stmts>
+    <query name="LoadOrderItem" type="many">
+      <sql>SELECT * FROM OrderItems;</sql>
+    </query>
+  </stmts>
+</needle>`)
+	_, err := ParseConfig(src, "tables.xml", nil)
+	var diags diagnostic.List
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	suite.Equal(diagnostic.Position{File: "tables.xml", Line: 9, Column: 5}, diags[0].Pos)
+	suite.Contains(diags[0].Message, "conflicts with Load or Dump of a table")
+
+	src = bytes.Replace(src, []byte(`"LoadOrderItem"`), []byte(`"GetOrderItems"`), 1)
+	config, err := ParseConfig(src, "tables.xml", nil)
+	suite.Require().NoError(err)
+	tables := config.Schema.MainTables()
+	suite.Require().Len(tables, 2)
+	suite.Equal("Order", tables[0].MainObj)
+	suite.Equal("OrderItem", tables[1].MainObj)
+	suite.Equal([]string{"CreatedAt"}, tables[1].HiddenFields())
+	suite.Equal(diagnostic.Position{File: "tables.xml", Line: 4, Column: 5}, tables[1].Pos)
+	suite.Equal(diagnostic.Position{File: "tables.xml", Line: 5, Column: 12}, tables[1].SQLPos)
+
+	src = bytes.Replace(src, []byte(`mainObj="OrderItem"`), []byte(`mainObj="Order"`), 1)
+	_, err = ParseConfig(src, "tables.xml", nil)
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	suite.Contains(diags[0].Message, "duplicated mainObj name: Order")
+}
+
+func (suite *modelTestSuite) TestTransitiveRefs() {
+	conf := func(name string, columns string, refs ...string) *fstest.MapFile {
+		src := fmt.Sprintf("<needle><schema name=\"%s\" mainObj=\"%sObj\">"+
+			"<sql>CREATE TABLE %s (%s);</sql>", name, name, name, columns)
+		for _, ref := range refs {
+			src += fmt.Sprintf("<ref src=\"%s\"/>", ref)
+		}
+		return &fstest.MapFile{Data: []byte(src + "</schema></needle>")}
+	}
+	fsys := fstest.MapFS{
+		"users.xml":  conf("Users", "ID int"),
+		"orders.xml": conf("Orders", "ID int, UserID int", "users.xml"),
+		"items.xml":  conf("Items", "ID int, OrderID int", "orders.xml", "users.xml"),
+	}
+	config, err := ParseConfigFromFS(fsys, "items.xml")
+	suite.Require().NoError(err)
+	var names []string
+	for _, ref := range config.Schema.Refs {
+		for _, tb := range ref.Tables {
+			names = append(names, tb.Name)
+		}
+	}
+	suite.Equal([]string{"Orders", "Users"}, names)
+	suite.Equal("users.xml", config.Schema.Refs[0].Tables[1].Path)
+	suite.Require().Len(config.Sources, 3)
+
+	fsys["users.xml"] = conf("Users", "ID int", "items.xml")
+	_, err = ParseConfigFromFS(fsys, "items.xml")
+	suite.ErrorContains(err, "reference cycle: items.xml -> orders.xml -> users.xml -> items.xml")
+
+	fsys["users.xml"] = conf("Users", "ID int")
+	fsys["orders.xml"] = conf("Orders", "ID int, UserID int", "customers.xml")
+	fsys["customers.xml"] = conf("Users", "ID bigint")
+	_, err = ParseConfigFromFS(fsys, "items.xml")
+	var diags diagnostic.List
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	column := strings.Index(string(fsys["items.xml"].Data), `<ref src="users.xml"`) + 1
+	suite.Equal(diagnostic.Position{File: "items.xml", Line: 1, Column: column}, diags[0].Pos)
+	suite.Contains(diags[0].Message, "table Users of users.xml conflicts with the one of customers.xml")
+}
+
+func (suite *modelTestSuite) TestDDLRefs() {
+	src := []byte(`<needle>
+  <schema name="Orders" mainObj="Order">
+    <sql>CREATE TABLE Orders (ID int, ProductID bigint);</sql>
+    <ref src="shop_dump.sql"/>
+  </schema>
+</needle>`)
+	config, err := ParseConfig(src, "testdata/ddl.xml", nil)
+	suite.Require().NoError(err)
+	tables := config.Schema.Refs[0].Tables
+	suite.Require().Len(tables, 2)
+	suite.Equal("Products", tables[0].Name)
+	suite.Equal("Stocks", tables[1].Name)
+	suite.Equal(diagnostic.Position{File: "testdata/shop_dump.sql", Line: 29, Column: 1},
+		tables[1].SQL.PosOf(tables[1].SQLPos, 0))
+	_, err = tables[1].SQL.Parse()
+	suite.NoError(err)
+	suite.Equal("testdata/shop_dump.sql", config.Sources[1].Path)
+
+	// annotated SQL is still a config.
+	src = bytes.Replace(src, []byte("shop_dump.sql"), []byte("musics.sql"), 1)
+	config, err = ParseConfig(src, "testdata/ddl.xml", nil)
+	suite.Require().NoError(err)
+	suite.Equal("Musics", config.Schema.Refs[0].Tables[0].Name)
+}
+
+func (suite *modelTestSuite) TestMigrations() {
+	src := []byte(`<needle>
+  <schema name="Orders" mainObj="Order" src="migrations">
+    <ref src="migrations"/>
+  </schema>
+</needle>`)
+	config, err := ParseConfig(src, "testdata/migrate.xml", nil)
+	suite.Require().NoError(err)
+	suite.Equal("CREATE TABLE Orders (ID BIGINT NOT NULL AUTO_INCREMENT,UserID BIGINT NOT NULL,"+
+		"Status INT NOT NULL DEFAULT 0,Amount BIGINT NOT NULL,PRIMARY KEY(ID),INDEX idx_user(UserID))",
+		string(config.Schema.SQL))
+	suite.Equal(diagnostic.Position{File: "testdata/migrations/002_create_orders.sql", Line: 1, Column: 1},
+		config.Schema.SQLPos)
+	suite.Require().Len(config.Sources, 5)
+	suite.Equal("testdata/migrations", config.Sources[1].Path)
+	suite.Equal("testdata/migrations/003_alter_orders.sql", config.Sources[4].Path)
+
+	// Orders is the schema, only Users is left for the reference.
+	tables := config.Schema.Refs[0].Tables
+	suite.Require().Len(tables, 1)
+	suite.Equal("Users", tables[0].Name)
+	suite.Contains(string(tables[0].SQL), "Nickname VARCHAR(64) NOT NULL")
+
+	src = bytes.Replace(src, []byte(`name="Orders"`), []byte(`name="Coupons"`), 1)
+	_, err = ParseConfig(src, "testdata/migrate.xml", nil)
+	suite.ErrorContains(err, "table Coupons is not found in migrations")
+}
+
+func (suite *modelTestSuite) TestYAML() {
+	config, err := ParseConfigFromFile("testdata/orders.yaml")
+	suite.Require().NoError(err)
+	suite.Equal("Orders", config.Schema.Name)
+	suite.Equal("Order", config.Schema.MainObj)
+	suite.Equal([]string{"CreatedAt"}, config.Schema.HiddenFields())
+	suite.Require().Len(config.Sources, 2)
+	suite.Equal("testdata/customers.xml", config.Sources[1].Path)
+	suite.Contains(string(config.Schema.Refs[0].SQL), "CREATE TABLE Customers")
+
+	suite.Require().Len(config.Stmts.Queries, 2)
+	suite.Equal("10s", config.Stmts.Queries[0].CacheDurationStr)
+	suite.Contains(string(config.Stmts.Queries[1].SQL), "OrderAmount <= 100")
+	suite.Equal([]string{"GetOrdersByCustomerID", "GetBigOrders"},
+		config.Stmts.Mutations[0].InvalidateQueries())
+
+	pos := func(line, column int) diagnostic.Position {
+		return diagnostic.Position{File: "testdata/orders.yaml", Line: line, Column: column}
+	}
+	suite.Equal(pos(1, 1), config.Schema.Pos)
+	block := func(line, column int) diagnostic.Position {
+		rst := pos(line, column)
+		rst.Indent = column - 1
+		return rst
+	}
+	suite.Equal(block(6, 5), config.Schema.SQLPos)
+	suite.Equal(pos(15, 7), config.Schema.Refs[0].Pos)
+	suite.Equal(pos(18, 7), config.Stmts.Queries[0].Pos)
+	suite.Equal(block(22, 9), config.Stmts.Queries[0].SQLPos)
+	// lines of a block scalar are indented, e.g. the ? on its 6th line.
+	q := config.Stmts.Queries[0]
+	offset := strings.Index(string(q.SQL), "?")
+	marker := q.SQLMap.PosOf(q.SQL, q.SQLPos, offset)
+	suite.Equal(27, marker.Line)
+	suite.Equal(33, marker.Column)
+	suite.Equal(pos(31, 12), config.Stmts.Queries[1].SQLPos)
+	suite.Equal(pos(33, 7), config.Stmts.Mutations[0].Pos)
+}
+
+func (suite *modelTestSuite) TestYAMLDiagnostics() {
+	_, err := ParseConfig([]byte("schema:\n  name: Orders\n  mainobj: Order\n"), "bad.yml", nil)
+	var diags diagnostic.List
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	suite.Equal(3, diags[0].Pos.Line)
+	suite.Contains(diags[0].Message, "field mainobj not found")
+
+	src := "schema:\n  name: Orders\n  mainObj: Order\n  sql: CREATE TABLE Orders (ID int);\n" +
+		"stmts:\n  mutations:\n    - name: Delete\n      invalidate: GetOrders\n" +
+		"      sql: DELETE FROM Orders;\n"
+	_, err = ParseConfig([]byte(src), "bad.yml", nil)
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	suite.Equal(diagnostic.Position{File: "bad.yml", Line: 7, Column: 7}, diags[0].Pos)
+	suite.Contains(diags[0].Message, "failed to find the query GetOrders")
+}
+
+func (suite *modelTestSuite) TestCacheDuration() {
+	src := "<needle>\n  <schema name=\"Orders\" mainObj=\"Order\">\n" +
+		"    <sql>CREATE TABLE Orders (ID int);</sql>\n  </schema>\n  <stmts>\n" +
+		"    <query name=\"GetOrders\" type=\"many\"\n      cacheDuration=\"-1s\">\n" +
+		"      <sql>SELECT * FROM Orders;</sql>\n    </query>\n  </stmts>\n</needle>\n"
+	_, err := ParseConfig([]byte(src), "bad.xml", nil)
+	var diags diagnostic.List
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	suite.Equal(diagnostic.Position{File: "bad.xml", Line: 7, Column: 7}, diags[0].Pos)
+	suite.Equal("GetOrders", diags[0].Stmt)
+	suite.Contains(diags[0].Message, "cache-duration <= 0s is invalid")
+
+	src = "schema:\n  name: Orders\n  mainObj: Order\n  sql: CREATE TABLE Orders (ID int);\n" +
+		"stmts:\n  queries:\n    - name: GetOrders\n      type: many\n" +
+		"      cacheDuration: 5 minutes\n      sql: SELECT * FROM Orders;\n"
+	_, err = ParseConfig([]byte(src), "bad.yml", nil)
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 1)
+	suite.Equal(diagnostic.Position{File: "bad.yml", Line: 9, Column: 22}, diags[0].Pos)
+	suite.Contains(diags[0].Message, "unknown unit")
+
+	q := Query{CacheDurationStr: "forever"}
+	d, err := q.CacheDuration()
+	suite.Require().NoError(err)
+	suite.Equal(time.Duration(0), *d)
+	q.CacheDurationStr = ""
+	d, err = q.CacheDuration()
+	suite.Require().NoError(err)
+	suite.Nil(d)
+}
+
+func (suite *modelTestSuite) TestAnnotatedSQL() {
+	config, err := ParseConfigFromFile("testdata/musics.sql")
+	suite.Require().NoError(err)
+	suite.Equal("Musics", config.Schema.Name)
+	suite.Equal("Music", config.Schema.MainObj)
+	suite.Equal([]string{"CreatedAt"}, config.Schema.HiddenFields())
+	suite.Contains(string(config.Schema.SQL), "CREATE TABLE Musics")
+	suite.Equal(diagnostic.Position{File: "testdata/musics_schema.sql", Line: 1, Column: 1},
+		config.Schema.SQLPos)
+	suite.Require().Len(config.Sources, 3)
+	suite.Equal("testdata/musics_schema.sql", config.Sources[1].Path)
+	suite.Equal("testdata/customers.xml", config.Sources[2].Path)
+
+	suite.Require().Len(config.Stmts.Queries, 2)
+	q := config.Stmts.Queries[1]
+	suite.Equal("GetMusicByAuthorAndName", q.Name)
+	suite.True(q.IsSingleRow())
+	suite.Equal("5m", q.CacheDurationStr)
+	suite.Equal(diagnostic.Position{File: "testdata/musics.sql", Line: 7, Column: 1}, q.Pos)
+	suite.Equal(diagnostic.Position{File: "testdata/musics.sql", Line: 10, Column: 7},
+		q.SQL.PosOf(q.SQLPos, strings.Index(string(q.SQL), "Author")))
+	_, err = q.SQL.Parse()
+	suite.NoError(err)
+
+	suite.Require().Len(config.Stmts.Mutations, 1)
+	suite.Equal([]string{"GetMusics", "GetMusicByAuthorAndName"},
+		config.Stmts.Mutations[0].InvalidateQueries())
+}
+
+func (suite *modelTestSuite) TestAnnotatedSQLDiagnostics() {
+	src := "-- schema: musics_schema.sql mainObj=Music\nSELECT 1;\n" +
+		"-- name: GetMusics :many invalidate=GetMusics\nSELECT * FROM Musics;\n"
+	_, err := ParseConfig([]byte(src), "testdata/bad.sql", nil)
+	var diags diagnostic.List
+	suite.Require().ErrorAs(err, &diags)
+	suite.Require().Len(diags, 2)
+	suite.Equal(2, diags[0].Pos.Line)
+	suite.Contains(diags[0].Message, "statement without a name annotation")
+	suite.Equal(3, diags[1].Pos.Line)
+	suite.Contains(diags[1].Message, "unknown option invalidate=GetMusics")
+}
+
+func (suite *modelTestSuite) TestFragments() {
+	fsys := fstest.MapFS{
+		"common.xml": &fstest.MapFile{Data: []byte(`<fragments>
+  <fragment name="Visible">Deleted = 0 AND ${Tenant}</fragment>
+  <fragment name="Tenant">TenantID = ?</fragment>
+</fragments>`)},
+		"common.yaml": &fstest.MapFile{Data: []byte(`fragments:
+  - name: Paid
+    sql: Status = 'paid'
+`)},
+		"orders.xml": &fstest.MapFile{Data: []byte(`<needle>
+  <schema name="Orders" mainObj="Order">
+    <sql>CREATE TABLE Orders (ID INT, TenantID INT, Status VARCHAR(16), Deleted BOOL);</sql>
+    <ref src="common.xml"/>
+    <ref src="common.yaml"/>
+  </schema>
+  <fragment name="Recent">ORDER BY ID DESC LIMIT 10</fragment>
+  <stmts>
+    <query name="GetOrders" type="many">
+      <sql>SELECT * FROM Orders WHERE ${Visible} AND ${ Paid } ${Recent};</sql>
+    </query>
+  </stmts>
+</needle>`)},
+	}
+	config, err := ParseConfigFromFS(fsys, "orders.xml")
+	suite.Require().NoError(err)
+	q := config.Stmts.Queries[0]
+	suite.Equal(SQLStmt("SELECT * FROM Orders WHERE Deleted = 0 AND TenantID = ? AND Status = 'paid' "+
+		"ORDER BY ID DESC LIMIT 10;"), q.SQL)
+	suite.Len(config.Sources, 3)
+
+	// positions map back to fragments.
+	suite.Equal(diagnostic.Position{File: "orders.xml", Line: 10, Column: 12}, q.SQLMap.PosOf(q.SQL, q.SQLPos, 0))
+	offset := strings.Index(string(q.SQL), "?")
+	suite.Equal(diagnostic.Position{File: "common.xml", Line: 3, Column: 38}, q.SQLMap.PosOf(q.SQL, q.SQLPos, offset))
+	offset = strings.Index(string(q.SQL), "'paid'")
+	suite.Equal(diagnostic.Position{File: "common.yaml", Line: 3, Column: 19}, q.SQLMap.PosOf(q.SQL, q.SQLPos, offset))
+	offset = strings.Index(string(q.SQL), "LIMIT")
+	suite.Equal(diagnostic.Position{File: "orders.xml", Line: 7, Column: 44}, q.SQLMap.PosOf(q.SQL, q.SQLPos, offset))
+	offset = strings.Index(string(q.SQL), ";")
+	suite.Equal(diagnostic.Position{File: "orders.xml", Line: 10, Column: 73}, q.SQLMap.PosOf(q.SQL, q.SQLPos, offset))
+
+	errorOf := func(err error) diagnostic.Diagnostic {
+		var diags diagnostic.List
+		suite.Require().ErrorAs(err, &diags)
+		suite.Require().Len(diags, 1)
+		return diags[0]
+	}
+	fsys["common.xml"] = &fstest.MapFile{Data: []byte(`<fragments>
+  <fragment name="Visible">Deleted = 0 AND ${Tenant}</fragment>
+  <fragment name="Tenant">${Visible}</fragment>
+</fragments>`)}
+	_, err = ParseConfigFromFS(fsys, "orders.xml")
+	diag := errorOf(err)
+	suite.Equal("GetOrders", diag.Stmt)
+	suite.Equal(diagnostic.Position{File: "common.xml", Line: 3, Column: 27}, diag.Pos)
+	suite.Contains(diag.Message, "fragment cycle: Visible -> Tenant -> Visible")
+
+	fsys["common.xml"] = &fstest.MapFile{Data: []byte(`<fragments>
+  <fragment name="Visible">Deleted = 0</fragment>
+  <fragment name="Recent">ORDER BY ID</fragment>
+</fragments>`)}
+	diag = errorOf(func() error { _, err := ParseConfigFromFS(fsys, "orders.xml"); return err }())
+	suite.Equal(diagnostic.Position{File: "orders.xml", Line: 4, Column: 5}, diag.Pos)
+	suite.Contains(diag.Message, "fragment Recent of common.xml conflicts with the one of orders.xml")
+
+	fsys["common.xml"] = &fstest.MapFile{Data: []byte(`<fragments/>`)}
+	diag = errorOf(func() error { _, err := ParseConfigFromFS(fsys, "orders.xml"); return err }())
+	suite.Equal(diagnostic.Position{File: "orders.xml", Line: 10, Column: 39}, diag.Pos)
+	suite.Contains(diag.Message, "expand fragment Visible, error found: unknown fragment")
+}
+
+func (suite *modelTestSuite) TestTypes() {
+	src := `<needle>
+  <schema name="Orders" mainObj="Order">
+    <sql>CREATE TABLE Orders (ID CHAR(36) NOT NULL, Amount DECIMAL(10, 2));</sql>
+  </schema>
+  <types>
+    <type column="Orders.ID" go="github.com/google/uuid.UUID"/>
+    <type sqlType="DECIMAL" go="github.com/shopspring/decimal.Decimal"/>
+    <type sqlType="BLOB" go="[]byte"/>
+  </types>
+  <stmts/>
+</needle>`
+	config, err := ParseConfig([]byte(src), "orders.xml", nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(config.Types, 3)
+	suite.Equal("Orders.ID", config.Types[0].Column)
+	suite.Equal(diagnostic.Position{File: "orders.xml", Line: 6, Column: 5}, config.Types[0].Pos)
+	pkg, name := config.Types[1].GoType()
+	suite.Equal("github.com/shopspring/decimal", pkg)
+	suite.Equal("Decimal", name)
+	pkg, name = config.Types[2].GoType()
+	suite.Equal("", pkg)
+	suite.Equal("[]byte", name)
+
+	pkg, name = TypeMapping{JSON: "github.com/acme/order.Meta"}.GoType()
+	suite.Equal("github.com/acme/order", pkg)
+	suite.Equal("Meta", name)
+
+	sqlSrc := "-- schema: musics_schema.sql mainObj=Music\n" +
+		"-- type: column=Musics.ID go=github.com/google/uuid.UUID\n" +
+		"-- name: GetMusics :many\nSELECT * FROM Musics;\n"
+	config, err = ParseConfig([]byte(sqlSrc), "testdata/types.sql", nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(config.Types, 1)
+	suite.Equal("github.com/google/uuid.UUID", config.Types[0].Go)
+	suite.Equal(2, config.Types[0].Pos.Line)
+
+	for _, c := range []struct {
+		mapping string
+		message string
+	}{
+		{`<type column="Orders.ID" sqlType="CHAR" go="string"/>`, "exactly one of column and sqlType"},
+		{`<type column="ID" go="string"/>`, "column must be Table.Column"},
+		{`<type sqlType="CHAR" go="github.com/google/uuid."/>`, "go and json must be an import path"},
+		{`<type sqlType="JSON" go="string" json="string"/>`, "exactly one of go and json"},
+		{`<type sqlType="CHAR" go="a"/><type sqlType="char" go="b"/>`, "duplicated type mapping"},
+	} {
+		_, err := ParseConfig([]byte(strings.Replace(src,
+			`<type sqlType="BLOB" go="[]byte"/>`, c.mapping, 1)), "orders.xml", nil)
+		var diags diagnostic.List
+		suite.Require().ErrorAs(err, &diags, c.mapping)
+		suite.Require().Len(diags, 1, c.mapping)
+		suite.Contains(diags[0].Message, c.message)
+		suite.Equal(8, diags[0].Pos.Line)
+	}
+}
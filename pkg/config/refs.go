@@ -0,0 +1,213 @@
+package config
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/pingcap/tidb/parser/ast"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/parser"
+	"github.com/stumble/needle/pkg/utils"
+)
+
+// RefTable is a table imported by a reference, either the schema of the referenced
+// config, or one that it imports in turn.
+type RefTable struct {
+	Name   string
+	SQL    SQLStmt
+	SQLPos diagnostic.Position
+	// Path of the config that defines it.
+	Path string
+}
+
+// importer imports referenced configs transitively. Each config is parsed once, no
+// matter how many configs reference it.
+type importer struct {
+	fsys fs.FS
+	// stack of configs being parsed, the last one references the next to import.
+	stack  []string
+	parsed map[string]imported
+}
+
+// imported is what a reference to a config, a DDL file or a fragment library brings in.
+type imported struct {
+	tables    []RefTable
+	fragments []Fragment
+	sources   []Source
+	err       error
+	// reported is true once diagnostics of the config were returned to a referrer.
+	reported bool
+}
+
+func newImporter(fsys fs.FS, path string) *importer {
+	return &importer{fsys: fsys, stack: []string{path}, parsed: make(map[string]imported)}
+}
+
+// importConfig parses the config or the DDL file at @p path, and configs it references.
+// The nested diagnostic.List is returned only to the first referrer, so that it is
+// reported once.
+func (imp *importer) importConfig(path string) (imported, diagnostic.List, error) {
+	for i, p := range imp.stack {
+		if p == path {
+			cycle := append(append([]string{}, imp.stack[i:]...), path)
+			return imported{}, nil, fmt.Errorf("reference cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	rst, ok := imp.parsed[path]
+	if !ok {
+		imp.stack = append(imp.stack, path)
+		rst = imp.parse(path)
+		imp.stack = imp.stack[:len(imp.stack)-1]
+	}
+	var nested diagnostic.List
+	if rst.err != nil && errors.As(rst.err, &nested) {
+		rst.err = errors.New("referenced config is invalid")
+		if rst.reported {
+			nested = nil
+		}
+		rst.reported = true
+	}
+	imp.parsed[path] = rst
+	return rst, nested, rst.err
+}
+
+// parse the file at @p path, a .sql file without annotations is plain DDL, and a
+// directory is of migrations. Fragment libraries bring in fragments only.
+func (imp *importer) parse(path string) imported {
+	if isDir(imp.fsys, path) {
+		tables, sources, err := replayMigrations(imp.fsys, path)
+		return imported{tables: tables, sources: sources, err: err}
+	}
+	bytes, err := fs.ReadFile(imp.fsys, path)
+	if err != nil {
+		return imported{err: err}
+	}
+	sources := []Source{{Path: path, Hash: sha256.Sum256(bytes)}}
+	if isSQL(path) && !IsAnnotatedSQL(bytes) {
+		tables, err := ddlTables(path, bytes)
+		return imported{tables: tables, sources: sources, err: err}
+	}
+	if isFragmentLibrary(path, bytes) {
+		fragments, err := decodeFragmentLibrary(path, bytes)
+		return imported{fragments: fragments, sources: sources, err: err}
+	}
+	config, err := parseConfig(imp, bytes, path)
+	if err != nil {
+		return imported{err: err}
+	}
+	return imported{tables: config.refTables(path), fragments: config.Fragments,
+		sources: config.Sources}
+}
+
+// ddlTables returns tables created by CREATE TABLE statements of the DDL file @p src,
+// e.g. an output of mysqldump --no-data. Other statements are ignored.
+func ddlTables(path string, src []byte) ([]RefTable, error) {
+	start := diagnostic.Position{File: path, Line: 1, Column: 1}
+	stmts, offsets, err := SQLStmt(src).ParseAll()
+	if err != nil {
+		offset, _ := parser.ErrorOffset(string(src), err)
+		return nil, diagnostic.List{errorAt(start.Advance(string(src), offset), "",
+			"parse DDL", err)}
+	}
+	rst := make([]RefTable, 0)
+	for i, stmt := range stmts {
+		create, ok := stmt.(*ast.CreateTableStmt)
+		if !ok {
+			continue
+		}
+		rst = append(rst, RefTable{
+			Name:   create.Table.Name.O,
+			SQL:    SQLStmt(create.Text()),
+			SQLPos: start.Advance(string(src), offsets[i]),
+			Path:   path,
+		})
+	}
+	if len(rst) == 0 {
+		return nil, errors.New("no CREATE TABLE statement found")
+	}
+	return rst, nil
+}
+
+// importRefs imports referenced configs of @p data at @p path. Tables are de-duplicated
+// by name: a table that is defined again the same way is dropped, and one that is
+// defined differently is an error at the reference that brings it in. So are fragments.
+func (imp *importer) importRefs(path string, data *NeedleConfig) diagnostic.List {
+	var diags diagnostic.List
+	seen := make(map[string]RefTable)
+	for _, tb := range data.Schema.MainTables() {
+		if name := tableName(tb.SQL); name != "" {
+			seen[name] = RefTable{Name: name, SQL: tb.SQL, SQLPos: tb.SQLPos, Path: path}
+		}
+	}
+	sources := make(map[string]bool)
+	for _, src := range data.Sources {
+		sources[src.Path] = true
+	}
+
+	for i, ref := range data.Schema.Refs {
+		src := refPath(path, ref.Src)
+		refImport, nested, err := imp.importConfig(src)
+		if err != nil {
+			diags = append(diags, errorAt(ref.Pos, "", "import referenced schema: "+src, err))
+			diags = append(diags, nested...)
+			continue
+		}
+		diags = append(diags, importFragments(data, ref, refImport.fragments)...)
+		data.Schema.Refs[i].Tables = nil
+		if len(refImport.tables) > 0 {
+			data.Schema.Refs[i].SQL = refImport.tables[0].SQL
+			data.Schema.Refs[i].SQLPos = refImport.tables[0].SQLPos
+		}
+		for _, tb := range refImport.tables {
+			prev, dup := seen[tb.Name]
+			if !dup || tb.Name == "" {
+				seen[tb.Name] = tb
+				data.Schema.Refs[i].Tables = append(data.Schema.Refs[i].Tables, tb)
+				continue
+			}
+			if tableDefinition(prev.SQL) != tableDefinition(tb.SQL) {
+				diags = append(diags, errorAt(ref.Pos, "", "import referenced schema: "+src,
+					fmt.Errorf("table %s of %s conflicts with the one of %s",
+						tb.Name, tb.Path, prev.Path)))
+			}
+		}
+		for _, source := range refImport.sources {
+			if !sources[source.Path] {
+				sources[source.Path] = true
+				data.Sources = append(data.Sources, source)
+			}
+		}
+	}
+	return diags
+}
+
+// refTables returns tables that a reference to this config at @p path imports, its
+// main tables first.
+func (n *NeedleConfig) refTables(path string) []RefTable {
+	rst := make([]RefTable, 0)
+	for _, tb := range n.Schema.MainTables() {
+		rst = append(rst, RefTable{Name: tableName(tb.SQL), SQL: tb.SQL, SQLPos: tb.SQLPos, Path: path})
+	}
+	for _, ref := range n.Schema.Refs {
+		rst = append(rst, ref.Tables...)
+	}
+	return rst
+}
+
+// tableDefinition returns @p sql in the canonical form, so that tables defined in
+// different styles can be compared.
+func tableDefinition(sql SQLStmt) string {
+	stmt, err := sql.Parse()
+	if err != nil {
+		return string(sql)
+	}
+	create, ok := stmt.(*ast.CreateTableStmt)
+	if !ok {
+		return string(sql)
+	}
+	return utils.RestoreNode(create)
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+// Kinds of statements in annotated SQL configs.
+const (
+	sqlKindSingle   = ":" + single
+	sqlKindMany     = ":" + many
+	sqlKindMutation = ":mutation"
+	sqlKindFragment = "fragment"
+)
+
+// sqlAnnotationRegexp matches annotations of annotated SQL configs, e.g.
+//
+//	-- schema: musics.sql mainObj=Music
+//	-- table: albums.sql mainObj=Album
+//	-- ref: users.xml
+//	-- output: package=music
+//	-- name: GetMusicByAuthorAndName :single cache=5m
+//	-- name: InsertMusic :mutation invalidate=GetMusics
+//	-- fragment: Visible
+//	-- type: column=Musics.ID go=github.com/google/uuid.UUID
+var sqlAnnotationRegexp = regexp.MustCompile(`^--\s*(schema|table|ref|output|name|fragment|type):\s*(.*?)\s*$`)
+
+// isSQL returns true if @p path is an annotated SQL config, judged by its extension.
+func isSQL(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".sql"
+}
+
+// IsAnnotatedSQL returns true if @p src has annotations of an annotated SQL config,
+// rather than a plain SQL file like a schema.
+func IsAnnotatedSQL(src []byte) bool {
+	for _, line := range strings.Split(string(src), "\n") {
+		if sqlAnnotationRegexp.MatchString(strings.TrimSpace(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlStmt is a statement being decoded from an annotated SQL config.
+type sqlStmt struct {
+	name string
+	kind string
+	opts map[string]string
+	pos  diagnostic.Position
+	sql  strings.Builder
+}
+
+// decodeSQL decodes an annotated SQL config. Statements and fragments start with a name
+// or a fragment annotation and end at the next one, the schema is a CREATE TABLE in the file of the schema
+// annotation.
+func decodeSQL(path string, src []byte) (*NeedleConfig, error) {
+	var data NeedleConfig
+	var diags diagnostic.List
+	var stmts []*sqlStmt
+	for i, line := range strings.SplitAfter(string(src), "\n") {
+		pos := diagnostic.Position{File: path, Line: i + 1, Column: 1}
+		m := sqlAnnotationRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			if len(stmts) > 0 {
+				stmts[len(stmts)-1].sql.WriteString(line)
+			} else if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				diags = append(diags, errorAt(pos, "", "parse SQL config",
+					fmt.Errorf("statement without a name annotation: %s", trimmed)))
+			}
+			continue
+		}
+
+		fields := strings.Fields(m[2])
+		if len(fields) == 0 {
+			diags = append(diags, errorAt(pos, "", "parse SQL config",
+				fmt.Errorf("empty %s annotation", m[1])))
+			continue
+		}
+		switch m[1] {
+		case "schema":
+			data.Schema.Src = fields[0]
+			data.Schema.Pos = pos
+			err := setSQLOptions(fields[1:], map[string]*string{
+				"name":         &data.Schema.Name,
+				"mainObj":      &data.Schema.MainObj,
+				"hiddenFields": &data.Schema.HiddenFieldsStr,
+			})
+			if err != nil {
+				diags = append(diags, errorAt(pos, "", "parse schema annotation", err))
+			}
+		case "table":
+			tb := Table{Src: fields[0], Pos: pos}
+			err := setSQLOptions(fields[1:], map[string]*string{
+				"name":         &tb.Name,
+				"mainObj":      &tb.MainObj,
+				"hiddenFields": &tb.HiddenFieldsStr,
+			})
+			if err != nil {
+				diags = append(diags, errorAt(pos, "", "parse table annotation", err))
+			}
+			data.Schema.Tables = append(data.Schema.Tables, tb)
+		case "ref":
+			data.Schema.Refs = append(data.Schema.Refs, Reference{Src: fields[0], Pos: pos})
+		case "output":
+			data.Output.Pos = pos
+			err := setSQLOptions(fields, map[string]*string{
+				"package":     &data.Output.Package,
+				"interface":   &data.Output.Interface,
+				"constructor": &data.Output.Constructor,
+				"implStruct":  &data.Output.ImplStruct,
+				"nullable":    &data.Output.Nullable,
+			})
+			if err != nil {
+				diags = append(diags, errorAt(pos, "", "parse output annotation", err))
+			}
+		case "type":
+			t := TypeMapping{Pos: pos}
+			err := setSQLOptions(fields, map[string]*string{
+				"column":  &t.Column,
+				"sqlType": &t.SQLType,
+				"go":      &t.Go,
+				"json":    &t.JSON,
+			})
+			if err != nil {
+				diags = append(diags, errorAt(pos, "", "parse type annotation", err))
+			}
+			data.Types = append(data.Types, t)
+		case "fragment":
+			stmts = append(stmts, &sqlStmt{name: fields[0], kind: sqlKindFragment, pos: pos})
+			if len(fields) > 1 {
+				diags = append(diags, errorAt(pos, "", "parse fragment annotation",
+					fmt.Errorf("unknown option %s", fields[1])))
+			}
+		case "name":
+			stmt := &sqlStmt{name: fields[0], pos: pos, opts: make(map[string]string)}
+			stmts = append(stmts, stmt)
+			if len(fields) < 2 {
+				diags = append(diags, errorAt(pos, stmt.name, "parse name annotation",
+					fmt.Errorf("missing kind, one of %s, %s and %s",
+						sqlKindSingle, sqlKindMany, sqlKindMutation)))
+				continue
+			}
+			stmt.kind = fields[1]
+			allowed := map[string]*string{}
+			switch stmt.kind {
+			case sqlKindSingle, sqlKindMany:
+				allowed["cache"] = new(string)
+			case sqlKindMutation:
+				allowed["invalidate"] = new(string)
+			default:
+				diags = append(diags, errorAt(pos, stmt.name, "parse name annotation",
+					fmt.Errorf("unknown kind %s", stmt.kind)))
+				continue
+			}
+			if err := setSQLOptions(fields[2:], allowed); err != nil {
+				diags = append(diags, errorAt(pos, stmt.name, "parse name annotation", err))
+			}
+			for k, v := range allowed {
+				stmt.opts[k] = *v
+			}
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	for _, stmt := range stmts {
+		sqlPos := diagnostic.Position{File: path, Line: stmt.pos.Line + 1, Column: 1}
+		if stmt.kind == sqlKindFragment {
+			data.Fragments = append(data.Fragments, Fragment{
+				Name:   stmt.name,
+				SQL:    SQLStmt(stmt.sql.String()),
+				Pos:    stmt.pos,
+				SQLPos: sqlPos,
+			})
+			continue
+		}
+		if stmt.kind == sqlKindMutation {
+			data.Stmts.Mutations = append(data.Stmts.Mutations, Mutation{
+				Name:          stmt.name,
+				InvalidateStr: stmt.opts["invalidate"],
+				SQL:           SQLStmt(stmt.sql.String()),
+				Pos:           stmt.pos,
+				SQLPos:        sqlPos,
+			})
+			continue
+		}
+		data.Stmts.Queries = append(data.Stmts.Queries, Query{
+			Name:             stmt.name,
+			Type:             strings.TrimPrefix(stmt.kind, ":"),
+			CacheDurationStr: stmt.opts["cache"],
+			SQL:              SQLStmt(stmt.sql.String()),
+			Pos:              stmt.pos,
+			SQLPos:           sqlPos,
+			CacheDurationPos: stmt.pos,
+		})
+	}
+	if data.Schema.Src == "" {
+		return nil, diagnostic.List{errorAt(diagnostic.Position{File: path, Line: 1, Column: 1},
+			"", "parse SQL config", errors.New("missing schema annotation"))}
+	}
+	return &data, nil
+}
+
+// setSQLOptions sets @p options of key=value form to their targets in @p allowed.
+func setSQLOptions(options []string, allowed map[string]*string) error {
+	for _, opt := range options {
+		kv := strings.SplitN(opt, "=", 2)
+		target, ok := allowed[kv[0]]
+		if len(kv) != 2 || !ok {
+			return fmt.Errorf("unknown option %s", opt)
+		}
+		*target = kv[1]
+	}
+	return nil
+}
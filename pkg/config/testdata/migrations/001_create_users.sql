@@ -0,0 +1,5 @@
+CREATE TABLE Users (
+  ID BIGINT NOT NULL AUTO_INCREMENT,
+  Name VARCHAR(64) NOT NULL,
+  PRIMARY KEY (ID)
+);
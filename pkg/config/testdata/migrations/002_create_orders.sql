@@ -0,0 +1,9 @@
+CREATE TABLE Orders (
+  ID BIGINT NOT NULL AUTO_INCREMENT,
+  UserID BIGINT NOT NULL,
+  Amount INT NOT NULL,
+  PRIMARY KEY (ID)
+);
+CREATE TABLE Coupons (
+  ID BIGINT NOT NULL
+);
@@ -0,0 +1,5 @@
+ALTER TABLE Orders ADD COLUMN Status INT NOT NULL DEFAULT 0 AFTER UserID;
+ALTER TABLE Orders MODIFY COLUMN Amount BIGINT NOT NULL;
+ALTER TABLE Orders ADD INDEX idx_user (UserID);
+ALTER TABLE Users RENAME COLUMN Name TO Nickname;
+DROP TABLE Coupons;
@@ -0,0 +1,13 @@
+-- schema: musics_schema.sql mainObj=Music hiddenFields=CreatedAt
+-- ref: customers.xml
+
+-- name: GetMusics :many cache=5m
+SELECT * FROM Musics;
+
+-- name: GetMusicByAuthorAndName :single cache=5m
+-- comments are kept in the statement.
+SELECT * FROM Musics
+WHERE Author = ? AND Name = ?;
+
+-- name: InsertMusic :mutation invalidate=GetMusics,GetMusicByAuthorAndName
+INSERT INTO Musics (Name, Author) VALUES (?, ?);
@@ -0,0 +1,7 @@
+CREATE TABLE Musics (
+  ID INT NOT NULL AUTO_INCREMENT,
+  Name VARCHAR(255) NOT NULL,
+  Author VARCHAR(255) NOT NULL,
+  CreatedAt DATETIME NOT NULL,
+  PRIMARY KEY (ID)
+);
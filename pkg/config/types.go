@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"strings"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+// TypeMapping maps a column, or columns and expressions of a SQL type, to a user Go
+// type instead of the one derived from the SQL type. The type must be scannable from,
+// and usable as an argument of, database/sql, e.g. implements sql.Scanner and
+// driver.Valuer.
+type TypeMapping struct {
+	// Column is Table.Column, it takes precedence over SQLType.
+	Column string `xml:"column,attr" yaml:"column"`
+	// SQLType is a type name like DECIMAL, which matches all of its lengths, or one
+	// with length like CHAR(36).
+	SQLType string `xml:"sqlType,attr" yaml:"sqlType"`
+	// Go is the import path followed by the type name, e.g.
+	// github.com/google/uuid.UUID, or a predeclared type like int32 and []byte.
+	Go string `xml:"go,attr" yaml:"go"`
+	// JSON is a type like Go, whose values are stored as JSON, e.g. in a JSON column.
+	// Generated code marshals and unmarshals them, so it needs not implement sql.Scanner.
+	JSON string `xml:"json,attr" yaml:"json"`
+
+	Pos diagnostic.Position `xml:"-" yaml:"-"`
+}
+
+// IsValid return nil if valid.
+func (t TypeMapping) IsValid() error {
+	if (t.Column == "") == (t.SQLType == "") {
+		return errors.New("exactly one of column and sqlType must be set")
+	}
+	if t.Column != "" {
+		parts := strings.Split(t.Column, ".")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("column must be Table.Column, but %s is not", t.Column)
+		}
+	}
+	if (t.Go == "") == (t.JSON == "") {
+		return errors.New("exactly one of go and json must be set")
+	}
+	pkg, name := t.GoType()
+	if pkg == "" {
+		name = strings.TrimPrefix(name, "[]")
+	}
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("%w, go and json must be an import path followed by a type name, "+
+			"or a predeclared type, but %s is not", ErrInvalidIdentifier, t.Go+t.JSON)
+	}
+	return nil
+}
+
+// GoType returns the import path and the name of the Go type, the path is empty for
+// predeclared types.
+func (t TypeMapping) GoType() (pkg string, name string) {
+	typ := t.Go
+	if t.JSON != "" {
+		typ = t.JSON
+	}
+	slash := strings.LastIndex(typ, "/")
+	dot := strings.LastIndex(typ, ".")
+	if dot <= slash {
+		return "", typ
+	}
+	return typ[:dot], typ[dot+1:]
+}
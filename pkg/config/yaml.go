@@ -0,0 +1,154 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+// isYAML returns true if @p path is a YAML config, judged by its extension.
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+var yamlErrorLineRegexp = regexp.MustCompile(`line (\d+)`)
+
+// decodeYAML decodes a YAML config, and locates its elements. Unknown fields are
+// errors, as they are usually typos.
+func decodeYAML(path string, src []byte) (*NeedleConfig, error) {
+	fileStart := diagnostic.Position{File: path, Line: 1, Column: 1}
+	var data NeedleConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(src))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&data)
+	if err != nil && err != io.EOF {
+		pos := fileStart
+		if m := yamlErrorLineRegexp.FindStringSubmatch(err.Error()); m != nil {
+			pos.Line, _ = strconv.Atoi(m[1])
+		}
+		return nil, diagnostic.List{errorAt(pos, "", "parse YAML", err)}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(src, &root); err == nil {
+		locateYAML(path, src, &root).apply(&data, fileStart)
+	}
+	return &data, nil
+}
+
+// locateYAML finds out where elements are in the YAML config @p src, whose node
+// tree is @p root. Like locateElements, it is best-effort: offsets inside a multi-line
+// sql are adjusted for indentation only if it is a block scalar.
+func locateYAML(path string, src []byte, root *yaml.Node) sourceMap {
+	var rst sourceMap
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return rst
+	}
+	posOf := func(n *yaml.Node) diagnostic.Position {
+		return diagnostic.Position{File: path, Line: n.Line, Column: n.Column}
+	}
+	doc := root.Content[0]
+
+	if key, _ := yamlField(doc, "output"); key != nil {
+		rst.output = posOf(key)
+	}
+	if key, schema := yamlField(doc, "schema"); key != nil {
+		rst.schema = posOf(key)
+		rst.schemaSQL = rst.schema
+		if _, sql := yamlField(schema, "sql"); sql != nil {
+			rst.schemaSQL = yamlScalarPos(path, src, sql)
+		}
+		if _, tables := yamlField(schema, "tables"); tables != nil {
+			for _, tb := range tables.Content {
+				pos := posOf(tb)
+				sqlPos := pos
+				if _, sql := yamlField(tb, "sql"); sql != nil {
+					sqlPos = yamlScalarPos(path, src, sql)
+				}
+				rst.tables = append(rst.tables, pos)
+				rst.tableSQLs = append(rst.tableSQLs, sqlPos)
+			}
+		}
+		if _, refs := yamlField(schema, "refs"); refs != nil {
+			for _, ref := range refs.Content {
+				rst.refs = append(rst.refs, posOf(ref))
+			}
+		}
+	}
+
+	_, stmts := yamlField(doc, "stmts")
+	locateStmts := func(parent *yaml.Node, key string, positions, sqlPositions *[]diagnostic.Position) {
+		_, seq := yamlField(parent, key)
+		if seq == nil {
+			return
+		}
+		for _, stmt := range seq.Content {
+			pos := posOf(stmt)
+			sqlPos := pos
+			if _, sql := yamlField(stmt, "sql"); sql != nil {
+				sqlPos = yamlScalarPos(path, src, sql)
+			}
+			*positions = append(*positions, pos)
+			*sqlPositions = append(*sqlPositions, sqlPos)
+		}
+	}
+	locateStmts(stmts, "queries", &rst.queries, &rst.querySQLs)
+	if _, queries := yamlField(stmts, "queries"); queries != nil {
+		for _, q := range queries.Content {
+			cache := diagnostic.Position{}
+			if _, v := yamlField(q, "cacheDuration"); v != nil {
+				cache = yamlScalarPos(path, src, v)
+			}
+			rst.queryCaches = append(rst.queryCaches, cache)
+		}
+	}
+	locateStmts(stmts, "mutations", &rst.mutations, &rst.mutationSQLs)
+	locateStmts(doc, "fragments", &rst.fragments, &rst.fragmentSQLs)
+	if _, types := yamlField(doc, "types"); types != nil {
+		for _, t := range types.Content {
+			rst.types = append(rst.types, posOf(t))
+		}
+	}
+	return rst
+}
+
+// yamlField returns the key and the value node of @p key in mapping @p n.
+func yamlField(n *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// yamlScalarPos returns the position of the first character of the value of @p n.
+func yamlScalarPos(path string, src []byte, n *yaml.Node) diagnostic.Position {
+	pos := diagnostic.Position{File: path, Line: n.Line, Column: n.Column}
+	switch n.Style {
+	case yaml.LiteralStyle, yaml.FoldedStyle:
+		// n is the | or > indicator, the value starts at the next line after indentation.
+		lines := strings.SplitN(string(src), "\n", n.Line+2)
+		if len(lines) > n.Line {
+			next := lines[n.Line]
+			pos.Line++
+			// the value has the indentation of the block removed from every line.
+			pos.Indent = len(next) - len(strings.TrimLeft(next, " "))
+			pos.Column = pos.Indent + 1
+		}
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		pos.Column++
+	}
+	return pos
+}
@@ -0,0 +1,207 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Severity of a diagnostic.
+type Severity int
+
+const (
+	// SeverityError compilation cannot succeed.
+	SeverityError Severity = iota
+	// SeverityWarning compiled, but probably not what user expects.
+	SeverityWarning
+)
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// Position is a location in a source file. Line and Column are 1-based,
+// zero Line indicates that only the file is known.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+	// Indent is the number of bytes that lines after the first one are indented by in
+	// the file but not in the text being advanced, e.g. the value of a YAML block scalar.
+	Indent int
+}
+
+// IsValid returns true if line is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Advance returns the position of text[offset], given that @p p is the position of
+// text[0]. Column is counted in bytes, Indent is added to columns of following lines.
+func (p Position) Advance(text string, offset int) Position {
+	if !p.IsValid() {
+		return p
+	}
+	if offset > len(text) {
+		offset = len(text)
+	}
+	prefix := text[:offset]
+	nl := strings.Count(prefix, "\n")
+	if nl == 0 {
+		return Position{File: p.File, Line: p.Line, Column: p.Column + offset, Indent: p.Indent}
+	}
+	return Position{
+		File:   p.File,
+		Line:   p.Line + nl,
+		Column: p.Indent + offset - strings.LastIndex(prefix, "\n"),
+		Indent: p.Indent,
+	}
+}
+
+// PositionOfOffset returns the position of src[offset] in the file.
+func PositionOfOffset(file string, src []byte, offset int) Position {
+	return Position{File: file, Line: 1, Column: 1}.Advance(string(src), offset)
+}
+
+// Categories of diagnostics that are not found by visitors, see visitors.ErrorType for
+// others.
+const (
+	// CategoryConfig invalid config file.
+	CategoryConfig = "Config"
+	// CategorySyntax SQL syntax error.
+	CategorySyntax = "Syntax"
+	// CategoryMigration destructive schema change, see needle migrate.
+	CategoryMigration = "Migration"
+)
+
+// Diagnostic is a problem found in a config.
+type Diagnostic struct {
+	Severity Severity
+	Category string
+	Pos      Position
+	// Stmt is the name of the query or mutation, empty if not in a statement.
+	Stmt    string
+	Message string
+}
+
+// MarshalJSON flattens position into the object.
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Severity Severity `json:"severity"`
+		Category string   `json:"category,omitempty"`
+		File     string   `json:"file"`
+		Line     int      `json:"line,omitempty"`
+		Column   int      `json:"column,omitempty"`
+		Stmt     string   `json:"stmt,omitempty"`
+		Message  string   `json:"message"`
+	}{
+		Severity: d.Severity,
+		Category: d.Category,
+		File:     d.Pos.File,
+		Line:     d.Pos.Line,
+		Column:   d.Pos.Column,
+		Stmt:     d.Stmt,
+		Message:  d.Message,
+	})
+}
+
+func (d Diagnostic) String() string {
+	var builder strings.Builder
+	if d.Pos.File != "" {
+		builder.WriteString(d.Pos.String() + ": ")
+	}
+	builder.WriteString(d.Severity.String() + ": ")
+	if d.Stmt != "" {
+		builder.WriteString(d.Stmt + ": ")
+	}
+	if d.Category != "" {
+		builder.WriteString("[" + d.Category + "] ")
+	}
+	builder.WriteString(d.Message)
+	return builder.String()
+}
+
+// List is a list of diagnostics, it is also an error.
+type List []Diagnostic
+
+// Errorf appends an error diagnostic.
+func (l *List) Errorf(category string, pos Position, stmt string, format string,
+	args ...interface{}) {
+	*l = append(*l, Diagnostic{
+		Severity: SeverityError,
+		Category: category,
+		Pos:      pos,
+		Stmt:     stmt,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Warnf appends a warning diagnostic.
+func (l *List) Warnf(category string, pos Position, stmt string, format string,
+	args ...interface{}) {
+	*l = append(*l, Diagnostic{
+		Severity: SeverityWarning,
+		Category: category,
+		Pos:      pos,
+		Stmt:     stmt,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// HasErrors returns true if any diagnostic is an error.
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns @p l as an error if it has any error, nil otherwise.
+func (l List) Err() error {
+	if l.HasErrors() {
+		return l
+	}
+	return nil
+}
+
+func (l List) Error() string {
+	lines := make([]string, 0, len(l))
+	for _, d := range l {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FromError converts @p err to diagnostics. If err is, or wraps, a List, the list is
+// returned, otherwise a single error at @p pos.
+func FromError(err error, pos Position, stmt string) List {
+	if err == nil {
+		return nil
+	}
+	var l List
+	if errors.As(err, &l) {
+		return l
+	}
+	return List{{Severity: SeverityError, Pos: pos, Stmt: stmt, Message: err.Error()}}
+}
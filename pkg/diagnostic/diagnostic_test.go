@@ -0,0 +1,60 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type diagnosticTestSuite struct {
+	suite.Suite
+}
+
+func TestDiagnosticTestSuite(t *testing.T) {
+	suite.Run(t, new(diagnosticTestSuite))
+}
+
+func (suite *diagnosticTestSuite) TestAdvance() {
+	start := Position{File: "a.xml", Line: 3, Column: 10}
+	text := "SELECT *\n  FROM t\nWHERE a = ?"
+	suite.Equal(Position{File: "a.xml", Line: 3, Column: 10}, start.Advance(text, 0))
+	suite.Equal(Position{File: "a.xml", Line: 3, Column: 17}, start.Advance(text, 7))
+	suite.Equal(Position{File: "a.xml", Line: 4, Column: 3}, start.Advance(text, 11))
+	suite.Equal(Position{File: "a.xml", Line: 5, Column: 11}, start.Advance(text, 28))
+	suite.Equal(Position{File: "a.xml"}, Position{File: "a.xml"}.Advance(text, 11))
+
+	// lines after the first one are indented by 4 in the file.
+	indented := Position{File: "a.yaml", Line: 3, Column: 5, Indent: 4}
+	suite.Equal(Position{File: "a.yaml", Line: 3, Column: 12, Indent: 4}, indented.Advance(text, 7))
+	suite.Equal(Position{File: "a.yaml", Line: 4, Column: 7, Indent: 4}, indented.Advance(text, 11))
+}
+
+func (suite *diagnosticTestSuite) TestList() {
+	var l List
+	suite.Nil(l.Err())
+	l.Warnf("", Position{File: "a.xml", Line: 1, Column: 2}, "GetA", "not cached")
+	suite.Nil(l.Err())
+	l.Errorf(CategoryConfig, Position{File: "a.xml"}, "", "bad %s", "schema")
+	suite.Require().Error(l.Err())
+	suite.Equal("a.xml:1:2: warning: GetA: not cached\na.xml: error: [Config] bad schema", l.Error())
+
+	suite.Equal(l, FromError(l.Err(), Position{}, ""))
+	suite.Equal(List{{Severity: SeverityError, Stmt: "GetB", Message: "oops"}},
+		FromError(errors.New("oops"), Position{}, "GetB"))
+}
+
+func (suite *diagnosticTestSuite) TestJSON() {
+	d := Diagnostic{
+		Severity: SeverityError,
+		Category: "TypeCheck",
+		Pos:      Position{File: "a.xml", Line: 3, Column: 7},
+		Stmt:     "GetA",
+		Message:  "type mismatch",
+	}
+	rst, err := json.Marshal(d)
+	suite.Require().NoError(err)
+	suite.JSONEq(`{"severity":"error","category":"TypeCheck","file":"a.xml",
+		"line":3,"column":7,"stmt":"GetA","message":"type mismatch"}`, string(rst))
+}
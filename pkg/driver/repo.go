@@ -6,82 +6,146 @@ import (
 	"github.com/pingcap/tidb/parser/ast"
 
 	"github.com/stumble/needle/pkg/config"
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/parser"
 	"github.com/stumble/needle/pkg/schema"
 )
 
+// Status of a statement in compilation.
+type Status struct {
+	// Diagnostics of the statement, it is poisoned if any of them is an error.
+	Diagnostics diagnostic.List
+}
+
+// Poison appends @p diags to the statement.
+func (s *Status) Poison(diags diagnostic.List) {
+	s.Diagnostics = append(s.Diagnostics, diags...)
+}
+
+// Poisoned returns true if the statement has failed to compile, passes should skip it.
+func (s Status) Poisoned() bool {
+	return s.Diagnostics.HasErrors()
+}
+
 // Query - the stmt node and query.
 type Query struct {
+	Status
 	Config *config.Query
 	Node   ast.Node
 }
 
 // Mutation - the stmt node and mutation.
 type Mutation struct {
+	Status
 	Config *config.Mutation
 	Node   ast.Node
 
 	Invalidates []*Query
 }
 
-// Repo is the root struct.
+// MainTable is a table owned by the repo, it has a main struct and Load and Dump.
+type MainTable struct {
+	Table  schema.SQLTable
+	Config config.Table
+}
+
+// Repo is the root struct. Tables are main tables followed by referenced ones, and
+// Mains[0] is the one of the schema.
 type Repo struct {
 	Tables    []schema.SQLTable
+	Mains     []MainTable
 	Queries   []*Query
 	Mutations []*Mutation
 	Config    *config.NeedleConfig
 }
 
-// NewRepoFromConfig - panic if error
+// NewRepoFromConfig - returns a diagnostic.List as error if any SQL is invalid.
+// Repo is nil if tables are invalid. Otherwise, statements that failed to parse
+// are poisoned, and the repo is returned together with their diagnostics.
 func NewRepoFromConfig(config *config.NeedleConfig) (*Repo, error) {
+	var diags diagnostic.List
 	tables := make([]schema.SQLTable, 0)
-	sql, err := tableFromSQL(config.Schema.SQL, config.Schema.HiddenFields())
-	if err != nil {
-		return nil, err
+	mains := make([]MainTable, 0)
+	tablePos := make(map[string]diagnostic.Position)
+	addTable := func(tb schema.SQLTable, pos diagnostic.Position) bool {
+		if _, dup := tablePos[tb.Name()]; dup {
+			diags.Errorf(diagnostic.CategoryConfig, pos, "",
+				"table %s is defined more than once, also at %s", tb.Name(), tablePos[tb.Name()])
+			return false
+		}
+		tablePos[tb.Name()] = pos
+		tables = append(tables, tb)
+		return true
 	}
-	tables = append(tables, sql)
-	for _, ref := range config.Schema.Refs {
-		sql, err := tableFromSQL(ref.SQL, []string{})
+	for _, main := range config.Schema.MainTables() {
+		sql, err := tableFromSQL(main.SQL, main.HiddenFields())
 		if err != nil {
-			return nil, err
+			diags = append(diags, sqlDiagnostic(main.SQL, nil, main.SQLPos, "", err))
+			continue
 		}
-		tables = append(tables, sql)
+		if addTable(sql, main.Pos) {
+			mains = append(mains, MainTable{Table: sql, Config: main})
+		}
+	}
+	for _, ref := range config.Schema.Refs {
+		for _, tb := range ref.Tables {
+			sql, err := tableFromSQL(tb.SQL, []string{})
+			if err != nil {
+				diags = append(diags, sqlDiagnostic(tb.SQL, nil, tb.SQLPos, "", err))
+				continue
+			}
+			addTable(sql, ref.Pos)
+		}
+	}
+
+	if diags.HasErrors() {
+		return nil, diags
 	}
 
 	queries := make([]*Query, 0)
 	queryNameObj := make(map[string]*Query)
 	for i, s := range config.Stmts.Queries {
+		query := &Query{Config: &config.Stmts.Queries[i]}
 		node, err := s.SQL.Parse()
 		if err != nil {
-			return nil, err
+			query.Poison(diagnostic.List{sqlDiagnostic(s.SQL, s.SQLMap, s.SQLPos, s.Name, err)})
+			diags = append(diags, query.Diagnostics...)
 		}
-		queries = append(queries, &Query{Config: &config.Stmts.Queries[i], Node: node})
-		queryNameObj[s.Name] = queries[len(queries)-1]
+		query.Node = node
+		queries = append(queries, query)
+		queryNameObj[s.Name] = query
 	}
 
 	mutations := make([]*Mutation, 0)
 	for i, m := range config.Stmts.Mutations {
+		mutation := &Mutation{Config: &config.Stmts.Mutations[i]}
 		node, err := m.SQL.Parse()
 		if err != nil {
-			return nil, err
+			mutation.Poison(diagnostic.List{sqlDiagnostic(m.SQL, m.SQLMap, m.SQLPos, m.Name, err)})
 		}
-		invalidates := make([]*Query, 0)
+		mutation.Node = node
 		for _, qname := range m.InvalidateQueries() {
 			q, ok := queryNameObj[qname]
 			if !ok {
-				return nil, errors.New("query name not exist: " + qname)
+				var notExist diagnostic.List
+				notExist.Errorf(diagnostic.CategoryConfig, m.Pos, m.Name,
+					"query name not exist or invalid: %s", qname)
+				mutation.Poison(notExist)
+				continue
 			}
-			invalidates = append(invalidates, q)
+			mutation.Invalidates = append(mutation.Invalidates, q)
 		}
-		mutations = append(mutations, &Mutation{
-			Config: &config.Stmts.Mutations[i], Node: node, Invalidates: invalidates})
+		diags = append(diags, mutation.Diagnostics...)
+		mutations = append(mutations, mutation)
 	}
 
 	return &Repo{
 		Tables:    tables,
+		Mains:     mains,
 		Queries:   queries,
 		Mutations: mutations,
 		Config:    config,
-	}, nil
+	}, diags.Err()
 }
 
 func tableFromSQL(sql config.SQLStmt, hf []string) (schema.SQLTable, error) {
@@ -89,7 +153,29 @@ func tableFromSQL(sql config.SQLStmt, hf []string) (schema.SQLTable, error) {
 	if err != nil {
 		return nil, err
 	}
-	rst := schema.NewTableInfo(tb.(*ast.CreateTableStmt), hf)
+	createTable, ok := tb.(*ast.CreateTableStmt)
+	if !ok {
+		return nil, errors.New("schema must be a CREATE TABLE statement")
+	}
+	rst := schema.NewTableInfo(createTable, hf)
 	err = rst.Valid()
 	return rst, err
 }
+
+// sqlDiagnostic converts an error of @p sql to diagnostic, positioned at the syntax
+// error if it is one. @p sqlMap maps the position to fragments, nil if none.
+func sqlDiagnostic(sql config.SQLStmt, sqlMap config.SQLMap, start diagnostic.Position,
+	stmt string, err error) diagnostic.Diagnostic {
+	category := diagnostic.CategoryConfig
+	offset, isSyntaxErr := parser.ErrorOffset(string(sql), err)
+	if isSyntaxErr {
+		category = diagnostic.CategorySyntax
+	}
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.SeverityError,
+		Category: category,
+		Pos:      sqlMap.PosOf(sql, start, offset),
+		Stmt:     stmt,
+		Message:  err.Error(),
+	}
+}
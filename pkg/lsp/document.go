@@ -0,0 +1,103 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pingcap/tidb/parser/ast"
+
+	"github.com/stumble/needle"
+	"github.com/stumble/needle/pkg/codegen"
+	"github.com/stumble/needle/pkg/config"
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/passes"
+	"github.com/stumble/needle/pkg/schema"
+	"github.com/stumble/needle/pkg/visitors"
+)
+
+// param is a ? marker of a compiled statement.
+type param struct {
+	Pos   diagnostic.Position
+	Stmt  string
+	Field codegen.GoField
+	Param visitors.GoParam
+}
+
+// document is an opened config.
+type document struct {
+	uri  string
+	path string
+	text string
+
+	// params of statements that compiled in the last compilation, of the current text.
+	params []param
+	// tables of the last compilation that loaded the config, they are kept when the
+	// config is broken so that columns can still be completed while editing.
+	tables []schema.SQLTable
+	// types of the last compilation, to type params the way codegen does.
+	types *passes.TypeMap
+}
+
+// compile the document, returns all diagnostics.
+func (d *document) compile(ctx context.Context) diagnostic.List {
+	rst, err := needle.Compile(ctx, needle.Options{Path: d.path, Config: []byte(d.text)})
+	if rst == nil {
+		return diagnostic.FromError(err, diagnostic.Position{File: d.path}, "")
+	}
+	d.params = nil
+	if rst.Repo == nil {
+		return rst.Diagnostics
+	}
+	d.tables = rst.Repo.Tables
+	d.types, _ = passes.NewTypeMap(rst.Repo, rst.Repo.Config.Output.Nullable)
+	for _, q := range rst.Repo.Queries {
+		if !q.Poisoned() {
+			d.addParams(q.Config.Name, q.Config.SQL, q.Config.SQLMap, q.Config.SQLPos, q.Node)
+		}
+	}
+	for _, m := range rst.Repo.Mutations {
+		if !m.Poisoned() {
+			d.addParams(m.Config.Name, m.Config.SQL, m.Config.SQLMap, m.Config.SQLPos, m.Node)
+		}
+	}
+	return rst.Diagnostics
+}
+
+// addParams extracts params of the statement @p name, the way codegen does.
+func (d *document) addParams(name string, sql config.SQLStmt, sqlMap config.SQLMap,
+	sqlPos diagnostic.Position, node ast.Node) {
+	extract := visitors.NewParamExtractVisitor()
+	node.Accept(extract)
+	if extract.Errors() != nil {
+		return
+	}
+	args := passes.GenInputStruct(name+"Args", extract.Params, d.types)
+	for i, p := range extract.Params {
+		d.params = append(d.params, param{
+			Pos:   sqlMap.PosOf(sql, sqlPos, p.Marker.Offset),
+			Stmt:  name,
+			Field: args.Fields[i],
+			Param: p,
+		})
+	}
+}
+
+// paramAt returns the param whose ? marker is at @p pos.
+func (d *document) paramAt(pos position) (param, bool) {
+	for _, p := range d.params {
+		if toPosition(d.text, p.Pos) == pos {
+			return p, true
+		}
+	}
+	return param{}, false
+}
+
+// hoverText of @p p, e.g. the field of the generated args struct and where it comes from.
+func hoverText(p param) string {
+	column := p.Param.Name
+	if p.Param.TableName != "" {
+		column = p.Param.TableName + "." + column
+	}
+	return fmt.Sprintf("```go\n%s %s\n```\nparam $%d of %s, bound to `%s`",
+		p.Field.Name, p.Field.Type, p.Param.Order+1, p.Stmt, column)
+}
@@ -0,0 +1,264 @@
+package lsp
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+)
+
+// queryDef is a <query> element of a config.
+type queryDef struct {
+	Name string
+	Pos  diagnostic.Position
+}
+
+// configKind returns the front end of the config at @p path, judged by its extension
+// the way config.ParseConfig does.
+func configKind(path string) string {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		return ".yaml"
+	case ".sql":
+		return ext
+	}
+	return ".xml"
+}
+
+// queryDefs returns queries of the config @p text at @p path, it works on configs being
+// edited, i.e. invalid configs.
+func queryDefs(path string, text string) []queryDef {
+	switch configKind(path) {
+	case ".yaml":
+		return yamlQueryDefs(path, text)
+	case ".sql":
+		return sqlQueryDefs(path, text)
+	}
+	return xmlQueryDefs(path, text)
+}
+
+// xmlQueryDefs returns <query> elements of @p text, it stops at the first XML syntax
+// error.
+func xmlQueryDefs(path string, text string) []queryDef {
+	var rst []queryDef
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err != nil {
+			return rst
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "query" {
+			continue
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "name" {
+				rst = append(rst, queryDef{
+					Name: attr.Value,
+					Pos:  diagnostic.PositionOfOffset(path, []byte(text), int(offset)),
+				})
+			}
+		}
+	}
+}
+
+// yamlQueryDefs returns items of queries of @p text. Lines are scanned rather than
+// decoded, so that queries before a YAML syntax error are still found.
+func yamlQueryDefs(path string, text string) []queryDef {
+	var rst []queryDef
+	queriesIndent := -1
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		start := offset
+		offset += len(line)
+		key, keyOffset := yamlKeyOf(line)
+		if key == "" {
+			continue
+		}
+		if keyOffset <= queriesIndent {
+			queriesIndent = -1
+		}
+		switch {
+		case key == "queries":
+			queriesIndent = keyOffset
+		case key == "name" && queriesIndent >= 0:
+			name := strings.Trim(strings.TrimSpace(line[keyOffset+len("name:"):]), `"'`)
+			rst = append(rst, queryDef{
+				Name: name,
+				Pos:  diagnostic.PositionOfOffset(path, []byte(text), start+keyOffset),
+			})
+		}
+	}
+	return rst
+}
+
+// yamlKeyOf returns the key of the YAML @p line and its offset in the line, which is
+// also the indentation, as dashes of sequence items are counted. Returns "" if the line
+// has no key.
+func yamlKeyOf(line string) (string, int) {
+	trimmed := strings.TrimLeft(line, " -")
+	m := yamlKeyRegexp.FindStringSubmatch(trimmed)
+	if m == nil {
+		return "", 0
+	}
+	return m[1], len(line) - len(trimmed)
+}
+
+var yamlKeyRegexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*):(\s|$)`)
+
+// sqlQueryDefs returns name annotations of queries of the annotated SQL config @p text.
+func sqlQueryDefs(path string, text string) []queryDef {
+	var rst []queryDef
+	for i, line := range strings.Split(text, "\n") {
+		m := sqlNameRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil || m[2] == ":mutation" {
+			continue
+		}
+		rst = append(rst, queryDef{
+			Name: m[1],
+			Pos:  diagnostic.Position{File: path, Line: i + 1, Column: 1},
+		})
+	}
+	return rst
+}
+
+var sqlNameRegexp = regexp.MustCompile(`^--\s*name:\s*(\S+)\s+(\S+)`)
+
+// lineAt returns the byte offsets of the start and the end of the 0-based @p line of
+// @p text, without the line break. Lines after the last one are at the end of text.
+func lineAt(text string, line int) (int, int) {
+	start := 0
+	for i := 0; i < line; i++ {
+		next := strings.IndexByte(text[start:], '\n')
+		if next < 0 {
+			return len(text), len(text)
+		}
+		start += next + 1
+	}
+	end := strings.IndexByte(text[start:], '\n')
+	if end < 0 {
+		return start, len(text)
+	}
+	return start, start + end
+}
+
+// offsetOf returns the byte offset of @p pos in @p text, clamped to the line. Characters
+// of LSP positions are in UTF-16 code units.
+func offsetOf(text string, pos position) int {
+	start, end := lineAt(text, pos.Line)
+	units := 0
+	for i, r := range text[start:end] {
+		if units >= pos.Character {
+			return start + i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return end
+}
+
+// toPosition converts a 1-based diagnostic position in @p text, whose column is in bytes,
+// to a 0-based LSP position.
+func toPosition(text string, pos diagnostic.Position) position {
+	rst := position{Line: pos.Line - 1}
+	if rst.Line < 0 {
+		rst.Line = 0
+	}
+	start, end := lineAt(text, rst.Line)
+	column := start + pos.Column - 1
+	if column > end {
+		column = end
+	}
+	if column < start {
+		column = start
+	}
+	for _, r := range text[start:column] {
+		rst.Character += utf16.RuneLen(r)
+	}
+	return rst
+}
+
+func isIdentChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordAt returns the start and the end of the identifier around @p offset.
+func wordAt(text string, offset int) (int, int) {
+	start, end := offset, offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if !isIdentChar(r) {
+			break
+		}
+		start -= size
+	}
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !isIdentChar(r) {
+			break
+		}
+		end += size
+	}
+	return start, end
+}
+
+// inSQL returns true if @p offset of the config @p text at @p path is inside SQL.
+func inSQL(path string, text string, offset int) bool {
+	switch configKind(path) {
+	case ".yaml":
+		return inYAMLSQL(text, offset)
+	case ".sql":
+		// all but annotations and comments are SQL.
+		start, end := lineAt(text, strings.Count(text[:offset], "\n"))
+		return !strings.HasPrefix(strings.TrimSpace(text[start:end]), "--")
+	}
+	before := text[:offset]
+	return strings.LastIndex(before, "<sql>") > strings.LastIndex(before, "</sql>")
+}
+
+// inYAMLSQL returns true if @p offset is in the value of a sql key, either on the line
+// of the key or in the block scalar indented under it.
+func inYAMLSQL(text string, offset int) bool {
+	lineNo := strings.Count(text[:offset], "\n")
+	start, end := lineAt(text, lineNo)
+	line := text[start:end]
+	if key, keyOffset := yamlKeyOf(line); key != "" {
+		return key == "sql" && offset-start > keyOffset+len("sql:")
+	}
+	indent := len(line) - len(strings.TrimLeft(line, " "))
+	for lineNo > 0 {
+		lineNo--
+		start, end = lineAt(text, lineNo)
+		line = text[start:end]
+		if strings.TrimSpace(line) == "" || len(line)-len(strings.TrimLeft(line, " ")) >= indent {
+			continue
+		}
+		key, _ := yamlKeyOf(line)
+		return key == "sql"
+	}
+	return false
+}
+
+// inInvalidate returns true if @p offset of the config @p text at @p path is inside an
+// invalidate list, i.e. a comma separated list of query names.
+func inInvalidate(path string, text string, offset int) bool {
+	prefix := `invalidate="`
+	stops := `"<>`
+	switch configKind(path) {
+	case ".yaml":
+		prefix, stops = "invalidate:", "\n#"
+	case ".sql":
+		prefix, stops = "invalidate=", " \t\n"
+	}
+	before := text[:offset]
+	i := strings.LastIndex(before, prefix)
+	if i < 0 {
+		return false
+	}
+	return !strings.ContainsAny(before[i+len(prefix):], stops)
+}
@@ -0,0 +1,297 @@
+// Package lsp implements a language server of needle configs. It reuses the compiler
+// pipeline for diagnostics, and works on the raw text for features that are needed
+// while the config is broken, e.g. completion.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/vcs"
+)
+
+// Server is a language server talking over a pair of streams, usually stdin and stdout.
+type Server struct {
+	conn *conn
+	docs map[string]*document
+}
+
+// NewServer -
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		conn: newConn(in, out),
+		docs: make(map[string]*document),
+	}
+}
+
+// Run serves requests until the client exits or closes the input.
+func (s *Server) Run(ctx context.Context) error {
+	for {
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var rpcErr *responseError
+			if !errors.As(err, &rpcErr) {
+				return err
+			}
+			err = s.conn.write(errorResponse{JSONRPC: jsonrpcVersion, Error: rpcErr})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(ctx, msg)
+		if msg.ID == nil {
+			if err != nil {
+				log.Error().Msgf("lsp: %s: %s", msg.Method, err)
+			}
+			continue
+		}
+		if err != nil {
+			var rpcErr *responseError
+			if !errors.As(err, &rpcErr) {
+				rpcErr = &responseError{Code: codeInternalError, Message: err.Error()}
+			}
+			err = s.conn.write(errorResponse{JSONRPC: jsonrpcVersion, ID: msg.ID, Error: rpcErr})
+		} else {
+			err = s.conn.write(response{JSONRPC: jsonrpcVersion, ID: msg.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, msg *message) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync: textDocumentSyncOptions{
+					OpenClose: true,
+					Change:    textDocumentSyncFull,
+					Save:      saveOptions{IncludeText: true},
+				},
+				HoverProvider:      true,
+				CompletionProvider: completionOptions{TriggerCharacters: []string{".", ",", `"`}},
+				DefinitionProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "needle", Version: vcs.Commit},
+		}, nil
+	case "initialized", "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		path, err := uriToPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		doc := &document{uri: params.TextDocument.URI, path: path, text: params.TextDocument.Text}
+		s.docs[doc.uri] = doc
+		return nil, s.publishDiagnostics(doc, doc.compile(ctx))
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		// full sync, the last change is the whole text.
+		if n := len(params.ContentChanges); n > 0 {
+			doc.text = params.ContentChanges[n-1].Text
+		}
+		// recompile, so that params of hovers are at where they are in the new text.
+		return nil, s.publishDiagnostics(doc, doc.compile(ctx))
+	case "textDocument/didSave":
+		var params didSaveParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		if params.Text != nil {
+			doc.text = *params.Text
+		}
+		return nil, s.publishDiagnostics(doc, doc.compile(ctx))
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := unmarshalParams(msg, &params); err != nil {
+			return nil, err
+		}
+		doc, err := s.document(params.TextDocument.URI)
+		if err != nil {
+			return nil, err
+		}
+		delete(s.docs, doc.uri)
+		return nil, s.publishDiagnostics(doc, nil)
+	case "textDocument/hover":
+		return s.withPosition(msg, s.hover)
+	case "textDocument/completion":
+		return s.withPosition(msg, s.completion)
+	case "textDocument/definition":
+		return s.withPosition(msg, s.definition)
+	}
+	if msg.ID == nil {
+		// notifications that we do not care, e.g. $/cancelRequest.
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func (s *Server) withPosition(msg *message,
+	f func(doc *document, pos position) (interface{}, error)) (interface{}, error) {
+	var params textDocumentPositionParams
+	if err := unmarshalParams(msg, &params); err != nil {
+		return nil, err
+	}
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return f(doc, params.Position)
+}
+
+// hover over a ? marker shows the param it is bound to.
+func (s *Server) hover(doc *document, pos position) (interface{}, error) {
+	p, ok := doc.paramAt(pos)
+	if !ok {
+		return nil, nil
+	}
+	return hover{
+		Contents: markupContent{Kind: markupKindMarkdown, Value: hoverText(p)},
+		Range: lspRange{
+			Start: pos,
+			End:   position{Line: pos.Line, Character: pos.Character + 1},
+		},
+	}, nil
+}
+
+// completion of query names in invalidate lists, and of columns in SQL.
+func (s *Server) completion(doc *document, pos position) (interface{}, error) {
+	offset := offsetOf(doc.text, pos)
+	rst := completionList{Items: []completionItem{}}
+	switch {
+	case inInvalidate(doc.path, doc.text, offset):
+		for _, q := range queryDefs(doc.path, doc.text) {
+			rst.Items = append(rst.Items, completionItem{
+				Label: q.Name, Kind: completionKindFunc, Detail: "query"})
+		}
+	case inSQL(doc.path, doc.text, offset):
+		for _, table := range doc.tables {
+			for _, col := range table.Columns() {
+				rst.Items = append(rst.Items, completionItem{
+					Label:  col.Name(),
+					Kind:   completionKindField,
+					Detail: fmt.Sprintf("%s.%s %s", table.Name(), col.Name(), col.Type()),
+				})
+			}
+		}
+	}
+	return rst, nil
+}
+
+// definition of a query name in an invalidate list is where the query is declared.
+func (s *Server) definition(doc *document, pos position) (interface{}, error) {
+	offset := offsetOf(doc.text, pos)
+	if !inInvalidate(doc.path, doc.text, offset) {
+		return nil, nil
+	}
+	start, end := wordAt(doc.text, offset)
+	name := doc.text[start:end]
+	for _, q := range queryDefs(doc.path, doc.text) {
+		if q.Name == name {
+			p := toPosition(doc.text, q.Pos)
+			return location{URI: doc.uri, Range: lspRange{Start: p, End: p}}, nil
+		}
+	}
+	return nil, nil
+}
+
+// publishDiagnostics of @p doc. Diagnostics found in other files, e.g. referenced
+// configs, are shown at the beginning of the document.
+func (s *Server) publishDiagnostics(doc *document, diags diagnostic.List) error {
+	params := publishDiagnosticsParams{URI: doc.uri, Diagnostics: []lspDiagnostic{}}
+	for _, d := range diags {
+		rng := lspRange{}
+		msg := d.Message
+		if d.Stmt != "" {
+			msg = d.Stmt + ": " + msg
+		}
+		if d.Pos.File == doc.path || d.Pos.File == "" {
+			start := toPosition(doc.text, d.Pos)
+			_, end := wordAt(doc.text, offsetOf(doc.text, start))
+			rng = lspRange{Start: start, End: toPosition(doc.text, diagnostic.PositionOfOffset(
+				doc.path, []byte(doc.text), end))}
+			if rng.End.Line != rng.Start.Line || rng.End.Character <= rng.Start.Character {
+				rng.End = position{Line: start.Line, Character: start.Character + 1}
+			}
+		} else {
+			msg = d.Pos.String() + ": " + msg
+		}
+		severity := severityError
+		if d.Severity == diagnostic.SeverityWarning {
+			severity = severityWarning
+		}
+		params.Diagnostics = append(params.Diagnostics, lspDiagnostic{
+			Range:    rng,
+			Severity: severity,
+			Code:     d.Category,
+			Source:   diagnosticsSourceName,
+			Message:  msg,
+		})
+	}
+	return s.conn.write(notification{
+		JSONRPC: jsonrpcVersion,
+		Method:  "textDocument/publishDiagnostics",
+		Params:  params,
+	})
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "document not opened: " + uri}
+	}
+	return doc, nil
+}
+
+func unmarshalParams(msg *message, v interface{}) error {
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// uriToPath returns the file path of a file:// URI.
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	if u.Scheme != "file" {
+		return "", &responseError{Code: codeInvalidParams,
+			Message: "only file URIs are supported: " + uri}
+	}
+	return filepath.FromSlash(u.Path), nil
+}
@@ -0,0 +1,307 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const musicXML = `<needle>
+  <schema name="Musics" mainObj="Music">
+    <sql>
+      CREATE TABLE Musics (
+        ID INT NOT NULL,
+        Title VARCHAR(255) NOT NULL,
+        Year INT NOT NULL,
+        PRIMARY KEY (ID)
+      );
+    </sql>
+  </schema>
+  <stmts>
+    <query name="GetMusicsByYear" type="many" cacheDuration="5m">
+      <sql>
+        SELECT * FROM Musics WHERE Year = ?;
+      </sql>
+    </query>
+    <query name="GetMusicByTitle" type="single" cacheDuration="5m">
+      <sql>
+        SELECT ID FROM Musics WHERE Titel = ?;
+      </sql>
+    </query>
+    <mutation name="UpdateYear" invalidate="GetMusicsByYear">
+      <sql>
+        UPDATE Musics SET Year = ? WHERE ID = ?;
+      </sql>
+    </mutation>
+  </stmts>
+</needle>`
+
+type serverTestSuite struct {
+	suite.Suite
+	uri    string
+	out    *conn
+	done   chan error
+	nextID int
+}
+
+func TestServerTestSuite(t *testing.T) {
+	suite.Run(t, new(serverTestSuite))
+}
+
+func (suite *serverTestSuite) SetupTest() {
+	suite.uri = "file://" + filepath.ToSlash(filepath.Join(suite.T().TempDir(), "music.xml"))
+	// os pipes are buffered like stdio, so that neither side blocks on writing.
+	clientIn, serverOut, err := os.Pipe()
+	suite.Require().NoError(err)
+	serverIn, clientOut, err := os.Pipe()
+	suite.Require().NoError(err)
+	suite.out = newConn(clientIn, clientOut)
+	suite.done = make(chan error, 1)
+	go func() {
+		err := NewServer(serverIn, serverOut).Run(context.Background())
+		serverOut.Close()
+		suite.done <- err
+	}()
+
+	suite.call("initialize", map[string]interface{}{})
+	suite.notify("textDocument/didOpen", didOpenParams{
+		TextDocument: textDocumentItem{URI: suite.uri, Text: musicXML}})
+}
+
+func (suite *serverTestSuite) TearDownTest() {
+	suite.notify("exit", nil)
+	suite.Require().NoError(<-suite.done)
+}
+
+func (suite *serverTestSuite) notify(method string, params interface{}) {
+	suite.Require().NoError(suite.out.write(notification{
+		JSONRPC: jsonrpcVersion, Method: method, Params: params}))
+}
+
+// call sends a request, returns its result. Notifications in between are dropped.
+func (suite *serverTestSuite) call(method string, params interface{}) json.RawMessage {
+	suite.nextID++
+	id := json.RawMessage(strconv.Itoa(suite.nextID))
+	suite.Require().NoError(suite.out.write(struct {
+		JSONRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id"`
+		Method  string           `json:"method"`
+		Params  interface{}      `json:"params"`
+	}{jsonrpcVersion, &id, method, params}))
+	for {
+		var msg struct {
+			ID     *json.RawMessage `json:"id"`
+			Result json.RawMessage  `json:"result"`
+			Error  *responseError   `json:"error"`
+		}
+		suite.Require().NoError(suite.readInto(&msg))
+		if msg.ID == nil {
+			continue
+		}
+		suite.Require().Nil(msg.Error)
+		return msg.Result
+	}
+}
+
+// diagnostics reads the next published diagnostics.
+func (suite *serverTestSuite) diagnostics() publishDiagnosticsParams {
+	var msg struct {
+		Method string                   `json:"method"`
+		Params publishDiagnosticsParams `json:"params"`
+	}
+	suite.Require().NoError(suite.readInto(&msg))
+	suite.Require().Equal("textDocument/publishDiagnostics", msg.Method)
+	return msg.Params
+}
+
+func (suite *serverTestSuite) readInto(v interface{}) error {
+	body, err := suite.out.readBody()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (suite *serverTestSuite) at(line int, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{
+		TextDocument: textDocumentIdentifier{URI: suite.uri},
+		Position:     position{Line: line, Character: character},
+	}
+}
+
+func (suite *serverTestSuite) TestDiagnostics() {
+	// didOpen publishes diagnostics right away.
+	diags := suite.diagnostics()
+	suite.Equal(suite.uri, diags.URI)
+	suite.Require().NotEmpty(diags.Diagnostics)
+	for _, d := range diags.Diagnostics {
+		suite.Equal(position{Line: 19, Character: 36}, d.Range.Start)
+		suite.Equal(position{Line: 19, Character: 41}, d.Range.End)
+		suite.Contains(d.Message, "GetMusicByTitle")
+	}
+
+	fixed := strings.Replace(musicXML, "Titel", "Title", 1)
+	suite.notify("textDocument/didSave", didSaveParams{
+		TextDocument: textDocumentIdentifier{URI: suite.uri}, Text: &fixed})
+	suite.Empty(suite.diagnostics().Diagnostics)
+}
+
+func (suite *serverTestSuite) TestHover() {
+	var rst hover
+	suite.Require().NoError(json.Unmarshal(suite.call("textDocument/hover", suite.at(14, 42)), &rst))
+	suite.Contains(rst.Contents.Value, "Year int64")
+	suite.Contains(rst.Contents.Value, "param $1 of GetMusicsByYear, bound to `Musics.Year`")
+
+	suite.Require().NoError(json.Unmarshal(suite.call("textDocument/hover", suite.at(24, 46)), &rst))
+	suite.Contains(rst.Contents.Value, "Id int64")
+	suite.Contains(rst.Contents.Value, "param $2 of UpdateYear")
+
+	suite.Equal("null", string(suite.call("textDocument/hover", suite.at(14, 41))))
+}
+
+func (suite *serverTestSuite) TestHoverAfterChange() {
+	// a line is inserted before the statements, params move down.
+	changed := strings.Replace(musicXML, "  <stmts>\n", "  <!-- statements -->\n  <stmts>\n", 1)
+	suite.changeTo(changed)
+	suite.Equal("null", string(suite.call("textDocument/hover", suite.at(14, 42))))
+	var rst hover
+	suite.Require().NoError(json.Unmarshal(suite.call("textDocument/hover", suite.at(15, 42)), &rst))
+	suite.Contains(rst.Contents.Value, "param $1 of GetMusicsByYear")
+}
+
+func (suite *serverTestSuite) TestUnicode() {
+	// the note is 2 UTF-16 code units and 4 bytes, é is 1 code unit and 2 bytes.
+	changed := strings.Replace(musicXML, "WHERE Year = ?", "WHERE Title != '🎵' AND Year = ?", 1)
+	changed = strings.Replace(changed, "WHERE Titel = ?", "WHERE 'é' = 'é' AND Titel = ?", 1)
+	suite.changeTo(changed)
+	diags := suite.diagnostics()
+	suite.Require().NotEmpty(diags.Diagnostics)
+	for _, d := range diags.Diagnostics {
+		suite.Equal(position{Line: 19, Character: 50}, d.Range.Start)
+		suite.Equal(position{Line: 19, Character: 55}, d.Range.End)
+	}
+
+	var rst hover
+	suite.Require().NoError(json.Unmarshal(suite.call("textDocument/hover", suite.at(14, 60)), &rst))
+	suite.Contains(rst.Contents.Value, "param $1 of GetMusicsByYear")
+}
+
+// changeTo replaces the whole text of the document, and drops diagnostics of didOpen.
+func (suite *serverTestSuite) changeTo(text string) {
+	suite.diagnostics()
+	suite.notify("textDocument/didChange", didChangeParams{
+		TextDocument: textDocumentIdentifier{URI: suite.uri},
+		ContentChanges: []struct {
+			Text string `json:"text"`
+		}{{Text: text}}})
+}
+
+func (suite *serverTestSuite) TestCompletion() {
+	var rst completionList
+	suite.Require().NoError(json.Unmarshal(
+		suite.call("textDocument/completion", suite.at(22, 50)), &rst))
+	var labels []string
+	for _, item := range rst.Items {
+		labels = append(labels, item.Label)
+	}
+	suite.Equal([]string{"GetMusicsByYear", "GetMusicByTitle"}, labels)
+
+	suite.Require().NoError(json.Unmarshal(
+		suite.call("textDocument/completion", suite.at(14, 35)), &rst))
+	labels = nil
+	for _, item := range rst.Items {
+		labels = append(labels, item.Label)
+	}
+	suite.Equal([]string{"ID", "Title", "Year"}, labels)
+
+	suite.Require().NoError(json.Unmarshal(
+		suite.call("textDocument/completion", suite.at(12, 4)), &rst))
+	suite.Empty(rst.Items)
+}
+
+func (suite *serverTestSuite) TestDefinition() {
+	var rst location
+	suite.Require().NoError(json.Unmarshal(
+		suite.call("textDocument/definition", suite.at(22, 50)), &rst))
+	suite.Equal(suite.uri, rst.URI)
+	suite.Equal(position{Line: 12, Character: 4}, rst.Range.Start)
+}
+
+const musicYAML = `schema:
+  name: Musics
+  mainObj: Music
+  sql: |
+    CREATE TABLE Musics (
+      ID INT NOT NULL,
+      Year INT NOT NULL,
+      PRIMARY KEY (ID));
+stmts:
+  queries:
+    - name: GetMusicsByYear
+      type: many
+      cacheDuration: 5m
+      sql: |
+        SELECT * FROM Musics
+        WHERE Year = ?;
+  mutations:
+    - name: UpdateYear
+      invalidate: GetMusicsByYear
+      sql: UPDATE Musics SET Year = ? WHERE ID = ?;
+`
+
+const musicSQL = `-- schema: musics.sql mainObj=Music
+-- name: GetMusicsByYear :many cache=5m
+SELECT * FROM Musics
+WHERE Year = ?;
+-- name: UpdateYear :mutation invalidate=GetMusicsByYear
+UPDATE Musics SET Year = ? WHERE ID = ?;
+`
+
+func (suite *serverTestSuite) TestOtherFrontEnds() {
+	dir := suite.T().TempDir()
+	suite.Require().NoError(os.WriteFile(filepath.Join(dir, "musics.sql"), []byte(
+		"CREATE TABLE Musics (ID INT NOT NULL, Year INT NOT NULL, PRIMARY KEY (ID));"), 0600))
+	for _, c := range []struct {
+		name       string
+		text       string
+		invalidate position
+		sql        position
+		definition position
+	}{
+		{"music.yaml", musicYAML, position{Line: 18, Character: 20}, position{Line: 15, Character: 14},
+			position{Line: 10, Character: 6}},
+		{"music.sql", musicSQL, position{Line: 4, Character: 50}, position{Line: 3, Character: 6},
+			position{Line: 1, Character: 0}},
+	} {
+		uri := "file://" + filepath.ToSlash(filepath.Join(dir, c.name))
+		suite.notify("textDocument/didOpen", didOpenParams{
+			TextDocument: textDocumentItem{URI: uri, Text: c.text}})
+		at := func(pos position) textDocumentPositionParams {
+			return textDocumentPositionParams{
+				TextDocument: textDocumentIdentifier{URI: uri}, Position: pos}
+		}
+		labelsAt := func(pos position) []string {
+			var rst completionList
+			suite.Require().NoError(json.Unmarshal(suite.call("textDocument/completion", at(pos)), &rst))
+			var labels []string
+			for _, item := range rst.Items {
+				labels = append(labels, item.Label)
+			}
+			return labels
+		}
+		suite.Equal([]string{"GetMusicsByYear"}, labelsAt(c.invalidate), c.name)
+		suite.Equal([]string{"ID", "Year"}, labelsAt(c.sql), c.name)
+		suite.Empty(labelsAt(position{Line: 0, Character: 2}), c.name)
+
+		var rst location
+		suite.Require().NoError(json.Unmarshal(
+			suite.call("textDocument/definition", at(c.invalidate)), &rst))
+		suite.Equal(c.definition, rst.Range.Start, c.name)
+	}
+}
@@ -0,0 +1,292 @@
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/mysql"
+
+	"github.com/stumble/needle/pkg/parser"
+	"github.com/stumble/needle/pkg/schema"
+	"github.com/stumble/needle/pkg/utils"
+)
+
+// Statement is a DDL statement of a migration.
+type Statement struct {
+	// Table that the statement changes.
+	Table string
+	SQL   string
+	// Warning is set if the statement is destructive, e.g. it may lose data, or fail
+	// on existing rows.
+	Warning string
+}
+
+// Diff returns statements that migrate tables from @p old to @p new, tables are matched
+// by name. Renamed tables and columns are seen as dropped and added ones.
+func Diff(old []schema.SQLTable, new []schema.SQLTable) ([]Statement, error) {
+	oldTables := make(map[string]*ast.CreateTableStmt)
+	for _, tb := range old {
+		stmt, err := parseTable(tb)
+		if err != nil {
+			return nil, err
+		}
+		oldTables[strings.ToLower(tb.Name())] = stmt
+	}
+	rst := make([]Statement, 0)
+	seen := make(map[string]bool)
+	for _, tb := range new {
+		stmt, err := parseTable(tb)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(tb.Name())
+		seen[name] = true
+		prev, ok := oldTables[name]
+		if !ok {
+			rst = append(rst, Statement{Table: tb.Name(), SQL: utils.RestoreNode(stmt)})
+			continue
+		}
+		rst = append(rst, DiffTable(prev, stmt)...)
+	}
+	for _, tb := range old {
+		if !seen[strings.ToLower(tb.Name())] {
+			rst = append(rst, Statement{
+				Table:   tb.Name(),
+				SQL:     "DROP TABLE " + tb.Name(),
+				Warning: fmt.Sprintf("drops table %s and all its data", tb.Name()),
+			})
+		}
+	}
+	return rst, nil
+}
+
+// DiffTable returns ALTER TABLE statements that migrate table @p old to @p new. Indexes
+// are dropped first, then columns are dropped, modified and added, and indexes are added
+// at last, so that each statement is valid on its own. Column order and table options
+// are not compared.
+func DiffTable(old *ast.CreateTableStmt, new *ast.CreateTableStmt) []Statement {
+	old, new = normalize(old), normalize(new)
+	table := new.Table.Name.O
+	alter := "ALTER TABLE " + table + " "
+	rst := make([]Statement, 0)
+
+	oldIndexes, newIndexes := indexes(old), indexes(new)
+	oldNames := indexNames(old)
+	for _, c := range old.Constraints {
+		key := indexKey(c)
+		if key == "" {
+			continue
+		}
+		if nc, ok := newIndexes[key]; ok && utils.RestoreNode(nc) == utils.RestoreNode(c) {
+			continue
+		}
+		if c.Tp == ast.ConstraintPrimaryKey {
+			rst = append(rst, Statement{Table: table, SQL: alter + "DROP PRIMARY KEY"})
+		} else {
+			rst = append(rst, Statement{Table: table, SQL: alter + "DROP INDEX " + oldNames[c]})
+		}
+	}
+
+	oldCols := make(map[string]*ast.ColumnDef)
+	for _, col := range old.Cols {
+		oldCols[col.Name.Name.L] = col
+	}
+	newCols := make(map[string]*ast.ColumnDef)
+	for _, col := range new.Cols {
+		newCols[col.Name.Name.L] = col
+	}
+	for _, col := range old.Cols {
+		if _, ok := newCols[col.Name.Name.L]; !ok {
+			rst = append(rst, Statement{
+				Table:   table,
+				SQL:     alter + "DROP COLUMN " + col.Name.Name.O,
+				Warning: fmt.Sprintf("drops column %s.%s and its data", table, col.Name.Name.O),
+			})
+		}
+	}
+	for _, col := range new.Cols {
+		prev, ok := oldCols[col.Name.Name.L]
+		if !ok || utils.RestoreNode(prev) == utils.RestoreNode(col) {
+			continue
+		}
+		rst = append(rst, Statement{
+			Table:   table,
+			SQL:     alter + "MODIFY COLUMN " + utils.RestoreNode(col),
+			Warning: modifyWarning(table, prev, col),
+		})
+	}
+	for i, col := range new.Cols {
+		if _, ok := oldCols[col.Name.Name.L]; ok {
+			continue
+		}
+		pos := " FIRST"
+		if i > 0 {
+			pos = " AFTER " + new.Cols[i-1].Name.Name.O
+		}
+		stmt := Statement{Table: table, SQL: alter + "ADD COLUMN " + utils.RestoreNode(col) + pos}
+		if notNull(col) && !hasOption(col, ast.ColumnOptionDefaultValue) &&
+			!hasOption(col, ast.ColumnOptionAutoIncrement) {
+			stmt.Warning = fmt.Sprintf(
+				"adds column %s.%s NOT NULL without default, existing rows get the zero value",
+				table, col.Name.Name.O)
+		}
+		rst = append(rst, stmt)
+	}
+
+	for _, c := range new.Constraints {
+		key := indexKey(c)
+		if key == "" {
+			continue
+		}
+		if oc, ok := oldIndexes[key]; ok && utils.RestoreNode(oc) == utils.RestoreNode(c) {
+			continue
+		}
+		stmt := Statement{Table: table, SQL: alter + "ADD " + utils.RestoreNode(c)}
+		if isUnique(c) {
+			stmt.Warning = fmt.Sprintf("adds unique index %s to %s, it fails if existing rows are duplicated",
+				key, table)
+		}
+		rst = append(rst, stmt)
+	}
+	return rst
+}
+
+func parseTable(tb schema.SQLTable) (*ast.CreateTableStmt, error) {
+	stmt, err := parser.NewSQLParser().ParseOneStmt(tb.SQL())
+	if err != nil {
+		return nil, fmt.Errorf("parse table %s: %w", tb.Name(), err)
+	}
+	create, ok := stmt.(*ast.CreateTableStmt)
+	if !ok {
+		return nil, fmt.Errorf("table %s is not a CREATE TABLE statement", tb.Name())
+	}
+	return create, nil
+}
+
+// normalize returns a copy of @p tb, where PRIMARY KEY and UNIQUE options of columns
+// are moved to constraints, as MySQL does, so that tables are compared no matter how
+// keys are declared.
+func normalize(tb *ast.CreateTableStmt) *ast.CreateTableStmt {
+	rst := *tb
+	rst.Cols = make([]*ast.ColumnDef, 0, len(tb.Cols))
+	rst.Constraints = make([]*ast.Constraint, 0, len(tb.Constraints))
+	for _, col := range tb.Cols {
+		c := *col
+		c.Options = make([]*ast.ColumnOption, 0, len(col.Options))
+		for _, op := range col.Options {
+			key := &ast.IndexPartSpecification{Column: col.Name}
+			switch op.Tp {
+			case ast.ColumnOptionPrimaryKey:
+				rst.Constraints = append(rst.Constraints, &ast.Constraint{
+					Tp: ast.ConstraintPrimaryKey, Keys: []*ast.IndexPartSpecification{key}})
+			case ast.ColumnOptionUniqKey:
+				rst.Constraints = append(rst.Constraints, &ast.Constraint{
+					Tp: ast.ConstraintUniq, Name: col.Name.Name.O,
+					Keys: []*ast.IndexPartSpecification{key}})
+			default:
+				c.Options = append(c.Options, op)
+			}
+		}
+		rst.Cols = append(rst.Cols, &c)
+	}
+	rst.Constraints = append(rst.Constraints, tb.Constraints...)
+	return &rst
+}
+
+// indexKey identifies an index across versions of a table. Unnamed indexes are
+// identified by their definition. Returns "" if @p c is not an index, e.g. a CHECK.
+func indexKey(c *ast.Constraint) string {
+	switch c.Tp {
+	case ast.ConstraintPrimaryKey:
+		return "PRIMARY"
+	case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintUniq, ast.ConstraintUniqKey,
+		ast.ConstraintUniqIndex, ast.ConstraintFulltext:
+		if c.Name == "" {
+			return utils.RestoreNode(c)
+		}
+		return strings.ToLower(c.Name)
+	}
+	return ""
+}
+
+func indexes(tb *ast.CreateTableStmt) map[string]*ast.Constraint {
+	rst := make(map[string]*ast.Constraint)
+	for _, c := range tb.Constraints {
+		if key := indexKey(c); key != "" {
+			rst[key] = c
+		}
+	}
+	return rst
+}
+
+// indexNames returns the names of the indexes of @p tb. Unnamed indexes are named the
+// way MySQL does: after their first column, suffixed by _2, _3... if the name is taken.
+func indexNames(tb *ast.CreateTableStmt) map[*ast.Constraint]string {
+	rst := make(map[*ast.Constraint]string)
+	taken := map[string]bool{"primary": true}
+	for _, c := range tb.Constraints {
+		if c.Name != "" {
+			taken[strings.ToLower(c.Name)] = true
+		}
+	}
+	for _, c := range tb.Constraints {
+		if indexKey(c) == "" || c.Tp == ast.ConstraintPrimaryKey {
+			continue
+		}
+		if c.Name != "" {
+			rst[c] = c.Name
+			continue
+		}
+		base := "functional_index"
+		if len(c.Keys) > 0 && c.Keys[0].Column != nil {
+			base = c.Keys[0].Column.Name.O
+		}
+		name := base
+		for i := 2; taken[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		taken[strings.ToLower(name)] = true
+		rst[c] = name
+	}
+	return rst
+}
+
+func isUnique(c *ast.Constraint) bool {
+	switch c.Tp {
+	case ast.ConstraintPrimaryKey, ast.ConstraintUniq, ast.ConstraintUniqKey,
+		ast.ConstraintUniqIndex:
+		return true
+	}
+	return false
+}
+
+// modifyWarning returns the warning of modifying column @p prev to @p col, or "" if
+// existing data is kept as is, e.g. the type is only widened.
+func modifyWarning(table string, prev *ast.ColumnDef, col *ast.ColumnDef) string {
+	var warnings []string
+	if narrows(prev.Tp, col.Tp) {
+		warnings = append(warnings, fmt.Sprintf(
+			"changes type of %s.%s from %s to %s, data may be truncated or fail to convert",
+			table, col.Name.Name.O, prev.Tp.CompactStr(), col.Tp.CompactStr()))
+	}
+	if !notNull(prev) && notNull(col) {
+		warnings = append(warnings, fmt.Sprintf(
+			"makes %s.%s NOT NULL, it fails if any existing row is NULL",
+			table, col.Name.Name.O))
+	}
+	return strings.Join(warnings, "; ")
+}
+
+func notNull(col *ast.ColumnDef) bool {
+	return mysql.HasNotNullFlag(col.Tp.GetFlag()) || hasOption(col, ast.ColumnOptionNotNull)
+}
+
+func hasOption(col *ast.ColumnDef, tp ast.ColumnOptionType) bool {
+	for _, op := range col.Options {
+		if op.Tp == tp {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/stumble/needle/pkg/parser"
+	"github.com/stumble/needle/pkg/schema"
+)
+
+type diffTestSuite struct {
+	suite.Suite
+}
+
+func TestDiffTestSuite(t *testing.T) {
+	suite.Run(t, new(diffTestSuite))
+}
+
+func (suite *diffTestSuite) tables(sql string) []schema.SQLTable {
+	stmts, err := parser.NewSQLParser().Parse(sql)
+	suite.Require().NoError(err)
+	rst := make([]schema.SQLTable, 0)
+	for _, stmt := range stmts {
+		rst = append(rst, schema.NewTableInfo(stmt.(*ast.CreateTableStmt), []string{}))
+	}
+	return rst
+}
+
+func (suite *diffTestSuite) TestDiff() {
+	old := suite.tables(`
+		CREATE TABLE Users (
+			ID INT NOT NULL PRIMARY KEY,
+			Name VARCHAR(64),
+			Age INT,
+			Nickname VARCHAR(32),
+			KEY idx_age (Age)
+		);
+		CREATE TABLE Tmp (ID INT);`)
+	new := suite.tables(`
+		CREATE TABLE Users (
+			ID INT NOT NULL,
+			Name VARCHAR(128) NOT NULL,
+			Age INT,
+			Email VARCHAR(255) NOT NULL,
+			CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (ID),
+			KEY idx_age (Age, Name),
+			UNIQUE KEY uniq_email (Email)
+		);
+		CREATE TABLE Posts (ID INT NOT NULL PRIMARY KEY);`)
+	stmts, err := Diff(old, new)
+	suite.Require().NoError(err)
+
+	sqls := make([]string, 0)
+	warnings := make(map[string]string)
+	for _, stmt := range stmts {
+		sqls = append(sqls, stmt.SQL)
+		warnings[stmt.SQL] = stmt.Warning
+	}
+	suite.Equal([]string{
+		"ALTER TABLE Users DROP INDEX idx_age",
+		"ALTER TABLE Users DROP COLUMN Nickname",
+		"ALTER TABLE Users MODIFY COLUMN Name VARCHAR(128) NOT NULL",
+		"ALTER TABLE Users ADD COLUMN Email VARCHAR(255) NOT NULL AFTER Age",
+		"ALTER TABLE Users ADD COLUMN CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP() AFTER Email",
+		"ALTER TABLE Users ADD INDEX idx_age(Age, Name)",
+		"ALTER TABLE Users ADD UNIQUE uniq_email(Email)",
+		"CREATE TABLE IF NOT EXISTS Posts (ID INT NOT NULL PRIMARY KEY)",
+		"DROP TABLE Tmp",
+	}, sqls)
+
+	suite.Contains(warnings["ALTER TABLE Users DROP COLUMN Nickname"], "drops column Users.Nickname")
+	// widening is safe, only NOT NULL is warned.
+	suite.Equal("makes Users.Name NOT NULL, it fails if any existing row is NULL",
+		warnings["ALTER TABLE Users MODIFY COLUMN Name VARCHAR(128) NOT NULL"])
+	suite.Contains(warnings["ALTER TABLE Users ADD COLUMN Email VARCHAR(255) NOT NULL AFTER Age"],
+		"without default")
+	suite.Empty(warnings["ALTER TABLE Users ADD COLUMN CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP() AFTER Email"])
+	suite.Contains(warnings["ALTER TABLE Users ADD UNIQUE uniq_email(Email)"], "duplicated")
+	suite.Empty(warnings["ALTER TABLE Users DROP INDEX idx_age"])
+	suite.Contains(warnings["DROP TABLE Tmp"], "drops table Tmp")
+}
+
+func (suite *diffTestSuite) TestModifyWarnings() {
+	for _, c := range []struct {
+		from, to string
+		warned   bool
+	}{
+		{"INT", "BIGINT", false},
+		{"BIGINT", "INT", true},
+		{"INT UNSIGNED", "BIGINT", false},
+		{"INT UNSIGNED", "INT", true},
+		{"INT", "INT UNSIGNED", true},
+		{"INT", "VARCHAR(16)", true},
+		{"DECIMAL(10, 2)", "DECIMAL(12, 2)", false},
+		{"DECIMAL(10, 2)", "DECIMAL(10, 4)", true},
+		{"DECIMAL(10, 2)", "DECIMAL(10, 1)", true},
+		{"FLOAT", "DOUBLE", false},
+		{"DOUBLE", "FLOAT", true},
+		{"DOUBLE", "DOUBLE(8, 2)", true},
+		{"CHAR", "CHAR(8)", false},
+		{"VARCHAR(64)", "TEXT", false},
+		{"TEXT", "VARCHAR(64)", true},
+		{"VARCHAR(64)", "VARBINARY(64)", true},
+		{"ENUM('a', 'b')", "ENUM('a', 'b', 'c')", false},
+		{"ENUM('a', 'b')", "ENUM('a', 'c')", true},
+		{"DATETIME", "DATETIME(3)", false},
+		{"DATETIME(3)", "DATETIME", true},
+		{"DATETIME", "DATE", true},
+	} {
+		stmts, err := Diff(suite.tables("CREATE TABLE T (A "+c.from+")"),
+			suite.tables("CREATE TABLE T (A "+c.to+")"))
+		suite.Require().NoError(err)
+		suite.Require().Len(stmts, 1, c.from+" -> "+c.to)
+		if c.warned {
+			suite.Contains(stmts[0].Warning, "changes type of T.A", c.from+" -> "+c.to)
+		} else {
+			suite.Empty(stmts[0].Warning, c.from+" -> "+c.to)
+		}
+	}
+}
+
+func (suite *diffTestSuite) TestDropUnnamedIndex() {
+	stmts, err := Diff(
+		suite.tables(`CREATE TABLE Users (ID INT NOT NULL PRIMARY KEY, Name VARCHAR(64), Age INT,
+			KEY Age (Name), KEY (Age), INDEX (Age, Name), UNIQUE KEY (Name))`),
+		suite.tables(`CREATE TABLE Users (ID INT NOT NULL PRIMARY KEY, Name VARCHAR(64), Age INT,
+			KEY Age (Name), INDEX (Age, ID))`))
+	suite.Require().NoError(err)
+	sqls := make([]string, 0)
+	for _, stmt := range stmts {
+		sqls = append(sqls, stmt.SQL)
+	}
+	// Age is taken by the named index, so MySQL names the unnamed ones Age_2, Age_3.
+	suite.Equal([]string{
+		"ALTER TABLE Users DROP INDEX Age_2",
+		"ALTER TABLE Users DROP INDEX Age_3",
+		"ALTER TABLE Users DROP INDEX Name",
+		"ALTER TABLE Users ADD INDEX(Age, ID)",
+	}, sqls)
+}
+
+func (suite *diffTestSuite) TestNoChange() {
+	stmts, err := Diff(
+		suite.tables("CREATE TABLE Users (ID INT NOT NULL PRIMARY KEY, Email VARCHAR(255) UNIQUE)"),
+		suite.tables(`CREATE TABLE Users (ID INT NOT NULL, Email VARCHAR(255),
+			PRIMARY KEY (ID), UNIQUE KEY Email (Email))`))
+	suite.Require().NoError(err)
+	suite.Empty(stmts)
+}
+
+// TestReplay checks that the migration replayed over the old table is the new table.
+func (suite *diffTestSuite) TestReplay() {
+	oldSQL := `CREATE TABLE Orders (
+		ID BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		UserID INT NOT NULL,
+		Note TEXT,
+		KEY idx_user (UserID)
+	)`
+	new := suite.tables(`CREATE TABLE Orders (
+		ID BIGINT NOT NULL AUTO_INCREMENT,
+		Status ENUM('new', 'paid') NOT NULL DEFAULT 'new',
+		UserID BIGINT NOT NULL,
+		PRIMARY KEY (ID),
+		KEY idx_user_status (UserID, Status)
+	)`)
+	stmts, err := Diff(suite.tables(oldSQL), new)
+	suite.Require().NoError(err)
+
+	p := parser.NewSQLParser()
+	replayer := parser.NewReplayer()
+	for _, sql := range append([]string{oldSQL}, func() (rst []string) {
+		for _, stmt := range stmts {
+			rst = append(rst, stmt.SQL)
+		}
+		return
+	}()...) {
+		stmt, err := p.ParseOneStmt(sql)
+		suite.Require().NoError(err)
+		suite.Require().NoError(replayer.Apply(stmt))
+	}
+	replayed := []schema.SQLTable{schema.NewTableInfo(replayer.Tables()[0], []string{})}
+	stmts, err = Diff(replayed, new)
+	suite.Require().NoError(err)
+	suite.Empty(stmts)
+}
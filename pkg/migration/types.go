@@ -0,0 +1,143 @@
+package migration
+
+import (
+	"github.com/pingcap/tidb/parser/charset"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/types"
+)
+
+// typeClass is a group of types that values convert between without changing their
+// representation, e.g. integers of all sizes, or character strings.
+type typeClass int
+
+const (
+	classOther typeClass = iota
+	classInt
+	classDecimal
+	classFloat
+	classString
+	classBinary
+	classBit
+	classEnum
+	classSet
+)
+
+func classOf(tp *types.FieldType) typeClass {
+	switch tp.GetType() {
+	case mysql.TypeTiny, mysql.TypeShort, mysql.TypeInt24, mysql.TypeLong, mysql.TypeLonglong:
+		return classInt
+	case mysql.TypeNewDecimal:
+		return classDecimal
+	case mysql.TypeFloat, mysql.TypeDouble:
+		return classFloat
+	case mysql.TypeVarchar, mysql.TypeString, mysql.TypeVarString, mysql.TypeTinyBlob,
+		mysql.TypeBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob:
+		if mysql.HasBinaryFlag(tp.GetFlag()) || tp.GetCharset() == charset.CharsetBin {
+			return classBinary
+		}
+		return classString
+	case mysql.TypeBit:
+		return classBit
+	case mysql.TypeEnum:
+		return classEnum
+	case mysql.TypeSet:
+		return classSet
+	}
+	return classOther
+}
+
+// intBytes is the storage size of integer types.
+var intBytes = map[byte]int{
+	mysql.TypeTiny:     1,
+	mysql.TypeShort:    2,
+	mysql.TypeInt24:    3,
+	mysql.TypeLong:     4,
+	mysql.TypeLonglong: 8,
+}
+
+// blobLength is the max length of TEXT and BLOB types whose length is not specified.
+var blobLength = map[byte]int{
+	mysql.TypeTinyBlob:   1<<8 - 1,
+	mysql.TypeBlob:       1<<16 - 1,
+	mysql.TypeMediumBlob: 1<<24 - 1,
+	mysql.TypeLongBlob:   1<<32 - 1,
+}
+
+// length of @p tp, @p def if it is not specified.
+func length(tp *types.FieldType, def int) int {
+	if tp.GetFlen() == types.UnspecifiedLength {
+		return def
+	}
+	return tp.GetFlen()
+}
+
+// stringLength is the max length of the string type @p tp, CHAR is CHAR(1).
+func stringLength(tp *types.FieldType) int {
+	if n, ok := blobLength[tp.GetType()]; ok {
+		return length(tp, n)
+	}
+	return length(tp, 1)
+}
+
+func decimals(tp *types.FieldType, def int) int {
+	if tp.GetDecimal() == types.UnspecifiedLength {
+		return def
+	}
+	return tp.GetDecimal()
+}
+
+func unsigned(tp *types.FieldType) bool {
+	return mysql.HasUnsignedFlag(tp.GetFlag())
+}
+
+// narrows returns true if some values of @p prev may not be kept as is by @p tp, i.e.
+// the type changes its class, or gets shorter, less precise, or of another signedness
+// that cannot hold all values. Types of other classes, e.g. DATETIME, narrow on any
+// change but more fractional digits.
+func narrows(prev *types.FieldType, tp *types.FieldType) bool {
+	class := classOf(prev)
+	if class != classOf(tp) {
+		return true
+	}
+	switch class {
+	case classInt:
+		size, prevSize := intBytes[tp.GetType()], intBytes[prev.GetType()]
+		if unsigned(prev) == unsigned(tp) {
+			return size < prevSize
+		}
+		// unsigned values fit in a wider signed type, negative ones never fit.
+		return unsigned(tp) || size <= prevSize
+	case classDecimal:
+		// DECIMAL is DECIMAL(10, 0).
+		digits, prevDigits := decimals(tp, 0), decimals(prev, 0)
+		return length(tp, 10)-digits < length(prev, 10)-prevDigits || digits < prevDigits ||
+			(unsigned(tp) && !unsigned(prev))
+	case classFloat:
+		if tp.GetType() == mysql.TypeFloat && prev.GetType() == mysql.TypeDouble {
+			return true
+		}
+		// FLOAT(M, D) is rounded to D digits, FLOAT is not.
+		digits := decimals(tp, types.UnspecifiedLength)
+		if digits != types.UnspecifiedLength &&
+			(digits < decimals(prev, digits+1) || length(tp, 0) < length(prev, 0)) {
+			return true
+		}
+		return unsigned(tp) && !unsigned(prev)
+	case classString, classBinary:
+		return stringLength(tp) < stringLength(prev)
+	case classBit:
+		return length(tp, 1) < length(prev, 1)
+	case classEnum, classSet:
+		elems := make(map[string]bool)
+		for _, e := range tp.GetElems() {
+			elems[e] = true
+		}
+		for _, e := range prev.GetElems() {
+			if !elems[e] {
+				return true
+			}
+		}
+		return false
+	}
+	return tp.GetType() != prev.GetType() || decimals(tp, 0) < decimals(prev, 0)
+}
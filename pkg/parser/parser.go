@@ -1,6 +1,10 @@
 package parser
 
 import (
+	"regexp"
+	"strconv"
+	"strings"
+
 	"github.com/davecgh/go-spew/spew"
 	"github.com/pingcap/tidb/parser"
 	"github.com/pingcap/tidb/parser/ast"
@@ -40,10 +44,54 @@ func (s *SQLParser) ParseOneStmt(stmt string) (ast.StmtNode, error) {
 	return rst, nil
 }
 
-// // Parse - parse statements
-// func (s *SQLParser) Parse(stmt string) ([]ast.StmtNode, []error, error) {
-// 	return s.parser.Parse(stmt, "utf8", "")
-// }
+// maxNearLen is the max length of the "near" text in syntax errors of TiDB's parser.
+const maxNearLen = 2048
+
+var syntaxErrRegexp = regexp.MustCompile(`(?s)line (\d+) column (\d+) near "(.*)"`)
+
+// ErrorOffset returns the byte offset in @p sql where the syntax error @p err is found.
+// Returns false if err is not a syntax error.
+func ErrorOffset(sql string, err error) (int, bool) {
+	m := syntaxErrRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0, false
+	}
+	near := m[3]
+	// near is the rest of input, starting from the error token.
+	if len(near) < maxNearLen && strings.HasSuffix(sql, near) {
+		return len(sql) - len(near), true
+	}
+	line, _ := strconv.Atoi(m[1])
+	col, _ := strconv.Atoi(m[2])
+	offset := 0
+	for i := 1; i < line; i++ {
+		next := strings.IndexByte(sql[offset:], '\n')
+		if next < 0 {
+			break
+		}
+		offset += next + 1
+	}
+	offset += col
+	if offset > len(sql) {
+		offset = len(sql)
+	}
+	return offset, true
+}
+
+// Parse - parse all statements, e.g. of a DDL file.
+// Like ParseOneStmt, column flags of create table statements are set.
+func (s *SQLParser) Parse(sql string) ([]ast.StmtNode, error) {
+	rst, _, err := s.parser.Parse(sql, "utf8", "")
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range rst {
+		if tb, ok := stmt.(*ast.CreateTableStmt); ok {
+			setFlags(tb)
+		}
+	}
+	return rst, nil
+}
 
 func setFlags(tb *ast.CreateTableStmt) {
 	for _, col := range tb.Cols {
@@ -67,3 +115,14 @@ func setFlags(tb *ast.CreateTableStmt) {
 		}
 	}
 }
+
+// ColumnOffset returns the byte offset in @p sql, a CREATE TABLE statement, where the
+// definition of @p column starts, 0 if it is not found.
+func ColumnOffset(sql string, column string) int {
+	re := regexp.MustCompile("(?i)[(,]\\s*(`?" + regexp.QuoteMeta(column) + "`?\\s)")
+	m := re.FindStringSubmatchIndex(sql)
+	if m == nil {
+		return 0
+	}
+	return m[2]
+}
@@ -0,0 +1,322 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/tidb/parser/ast"
+
+	"github.com/stumble/needle/pkg/utils"
+)
+
+// Replayer computes the final definitions of tables by replaying DDL statements, e.g.
+// of a directory of migrations, over CREATE TABLE statements.
+type Replayer struct {
+	tables []*ast.CreateTableStmt
+}
+
+// NewReplayer - a replayer of no table.
+func NewReplayer() *Replayer {
+	return &Replayer{}
+}
+
+// Tables - current definitions of tables, in the order they are created.
+func (r *Replayer) Tables() []*ast.CreateTableStmt {
+	return r.tables
+}
+
+// Apply @p stmt to tables. Supported are CREATE TABLE, DROP TABLE, RENAME TABLE,
+// CREATE INDEX, DROP INDEX, and ALTER TABLE that adds, drops, modifies, changes or
+// renames columns, adds or drops indexes, or renames the table. Statements that are
+// not DDL, e.g. INSERT or SET, are ignored, and so are TRUNCATE, views and locks. Other
+// DDL statements are errors, as they may change tables in ways that are not replayed.
+func (r *Replayer) Apply(stmt ast.StmtNode) error {
+	switch v := stmt.(type) {
+	case *ast.CreateTableStmt:
+		if r.find(v.Table.Name.O) >= 0 {
+			if v.IfNotExists {
+				return nil
+			}
+			return fmt.Errorf("table %s already exists", v.Table.Name.O)
+		}
+		if v.ReferTable != nil || v.Select != nil {
+			return fmt.Errorf("CREATE TABLE %s with LIKE or SELECT is not supported", v.Table.Name.O)
+		}
+		r.tables = append(r.tables, v)
+	case *ast.DropTableStmt:
+		if v.IsView {
+			return nil
+		}
+		for _, tb := range v.Tables {
+			i := r.find(tb.Name.O)
+			if i < 0 {
+				if v.IfExists {
+					continue
+				}
+				return fmt.Errorf("unknown table %s", tb.Name.O)
+			}
+			r.tables = append(r.tables[:i], r.tables[i+1:]...)
+		}
+	case *ast.RenameTableStmt:
+		for _, t2t := range v.TableToTables {
+			if err := r.renameTable(t2t.OldTable.Name.O, t2t.NewTable); err != nil {
+				return err
+			}
+		}
+	case *ast.AlterTableStmt:
+		i := r.find(v.Table.Name.O)
+		if i < 0 {
+			return fmt.Errorf("unknown table %s", v.Table.Name.O)
+		}
+		for _, spec := range v.Specs {
+			if err := r.alter(r.tables[i], spec); err != nil {
+				return fmt.Errorf("ALTER TABLE %s: %w", v.Table.Name.O, err)
+			}
+		}
+	case *ast.CreateIndexStmt:
+		i := r.find(v.Table.Name.O)
+		if i < 0 {
+			return fmt.Errorf("unknown table %s", v.Table.Name.O)
+		}
+		tp := ast.ConstraintIndex
+		switch v.KeyType {
+		case ast.IndexKeyTypeUnique:
+			tp = ast.ConstraintUniq
+		case ast.IndexKeyTypeFullText:
+			tp = ast.ConstraintFulltext
+		}
+		if v.IfNotExists && findConstraint(r.tables[i], v.IndexName) >= 0 {
+			return nil
+		}
+		option := v.IndexOption
+		if option != nil && option.KeyBlockSize == 0 && option.Tp == 0 && option.Comment == "" &&
+			option.ParserName.O == "" && option.Visibility == ast.IndexVisibilityDefault {
+			// CREATE INDEX always has an option, which is restored as a space if empty.
+			option = nil
+		}
+		spec := &ast.AlterTableSpec{Tp: ast.AlterTableAddConstraint, Constraint: &ast.Constraint{
+			Tp: tp, Name: v.IndexName, Keys: v.IndexPartSpecifications, Option: option}}
+		if err := r.alter(r.tables[i], spec); err != nil {
+			return fmt.Errorf("CREATE INDEX %s: %w", v.IndexName, err)
+		}
+	case *ast.DropIndexStmt:
+		i := r.find(v.Table.Name.O)
+		if i < 0 {
+			return fmt.Errorf("unknown table %s", v.Table.Name.O)
+		}
+		spec := &ast.AlterTableSpec{Tp: ast.AlterTableDropIndex, Name: v.IndexName, IfExists: v.IfExists}
+		if err := r.alter(r.tables[i], spec); err != nil {
+			return fmt.Errorf("DROP INDEX %s: %w", v.IndexName, err)
+		}
+	case *ast.TruncateTableStmt, *ast.CreateViewStmt, *ast.LockTablesStmt, *ast.UnlockTablesStmt:
+		// rows, views and locks are not definitions of tables.
+	case ast.DDLNode:
+		return fmt.Errorf("unsupported DDL: %s", utils.RestoreNode(stmt))
+	}
+	return nil
+}
+
+func (r *Replayer) find(name string) int {
+	for i, tb := range r.tables {
+		if strings.EqualFold(tb.Table.Name.O, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Replayer) renameTable(name string, to *ast.TableName) error {
+	i := r.find(name)
+	if i < 0 {
+		return fmt.Errorf("unknown table %s", name)
+	}
+	if r.find(to.Name.O) >= 0 {
+		return fmt.Errorf("table %s already exists", to.Name.O)
+	}
+	r.tables[i].Table = to
+	return nil
+}
+
+func (r *Replayer) alter(tb *ast.CreateTableStmt, spec *ast.AlterTableSpec) error {
+	switch spec.Tp {
+	case ast.AlterTableAddColumns:
+		for _, col := range spec.NewColumns {
+			if findColumn(tb, col.Name.Name.O) >= 0 {
+				if spec.IfNotExists {
+					continue
+				}
+				return fmt.Errorf("duplicated column name: %s", col.Name.Name.O)
+			}
+			if err := insertColumn(tb, col, spec.Position); err != nil {
+				return err
+			}
+		}
+		tb.Constraints = append(tb.Constraints, spec.NewConstraints...)
+	case ast.AlterTableDropColumn:
+		i := findColumn(tb, spec.OldColumnName.Name.O)
+		if i < 0 {
+			if spec.IfExists {
+				return nil
+			}
+			return fmt.Errorf("unknown column %s", spec.OldColumnName.Name.O)
+		}
+		tb.Cols = append(tb.Cols[:i], tb.Cols[i+1:]...)
+		dropKeyColumn(tb, spec.OldColumnName.Name.O)
+	case ast.AlterTableModifyColumn:
+		return replaceColumn(tb, spec.NewColumns[0].Name.Name.O, spec.NewColumns[0], spec.Position)
+	case ast.AlterTableChangeColumn:
+		return replaceColumn(tb, spec.OldColumnName.Name.O, spec.NewColumns[0], spec.Position)
+	case ast.AlterTableRenameColumn:
+		i := findColumn(tb, spec.OldColumnName.Name.O)
+		if i < 0 {
+			return fmt.Errorf("unknown column %s", spec.OldColumnName.Name.O)
+		}
+		if findColumn(tb, spec.NewColumnName.Name.O) >= 0 {
+			return fmt.Errorf("duplicated column name: %s", spec.NewColumnName.Name.O)
+		}
+		renameKeyColumn(tb, spec.OldColumnName.Name.O, spec.NewColumnName)
+		tb.Cols[i].Name = spec.NewColumnName
+	case ast.AlterTableAddConstraint:
+		if name := spec.Constraint.Name; name != "" && findConstraint(tb, name) >= 0 {
+			return fmt.Errorf("duplicated key name %s", name)
+		}
+		tb.Constraints = append(tb.Constraints, spec.Constraint)
+	case ast.AlterTableDropPrimaryKey:
+		dropConstraints(tb, func(c *ast.Constraint) bool { return c.Tp == ast.ConstraintPrimaryKey })
+		for _, col := range tb.Cols {
+			col.Options = dropColumnOptions(col.Options, ast.ColumnOptionPrimaryKey)
+		}
+	case ast.AlterTableDropIndex:
+		if !dropConstraints(tb, func(c *ast.Constraint) bool {
+			return c.Tp != ast.ConstraintPrimaryKey && strings.EqualFold(c.Name, spec.Name)
+		}) && !spec.IfExists {
+			return fmt.Errorf("unknown index %s", spec.Name)
+		}
+	case ast.AlterTableRenameIndex:
+		for _, c := range tb.Constraints {
+			if strings.EqualFold(c.Name, spec.FromKey.O) {
+				c.Name = spec.ToKey.O
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown index %s", spec.FromKey.O)
+	case ast.AlterTableRenameTable:
+		return r.renameTable(tb.Table.Name.O, spec.NewTable)
+	case ast.AlterTableOption, ast.AlterTableAlterColumn, ast.AlterTableLock, ast.AlterTableAlgorithm:
+		// table options, defaults, locks and algorithms do not change columns.
+	default:
+		return fmt.Errorf("unsupported alter: %s", utils.RestoreNode(spec))
+	}
+	return nil
+}
+
+func findColumn(tb *ast.CreateTableStmt, name string) int {
+	for i, col := range tb.Cols {
+		if strings.EqualFold(col.Name.Name.O, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findConstraint returns the index of the constraint @p name of @p tb, -1 if none.
+func findConstraint(tb *ast.CreateTableStmt, name string) int {
+	for i, c := range tb.Constraints {
+		if c.Tp != ast.ConstraintPrimaryKey && strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertColumn inserts @p col at @p pos, the end of columns if pos is nil.
+func insertColumn(tb *ast.CreateTableStmt, col *ast.ColumnDef, pos *ast.ColumnPosition) error {
+	at := len(tb.Cols)
+	if pos != nil {
+		switch pos.Tp {
+		case ast.ColumnPositionFirst:
+			at = 0
+		case ast.ColumnPositionAfter:
+			at = findColumn(tb, pos.RelativeColumn.Name.O) + 1
+			if at == 0 {
+				return fmt.Errorf("unknown column %s", pos.RelativeColumn.Name.O)
+			}
+		}
+	}
+	tb.Cols = append(tb.Cols, nil)
+	copy(tb.Cols[at+1:], tb.Cols[at:])
+	tb.Cols[at] = col
+	return nil
+}
+
+// replaceColumn replaces column @p name with @p col, which is moved to @p pos if set.
+func replaceColumn(tb *ast.CreateTableStmt, name string, col *ast.ColumnDef,
+	pos *ast.ColumnPosition) error {
+	i := findColumn(tb, name)
+	if i < 0 {
+		return fmt.Errorf("unknown column %s", name)
+	}
+	if j := findColumn(tb, col.Name.Name.O); j >= 0 && j != i {
+		return fmt.Errorf("duplicated column name: %s", col.Name.Name.O)
+	}
+	renameKeyColumn(tb, name, col.Name)
+	if pos == nil || pos.Tp == ast.ColumnPositionNone {
+		tb.Cols[i] = col
+		return nil
+	}
+	tb.Cols = append(tb.Cols[:i], tb.Cols[i+1:]...)
+	return insertColumn(tb, col, pos)
+}
+
+// dropKeyColumn removes column @p name from indexes, an index is dropped if no column
+// is left, like MySQL.
+func dropKeyColumn(tb *ast.CreateTableStmt, name string) {
+	emptied := make(map[*ast.Constraint]bool)
+	for _, c := range tb.Constraints {
+		if len(c.Keys) == 0 {
+			continue
+		}
+		keys := make([]*ast.IndexPartSpecification, 0, len(c.Keys))
+		for _, key := range c.Keys {
+			if key.Column == nil || !strings.EqualFold(key.Column.Name.O, name) {
+				keys = append(keys, key)
+			}
+		}
+		c.Keys = keys
+		emptied[c] = len(keys) == 0
+	}
+	dropConstraints(tb, func(c *ast.Constraint) bool { return emptied[c] })
+}
+
+func renameKeyColumn(tb *ast.CreateTableStmt, name string, to *ast.ColumnName) {
+	for _, c := range tb.Constraints {
+		for _, key := range c.Keys {
+			if key.Column != nil && strings.EqualFold(key.Column.Name.O, name) {
+				key.Column = to
+			}
+		}
+	}
+}
+
+// dropConstraints drops constraints that @p match, returns true if any.
+func dropConstraints(tb *ast.CreateTableStmt, match func(c *ast.Constraint) bool) bool {
+	rst := make([]*ast.Constraint, 0, len(tb.Constraints))
+	for _, c := range tb.Constraints {
+		if !match(c) {
+			rst = append(rst, c)
+		}
+	}
+	dropped := len(rst) != len(tb.Constraints)
+	tb.Constraints = rst
+	return dropped
+}
+
+func dropColumnOptions(options []*ast.ColumnOption, tp ast.ColumnOptionType) []*ast.ColumnOption {
+	rst := make([]*ast.ColumnOption, 0, len(options))
+	for _, op := range options {
+		if op.Tp != tp {
+			rst = append(rst, op)
+		}
+	}
+	return rst
+}
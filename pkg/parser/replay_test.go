@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/stumble/needle/pkg/utils"
+)
+
+type replayTestSuite struct {
+	suite.Suite
+}
+
+func TestReplayTestSuite(t *testing.T) {
+	suite.Run(t, new(replayTestSuite))
+}
+
+func (suite *replayTestSuite) replay(sql string) (*Replayer, error) {
+	stmts, err := NewSQLParser().Parse(sql)
+	suite.Require().NoError(err)
+	replayer := NewReplayer()
+	for _, stmt := range stmts {
+		if err := replayer.Apply(stmt); err != nil {
+			return replayer, err
+		}
+	}
+	return replayer, nil
+}
+
+func (suite *replayTestSuite) TestReplay() {
+	replayer, err := suite.replay(`
+		CREATE TABLE Users (ID INT NOT NULL, Name VARCHAR(64), Age INT, PRIMARY KEY (ID));
+		CREATE TABLE Tmp (ID INT);
+		ALTER TABLE Users ADD COLUMN Email VARCHAR(255) NOT NULL AFTER Name, ADD INDEX idx_age (Age);
+		ALTER TABLE Users MODIFY COLUMN Name VARCHAR(128) NOT NULL;
+		ALTER TABLE Users RENAME COLUMN Age TO Years;
+		ALTER TABLE Users ADD COLUMN CreatedAt DATETIME FIRST;
+		ALTER TABLE Users DROP COLUMN Email;
+		INSERT INTO Users (ID) VALUES (1);
+		DROP TABLE Tmp;`)
+	suite.Require().NoError(err)
+	suite.Require().Len(replayer.Tables(), 1)
+	suite.Equal("CREATE TABLE Users (CreatedAt DATETIME,ID INT NOT NULL,Name VARCHAR(128) NOT NULL,"+
+		"Years INT,PRIMARY KEY(ID),INDEX idx_age(Years))", utils.RestoreNode(replayer.Tables()[0]))
+}
+
+func (suite *replayTestSuite) TestErrors() {
+	_, err := suite.replay(`CREATE TABLE Users (ID INT); ALTER TABLE Users DROP COLUMN Name;`)
+	suite.EqualError(err, "ALTER TABLE Users: unknown column Name")
+
+	_, err = suite.replay(`CREATE TABLE Users (ID INT); CREATE TABLE Users (ID INT);`)
+	suite.EqualError(err, "table Users already exists")
+
+	_, err = suite.replay(`ALTER TABLE Users ADD COLUMN Name INT;`)
+	suite.EqualError(err, "unknown table Users")
+
+	replayer, err := suite.replay(`CREATE TABLE Users (ID INT, Name INT, INDEX idx_name (Name));
+		ALTER TABLE Users DROP COLUMN Name; DROP TABLE IF EXISTS Orders;`)
+	suite.Require().NoError(err)
+	suite.Empty(replayer.Tables()[0].Constraints)
+}
+
+func (suite *replayTestSuite) TestIndexes() {
+	replayer, err := suite.replay(`
+		CREATE TABLE Users (ID INT NOT NULL, Name VARCHAR(64), Age INT, PRIMARY KEY (ID));
+		CREATE INDEX idx_name ON Users (Name);
+		CREATE UNIQUE INDEX idx_age ON Users (Age);
+		CREATE INDEX IF NOT EXISTS idx_name ON Users (Name, Age);
+		DROP INDEX idx_age ON Users;
+		SET NAMES utf8mb4;
+		UPDATE Users SET Age = 1;`)
+	suite.Require().NoError(err)
+	suite.Equal("CREATE TABLE Users (ID INT NOT NULL,Name VARCHAR(64),Age INT,PRIMARY KEY(ID),"+
+		"INDEX idx_name(Name))", utils.RestoreNode(replayer.Tables()[0]))
+
+	_, err = suite.replay(`CREATE TABLE Users (ID INT, INDEX idx_id (ID)); CREATE INDEX idx_id ON Users (ID);`)
+	suite.EqualError(err, "CREATE INDEX idx_id: duplicated key name idx_id")
+
+	_, err = suite.replay(`CREATE TABLE Users (ID INT); DROP INDEX idx_id ON Users;`)
+	suite.EqualError(err, "DROP INDEX idx_id: unknown index idx_id")
+
+	_, err = suite.replay(`CREATE INDEX idx_id ON Users (ID);`)
+	suite.EqualError(err, "unknown table Users")
+
+	// DDL that is not replayed is an error rather than ignored.
+	_, err = suite.replay(`CREATE TABLE Users (ID INT); TRUNCATE TABLE Users; CREATE DATABASE Shop;`)
+	suite.EqualError(err, "unsupported DDL: CREATE DATABASE Shop")
+}
@@ -1,13 +1,19 @@
 package passes
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/iancoleman/strcase"
 
 	"github.com/stumble/needle/pkg/codegen"
+	"github.com/stumble/needle/pkg/config"
+	"github.com/stumble/needle/pkg/diagnostic"
 	"github.com/stumble/needle/pkg/driver"
+	"github.com/stumble/needle/pkg/parser"
 	"github.com/stumble/needle/pkg/schema"
 	"github.com/stumble/needle/pkg/utils"
 	"github.com/stumble/needle/pkg/vcs"
@@ -20,6 +26,20 @@ type GoParam = visitors.GoParam
 // GoVar -
 type GoVar = visitors.GoVar
 
+var compilerError = visitors.ErrCompilerError.String()
+
+// staticImports are packages that the repo template always imports.
+var staticImports = []string{
+	"context", "database/sql", "strings", "time", "fmt", "reflect", "strconv", "errors",
+	"encoding/json",
+}
+
+// predeclaredPkgs are packages of types that needle derives from SQL types, other
+// packages are of mapped user types.
+var predeclaredPkgs = map[string]bool{
+	"": true, "time": true, "encoding/json": true, "database/sql": true,
+}
+
 // QuerySocket the gateway between go code and sql query.
 type QuerySocket struct {
 	Query  *driver.Query
@@ -33,25 +53,68 @@ type MutationSocket struct {
 	Params   []GoParam
 }
 
+// MainStruct is the main struct of a main table.
+type MainStruct struct {
+	Table  schema.SQLTable
+	Struct *codegen.GoStruct
+}
+
 // CodegenPass - prepare for codegen.
 type CodegenPass struct {
-	Code string
+	// Output overrides names of the generated code, on top of the ones in config.
+	Output config.Output
+
+	Code    string
+	PkgName string
+
+	// types resolves Go types of fields, set by Run.
+	types *TypeMap
 }
 
-// GenQuerySockets for queries.
+// outputNames returns names of the generated code, defaults are derived from the schema name.
+func (c *CodegenPass) outputNames(repo *driver.Repo) (config.Output, error) {
+	mainName := repo.Config.Schema.Name
+	names := config.Output{
+		Package:     strings.ToLower(mainName) + "repo",
+		Interface:   mainName,
+		Constructor: "New" + mainName,
+		ImplStruct:  strings.ToLower(mainName[0:1]) + mainName[1:],
+	}
+	names = names.Merge(repo.Config.Output).Merge(c.Output)
+	if err := names.IsValid(); err != nil {
+		return names, err
+	}
+	for _, name := range []string{names.Interface, names.Constructor, names.ImplStruct} {
+		for _, main := range repo.Config.Schema.MainTables() {
+			if name == main.MainObj {
+				return names, fmt.Errorf("%s conflicts with the mainObj name", name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// GenQuerySockets for queries. Poisoned queries are skipped, queries that failed are
+// poisoned, and their diagnostics are returned as a diagnostic.List error.
 func (c *CodegenPass) GenQuerySockets(queries []*driver.Query) ([]QuerySocket, error) {
+	var diags diagnostic.List
 	querySockets := make([]QuerySocket, 0)
 	for i, q := range queries {
+		if q.Poisoned() {
+			continue
+		}
 		paramExtract := visitors.NewParamExtractVisitor()
 		q.Node.Accept(paramExtract)
 		if paramExtract.Errors() != nil {
-			return nil, mergeErrors(paramExtract.Errors())
+			diags = append(diags, queryStmt(q).poison(paramExtract.Errors())...)
+			continue
 		}
 
 		outputExtract := visitors.NewOutputExtractVisitor()
 		q.Node.Accept(outputExtract)
 		if outputExtract.Errors() != nil {
-			return nil, mergeErrors(outputExtract.Errors())
+			diags = append(diags, queryStmt(q).poison(outputExtract.Errors())...)
+			continue
 		}
 
 		querySockets = append(querySockets, QuerySocket{
@@ -60,17 +123,36 @@ func (c *CodegenPass) GenQuerySockets(queries []*driver.Query) ([]QuerySocket, e
 			Output: outputExtract.Output,
 		})
 	}
-	return querySockets, nil
+	return querySockets, diags.Err()
 }
 
-// GenMutationSockets for mutations.
+// GenMutationSockets for mutations. Like queries, mutations that failed, or invalidate
+// any poisoned query, are poisoned and skipped.
 func (c *CodegenPass) GenMutationSockets(mutations []*driver.Mutation) ([]MutationSocket, error) {
+	var diags diagnostic.List
 	sockets := make([]MutationSocket, 0)
 	for i, q := range mutations {
+		if q.Poisoned() {
+			continue
+		}
+		var invalid diagnostic.List
+		for _, inv := range q.Invalidates {
+			if inv.Poisoned() {
+				invalid.Errorf(diagnostic.CategoryConfig, q.Config.Pos, q.Config.Name,
+					"invalidated query %s failed to compile", inv.Config.Name)
+			}
+		}
+		if invalid != nil {
+			q.Poison(invalid)
+			diags = append(diags, invalid...)
+			continue
+		}
+
 		paramExtract := visitors.NewParamExtractVisitor()
 		q.Node.Accept(paramExtract)
 		if paramExtract.Errors() != nil {
-			return nil, mergeErrors(paramExtract.Errors())
+			diags = append(diags, mutationStmt(q).poison(paramExtract.Errors())...)
+			continue
 		}
 
 		sockets = append(sockets, MutationSocket{
@@ -78,40 +160,52 @@ func (c *CodegenPass) GenMutationSockets(mutations []*driver.Mutation) ([]Mutati
 			Params:   paramExtract.Params,
 		})
 	}
-	return sockets, nil
+	return sockets, diags.Err()
 }
 
-// GenQueryFuncs from query sockets.
-func (c *CodegenPass) GenQueryFuncs(mainStruct *codegen.GoStruct, mainTable schema.SQLTable,
-	querySockets []QuerySocket) (queryFuncs []*codegen.QueryFunc) {
+// GenQueryFuncs from query sockets. The output is a main struct if it covers it.
+// Queries of invalid cache durations are skipped, and reported as a diagnostic.List.
+func (c *CodegenPass) GenQueryFuncs(mainStructs []MainStruct,
+	querySockets []QuerySocket) (queryFuncs []*codegen.QueryFunc, err error) {
+	var diags diagnostic.List
 	for _, query := range querySockets {
 		queryName := query.Query.Config.Name
+		cacheDuration, err := query.Query.Config.CacheDuration()
+		if err != nil {
+			diags.Errorf(diagnostic.CategoryConfig, query.Query.Config.CacheDurationPos,
+				queryName, "invalid cacheDuration: %s", err)
+			continue
+		}
 		var outputStruct *codegen.GoStruct
-		if canStarCoverOutput(mainTable, query.Output) {
-			outputStruct = mainStruct
-		} else {
-			outputStruct = GenOutputStruct(queryName+"Rst", query.Output)
+		for _, main := range mainStructs {
+			if canStarCoverOutput(main.Table, query.Output) {
+				outputStruct = main.Struct
+				break
+			}
+		}
+		if outputStruct == nil {
+			outputStruct = GenOutputStruct(queryName+"Rst", query.Output, c.types)
 		}
 		// XXX(yumin): MYSQL does not allow value = NULL, must use 'is NULL'.
 		// so arguments cannot be null.
-		inputStruct := GenInputStruct(queryName+"Args", query.Params)
+		inputStruct := GenInputStruct(queryName+"Args", query.Params, c.types)
 		queryFuncs = append(queryFuncs, &codegen.QueryFunc{
 			Name:          queryName,
 			SQL:           utils.RestoreNode(query.Query.Node),
-			CacheDuration: query.Query.Config.CacheDuration(),
+			CacheDuration: cacheDuration,
 			Input:         inputStruct,
 			Output:        outputStruct,
 			IsList:        !query.Query.Config.IsSingleRow(),
 		})
 	}
-	return
+	return queryFuncs, diags.Err()
 }
 
-// GenMutationFuncs from mutation sockets.
+// GenMutationFuncs from mutation sockets. Like queries, params can be a main struct.
 func (c *CodegenPass) GenMutationFuncs(
-	mainStruct *codegen.GoStruct, mainTable schema.SQLTable,
+	mainStructs []MainStruct,
 	mutationSockets []MutationSocket,
-	queryFuncs []*codegen.QueryFunc) (rst []*codegen.MutationFunc) {
+	queryFuncs []*codegen.QueryFunc) (rst []*codegen.MutationFunc, err error) {
 	queryMap := make(map[string]*codegen.QueryFunc)
 	for i, query := range queryFuncs {
 		queryMap[query.Name] = queryFuncs[i]
@@ -122,17 +216,24 @@ func (c *CodegenPass) GenMutationFuncs(
 
 		// XXX(yumin): add this part for insert.
 		var params *codegen.GoStruct
-		if canStarCoverInput(mainTable, mutation.Params) {
-			params = mainStruct
-		} else {
-			params = GenInputStruct(name+"Args", mutation.Params)
+		for _, main := range mainStructs {
+			if canStarCoverInput(main.Table, mutation.Params) {
+				params = main.Struct
+				break
+			}
+		}
+		if params == nil {
+			params = GenInputStruct(name+"Args", mutation.Params, c.types)
 		}
 
 		invalidateParams := make([]*codegen.QueryFunc, 0)
 		for _, invalidate := range mutation.Mutation.Invalidates {
 			query, ok := queryMap[invalidate.Config.Name]
 			if !ok {
-				panic("compiler error: invalidate not exists")
+				var diags diagnostic.List
+				diags.Errorf(compilerError, mutation.Mutation.Config.Pos, name,
+					"invalidate not exists: %s", invalidate.Config.Name)
+				return nil, diags
 			}
 			invalidateParams = append(invalidateParams, query)
 		}
@@ -143,30 +244,67 @@ func (c *CodegenPass) GenMutationFuncs(
 			Invalidates: invalidateParams,
 		})
 	}
-	return
+	return rst, nil
 }
 
-// Run -
+// Run - code is generated for statements that are not poisoned. Diagnostics found in
+// this pass are returned as a diagnostic.List error.
 func (c *CodegenPass) Run(repo *driver.Repo) error {
+	var diags diagnostic.List
+	filePos := diagnostic.Position{File: repo.Config.Path()}
+
+	types, typeDiags := NewTypeMap(repo, repo.Config.Output.Merge(c.Output).Nullable)
+	diags = append(diags, typeDiags...)
+	c.types = types
+
 	querySockets, err := c.GenQuerySockets(repo.Queries)
+	diags = append(diags, diagnostic.FromError(err, filePos, "")...)
+	mutationSockets, err := c.GenMutationSockets(repo.Mutations)
+	diags = append(diags, diagnostic.FromError(err, filePos, "")...)
+
+	// main structs, the first is the one of the schema.
+	mainStructs := make([]MainStruct, 0)
+	isMainStruct := make(map[*codegen.GoStruct]bool)
+	mainFailed := false
+	for _, main := range repo.Mains {
+		mainStruct, err := GenMainStruct(main.Table, main.Config.MainObj, c.types)
+		if err != nil {
+			offset := 0
+			var colErr *ColumnError
+			if errors.As(err, &colErr) {
+				offset = parser.ColumnOffset(string(main.Config.SQL), colErr.Column)
+			}
+			pos := main.Config.SQL.PosOf(main.Config.SQLPos, offset)
+			diags.Errorf(visitors.ErrNotSupported.String(), pos, "", "%s", err)
+			mainFailed = true
+			continue
+		}
+		mainStructs = append(mainStructs, MainStruct{Table: main.Table, Struct: mainStruct})
+		isMainStruct[mainStruct] = true
+	}
+	if mainFailed {
+		return diags
+	}
+	queryFuncs, err := c.GenQueryFuncs(mainStructs, querySockets)
 	if err != nil {
-		return err
+		return append(diags, diagnostic.FromError(err, filePos, "")...)
 	}
-	mutationSockets, err := c.GenMutationSockets(repo.Mutations)
+	mutationFuncs, err := c.GenMutationFuncs(mainStructs, mutationSockets, queryFuncs)
 	if err != nil {
-		return err
+		return append(diags, diagnostic.FromError(err, filePos, "")...)
 	}
 
-	// the main struct
-	mainStruct := GenMainStruct(repo.Tables[0], repo.Config.Schema.MainObj)
-	queryFuncs := c.GenQueryFuncs(mainStruct, repo.Tables[0], querySockets)
-	mutationFuncs := c.GenMutationFuncs(mainStruct, repo.Tables[0], mutationSockets, queryFuncs)
-
 	// building templates.
-	mainName := repo.Config.Schema.Name
-	pkgName := strings.ToLower(mainName) + "repo"
-	interfaceName := mainName
-	repoName := strings.ToLower(mainName[0:1]) + mainName[1:]
+	names, err := c.outputNames(repo)
+	if err != nil {
+		pos := repo.Config.Output.Pos
+		if !pos.IsValid() {
+			pos = filePos
+		}
+		diags.Errorf(diagnostic.CategoryConfig, pos, "", "invalid output names: %s", err)
+		return diags
+	}
+	repoName := names.ImplStruct
 
 	signatures := make([]string, 0)
 	for _, query := range queryFuncs {
@@ -176,6 +314,18 @@ func (c *CodegenPass) Run(repo *driver.Repo) error {
 		signatures = append(signatures, mutation.Name+mutation.Signature())
 	}
 
+	// structs whose fields may be of user types.
+	structs := make([]*codegen.GoStruct, 0)
+	for _, main := range mainStructs {
+		structs = append(structs, main.Struct)
+	}
+	for _, query := range queryFuncs {
+		structs = append(structs, query.Input, query.Output)
+	}
+	for _, mutation := range mutationFuncs {
+		structs = append(structs, mutation.Input)
+	}
+
 	sqlStmtDecls := make([]codegen.SQLStatementDecl, 0)
 
 	queriesStr := make([]string, 0)
@@ -184,7 +334,7 @@ func (c *CodegenPass) Run(repo *driver.Repo) error {
 		builder.WriteString(query.Input.String() + "\n")
 		builder.WriteString(query.Input.KeyFunc(query.Name) + "\n")
 		builder.WriteString(query.Input.ArglistFunc() + "\n")
-		if query.Output != mainStruct {
+		if !isMainStruct[query.Output] {
 			builder.WriteString(query.Output.String() + "\n")
 			builder.WriteString(query.Output.ScanFunc() + "\n")
 		}
@@ -209,7 +359,8 @@ func (c *CodegenPass) Run(repo *driver.Repo) error {
 		}
 		funcs, err := tmpl.Generate()
 		if err != nil {
-			panic(err)
+			diags.Errorf(compilerError, filePos, query.Name, "query template: %s", err)
+			continue
 		}
 		builder.WriteString(funcs)
 		queriesStr = append(queriesStr, builder.String())
@@ -229,7 +380,7 @@ func (c *CodegenPass) Run(repo *driver.Repo) error {
 		}
 
 		// XXX(yumin): support insert main object case.
-		if mutation.Input != mainStruct {
+		if !isMainStruct[mutation.Input] {
 			builder.WriteString(mutation.Input.String() + "\n")
 			builder.WriteString(mutation.Input.ArglistFunc() + "\n")
 		}
@@ -248,38 +399,115 @@ func (c *CodegenPass) Run(repo *driver.Repo) error {
 		}
 		funcs, err := tmpl.Generate()
 		if err != nil {
-			panic(err)
+			diags.Errorf(compilerError, filePos, mutation.Name, "mutation template: %s", err)
+			continue
 		}
 		builder.WriteString(funcs)
 		mutationsStr = append(mutationsStr, builder.String())
 	}
 
-	mainStructStr := mainStruct.String() + "\n" +
-		"// nolint: unused\n" + mainStruct.ScanFunc() + "\n" +
-		"// nolint: unused\n" + mainStruct.ArglistFunc() + "\n"
+	// main structs and their Load and Dump, named after mainObj except the first.
+	mainStructStr := ""
+	loaddumpStr := ""
+	tableSchemas := make([]codegen.SQLStatementDecl, 0)
+	for i, main := range mainStructs {
+		mainStructStr += main.Struct.String() + "\n" +
+			"// nolint: unused\n" + main.Struct.ScanFunc() + "\n" +
+			"// nolint: unused\n" + main.Struct.ArglistFunc() + "\n"
+
+		loadDumpFunc := GenLoadDumpFunc(main.Table)
+		if len(loadDumpFunc.PrimaryKey) == 0 {
+			diags.Errorf(diagnostic.CategoryConfig, repo.Mains[i].Config.Pos, "",
+				"table %s has no primary key, which is required by Load and Dump", loadDumpFunc.TableName)
+			return diags
+		}
+		loaddumpTmpl := codegen.LoadDumpFuncTemplate{
+			RepoName:       repoName,
+			MainStructName: main.Struct.Name,
+			SelectAllSQL:   loadDumpFunc.SelectSQL(),
+			InsertRowSQL:   loadDumpFunc.InsertSQL(),
+		}
+		if i > 0 {
+			loaddumpTmpl.Suffix = main.Struct.Name
+			signatures = append(signatures,
+				"Load"+loaddumpTmpl.Suffix+"(ctx context.Context, data []byte) error",
+				"Dump"+loaddumpTmpl.Suffix+"(ctx context.Context, beforeDump ...BeforeDump"+
+					loaddumpTmpl.Suffix+") ([]byte, error)")
+			tableSchemas = append(tableSchemas, codegen.SQLStatementDecl{
+				VarName:    "CreateTable" + main.Struct.Name + "Stmt",
+				EscapedSQL: main.Table.SQL(),
+			})
+		}
+		str, err := loaddumpTmpl.Generate()
+		if err != nil {
+			diags.Errorf(compilerError, filePos, "", "load/dump template: %s", err)
+			return diags
+		}
+		loaddumpStr += str + "\n"
+	}
 
-	loadDumpFunc := GenLoadDumpFunc(repo.Tables[0])
-	loaddumpTmpl := codegen.LoadDumpFuncTemplate{
-		RepoName:       repoName,
-		MainStructName: mainStruct.Name,
-		SelectAllSQL:   loadDumpFunc.SelectSQL(),
-		InsertRowSQL:   loadDumpFunc.InsertSQL(),
+	// types of ENUM and SET columns that fields are of.
+	enumsStr := ""
+	hasSet := false
+	typeNames := map[string]bool{names.Interface: true, names.ImplStruct: true}
+	for _, s := range structs {
+		typeNames[s.Name] = true
 	}
-	loaddumpStr, err := loaddumpTmpl.Generate()
-	if err != nil {
-		panic(err)
+	for _, enum := range c.types.Enums() {
+		if typeNames[enum.Name] || typeNames[enum.ItemName] {
+			diags.Errorf(diagnostic.CategoryConfig, filePos, "",
+				"type %s of column %s conflicts with another generated type", enum.Name, enum.Column)
+			return diags
+		}
+		str, err := enum.Generate()
+		if err != nil {
+			diags.Errorf(compilerError, filePos, "", "enum template: %s", err)
+			return diags
+		}
+		enumsStr += str + "\n"
+		hasSet = hasSet || enum.IsSet
+	}
+	// helpers of values that only some fields need, and packages that they use.
+	jsonFields, valuers, hasBytes := false, false, false
+	for _, s := range structs {
+		for _, f := range s.Fields {
+			user := !predeclaredPkgs[f.Type.Pkg]
+			jsonFields = jsonFields || f.Type.IsJSON
+			// sql.Null* and user types are printed in cache keys as driver values, and
+			// user types may be byte slices.
+			valuers = valuers || user || f.Type.Pkg == "database/sql"
+			hasBytes = hasBytes || user || f.Type.ID == "[]byte" ||
+				(f.Type.Pkg == "encoding/json" && f.Type.ID == "RawMessage")
+		}
+	}
+	imports := codegen.Imports(structs, staticImports...)
+	if hasSet || jsonFields || valuers || c.types.NullableGeneric() {
+		// sets, jsonField and Null[T] implement driver.Valuer.
+		imports = append(imports, `"database/sql/driver"`)
+	}
+	if hasBytes {
+		imports = append(imports, `"encoding/hex"`)
 	}
 
 	template := codegen.RepoTemplate{
 		NeedleVersion:       vcs.Commit,
-		TableSchema:         repo.Tables[0].SQL(),
-		PkgName:             pkgName,
-		InterfaceName:       interfaceName,
+		InputHash:           inputHash(repo),
+		TableSchema:         repo.Mains[0].Table.SQL(),
+		TableSchemas:        tableSchemas,
+		PkgName:             names.Package,
+		Imports:             imports,
+		InterfaceName:       names.Interface,
+		ConstructorName:     names.Constructor,
 		InterfaceSignatures: signatures,
 		RepoName:            repoName,
 		Statements:          sqlStmtDecls,
+		Enums:               enumsStr,
+		NullableGeneric:     c.types.NullableGeneric(),
+		JSONFields:          jsonFields,
+		Valuers:             valuers,
+		Bytes:               hasBytes,
 		MainStruct:          mainStructStr,
-		MainStructName:      mainStruct.Name,
+		MainStructName:      mainStructs[0].Struct.Name,
 		LoadDump:            loaddumpStr,
 		Queries:             queriesStr,
 		Mutations:           mutationsStr,
@@ -287,15 +515,27 @@ func (c *CodegenPass) Run(repo *driver.Repo) error {
 
 	code, err := template.Generate()
 	if err != nil {
-		panic(err)
+		diags.Errorf(compilerError, filePos, "", "repo template: %s", err)
+		return diags
 	}
 	code, err = utils.FormatGoCode(code)
 	if err != nil {
 		// fmt.Println(code)
-		panic("[CompilerError] code syntax error: " + err.Error())
+		diags.Errorf(compilerError, filePos, "", "code syntax error: %s", err)
+		return diags
 	}
 	c.Code = code
-	return nil
+	c.PkgName = names.Package
+	return diags.Err()
+}
+
+// inputHash is the hash of everything that affects the generated code: the content of
+// the config and its references, and the version of needle.
+func inputHash(repo *driver.Repo) string {
+	h := sha256.New()
+	h.Write([]byte(repo.Config.Digest()))
+	h.Write([]byte(vcs.Commit))
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
 }
 
 // GenLoadDumpFunc returns a LoadDumpFunc struct.
@@ -313,31 +553,51 @@ func GenLoadDumpFunc(tb schema.SQLTable) *codegen.LoadDumpFunc {
 	return &rst
 }
 
+// ColumnError is an error of a column of a main table, e.g., of an unsupported type.
+type ColumnError struct {
+	Column string
+	Err    error
+}
+
+func (e *ColumnError) Error() string {
+	return fmt.Sprintf("column %s: %s", e.Column, e.Err)
+}
+
 // GenMainStruct - generate main struct.
-func GenMainStruct(tb schema.SQLTable, name string) *codegen.GoStruct {
+func GenMainStruct(tb schema.SQLTable, name string, types *TypeMap) (*codegen.GoStruct, error) {
 	rst := codegen.GoStruct{Name: name}
 	for _, col := range tb.StarColumns() {
-		ft := calcFieldType(col.GoType(), false)
-		rst.Fields = append(rst.Fields, codegen.NewGoField(
-			utils.Title(col.Name()),
-			ft,
-			fmt.Sprintf(`json:"%s,omitempty"`, strcase.ToSnake(col.Name()))))
+		goType, err := col.GoType()
+		if err != nil {
+			return nil, &ColumnError{Column: col.Name(), Err: err}
+		}
+		ft := types.FieldType(tb.Name(), col.Name(), col.Type(), goType, false)
+		tag := fmt.Sprintf(`json:"%s,omitempty"`, strcase.ToSnake(col.Name()))
+		if !goType.NotNull && !ft.IsPointer {
+			// omitempty does not omit structs of nullable values.
+			tag = fmt.Sprintf(`json:"%s"`, strcase.ToSnake(col.Name()))
+		}
+		rst.Fields = append(rst.Fields, codegen.NewGoField(utils.Title(col.Name()), ft, tag))
 	}
 	rst.Comments = "the main struct."
-	return &rst
+	return &rst, nil
 }
 
 // GenOutputStruct generate output structs
 // use main object when output is it.
 // introduce table name if fields have name conflicts.
-func GenOutputStruct(outputName string, output []GoVar) *codegen.GoStruct {
+func GenOutputStruct(outputName string, output []GoVar, types *TypeMap) *codegen.GoStruct {
 	rst := codegen.GoStruct{Name: outputName}
 	names := make(map[string]int)
 	for _, v := range output {
 		names[v.Name]++
 	}
 	for _, v := range output {
-		ft := calcFieldType(v.Type, false)
+		column := ""
+		if v.Column != nil {
+			column = v.Column.Name.String()
+		}
+		ft := types.FieldType(v.Table, column, v.SQLType, v.Type, false)
 		nm := utils.Title(v.Name)
 		if names[v.Name] > 1 {
 			nm = utils.Title(v.TableName) + nm
@@ -351,7 +611,7 @@ func GenOutputStruct(outputName string, output []GoVar) *codegen.GoStruct {
 // 1. introduce table name when name conflicts.
 // 2. append numbers on fields when they still conflict.
 // 3. add "List" suffix on lists params.
-func GenInputStruct(inputName string, params []GoParam) *codegen.GoStruct {
+func GenInputStruct(inputName string, params []GoParam, types *TypeMap) *codegen.GoStruct {
 	rst := codegen.GoStruct{Name: inputName}
 	names := make(map[string]int)
 	for _, v := range params {
@@ -367,7 +627,7 @@ func GenInputStruct(inputName string, params []GoParam) *codegen.GoStruct {
 
 	nameUsed := make(map[string]int)
 	for _, v := range params {
-		ft := calcFieldType(v.GoType(), v.InPattern)
+		ft := types.FieldType(v.Table, v.Name, v.Marker.GetType(), v.Type, v.InPattern)
 		nm := utils.Title(v.Name)
 		if v.InPattern {
 			nm += "List"
@@ -398,7 +658,7 @@ func calcFieldType(t schema.GoType, list bool) codegen.GoType {
 	}
 	if t.Type == schema.GoTypeJson {
 		return codegen.GoType{
-			Pkg:       "json",
+			Pkg:       "encoding/json",
 			ID:        utils.Title((t.Type)),
 			IsList:    list,
 			IsPointer: !t.NotNull,
@@ -1,9 +1,9 @@
 package passes
 
 import (
-	"github.com/pingcap/tidb/parser/ast"
-
+	"github.com/stumble/needle/pkg/diagnostic"
 	"github.com/stumble/needle/pkg/driver"
+	"github.com/stumble/needle/pkg/schema"
 	"github.com/stumble/needle/pkg/visitors"
 	// "github.com/stumble/needle/pkg/utils"
 )
@@ -12,47 +12,61 @@ import (
 type NormalizePass struct {
 }
 
-// Run -
+// Run - statements that failed are poisoned and skipped, diagnostics of them are
+// returned as a diagnostic.List error after all statements are normalized.
 func (n NormalizePass) Run(repo *driver.Repo) error {
 	// tableNames := collectTableNames(repo.Tables)
+	mainTables := make([]schema.SQLTable, 0)
+	for _, m := range repo.Mains {
+		mainTables = append(mainTables, m.Table)
+	}
 
-	asts := make([]ast.Node, 0)
+	stmts := make([]stmt, 0)
 
 	for _, q := range repo.Queries {
-		asts = append(asts, q.Node)
+		stmts = append(stmts, queryStmt(q))
 	}
 	for _, m := range repo.Mutations {
-		asts = append(asts, m.Node)
+		stmts = append(stmts, mutationStmt(m))
 	}
 
 	// normalize all statements.
-	for _, node := range asts {
-		starElim := visitors.NewStarElimVisitor(repo.Tables[0])
+	var diags diagnostic.List
+	for _, s := range stmts {
+		if s.status.Poisoned() {
+			continue
+		}
+		node := s.node
+		starElim := visitors.NewStarElimVisitor(mainTables...)
 		node.Accept(starElim)
 		if starElim.Errors() != nil {
-			return mergeErrors(starElim.Errors())
+			diags = append(diags, s.poison(starElim.Errors())...)
+			continue
 		}
 
 		// XXX(yumin): tableAs pass is no longer useful.
 		// tableAs := visitors.NewTableAsVisitor(tableNames)
 		// node.Accept(tableAs)
 		// if tableAs.Errors() != nil {
-		// 	return mergeErrors(tableAs.Errors())
+		// 	diags = append(diags, s.poison(tableAs.Errors())...)
+		// 	continue
 		// }
 
 		nameResolve := visitors.NewNameResolveVisitor(repo.Tables)
 		node.Accept(nameResolve)
 		if nameResolve.Errors() != nil {
-			return mergeErrors(nameResolve.Errors())
+			diags = append(diags, s.poison(nameResolve.Errors())...)
+			continue
 		}
 
 		typeInference := visitors.NewTypeInferenceVisitor(repo.Tables)
 		node.Accept(typeInference)
 		if typeInference.Errors() != nil {
-			return mergeErrors(typeInference.Errors())
+			diags = append(diags, s.poison(typeInference.Errors())...)
+			continue
 		}
 	}
-	return nil
+	return diags.Err()
 }
 
 // func collectTableNames(tables []schema.SQLTable) (rst []string) {
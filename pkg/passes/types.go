@@ -0,0 +1,247 @@
+package passes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/iancoleman/strcase"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/types"
+
+	"github.com/stumble/needle/pkg/codegen"
+	"github.com/stumble/needle/pkg/config"
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/driver"
+	"github.com/stumble/needle/pkg/schema"
+	"github.com/stumble/needle/pkg/utils"
+)
+
+// TypeMap resolves Go types of fields with type mappings of the config, and generated
+// types of ENUM and SET columns. A nil TypeMap has neither.
+type TypeMap struct {
+	// columns maps lower cased Table.Column to the mapping.
+	columns map[string]config.TypeMapping
+	// sqlTypes maps normalized SQL types to the mapping.
+	sqlTypes map[string]config.TypeMapping
+	// enums maps lower cased Table.Column to the type of the ENUM or SET column.
+	enums map[string]*codegen.EnumTemplate
+	// used are enums that fields are of, by name.
+	used map[string]*codegen.EnumTemplate
+	// nullable is how nullable values are represented, one of config.Nullable*.
+	nullable string
+}
+
+// sqlNullTypes are types of database/sql of nullable values, by their Go types.
+var sqlNullTypes = map[string]string{
+	"string":    "NullString",
+	"int64":     "NullInt64",
+	"int32":     "NullInt32",
+	"int16":     "NullInt16",
+	"byte":      "NullByte",
+	"float64":   "NullFloat64",
+	"bool":      "NullBool",
+	"time.Time": "NullTime",
+}
+
+var spacesRegexp = regexp.MustCompile(`\s+`)
+
+// NewTypeMap returns the TypeMap of tables and type mappings of @p repo, where nullable
+// values are represented as @p nullable. Mappings of columns that are not found in
+// tables are reported.
+func NewTypeMap(repo *driver.Repo, nullable string) (*TypeMap, diagnostic.List) {
+	var diags diagnostic.List
+	rst := &TypeMap{
+		columns:  make(map[string]config.TypeMapping),
+		sqlTypes: make(map[string]config.TypeMapping),
+		enums:    make(map[string]*codegen.EnumTemplate),
+		used:     make(map[string]*codegen.EnumTemplate),
+		nullable: nullable,
+	}
+	// enum types are prefixed by mainObj of main tables, and names of other tables.
+	prefixes := make(map[string]string)
+	for _, main := range repo.Mains {
+		prefixes[strings.ToLower(main.Table.Name())] = main.Config.MainObj
+	}
+	columns := make(map[string]bool)
+	for _, tb := range repo.Tables {
+		prefix, ok := prefixes[strings.ToLower(tb.Name())]
+		if !ok {
+			prefix = utils.Title(tb.Name())
+		}
+		for _, col := range tb.Columns() {
+			key := strings.ToLower(tb.Name() + "." + col.Name())
+			columns[key] = true
+			if isEnum(col.Type()) {
+				rst.enums[key] = newEnum(prefix+utils.Title(col.Name()),
+					tb.Name()+"."+col.Name(), col.Type())
+			}
+		}
+	}
+	for _, m := range repo.Config.Types {
+		if m.Column == "" {
+			rst.sqlTypes[normalizeSQLType(m.SQLType)] = m
+			continue
+		}
+		key := strings.ToLower(m.Column)
+		if !columns[key] {
+			diags.Errorf(diagnostic.CategoryConfig, m.Pos, "",
+				"type mapping of unknown column %s", m.Column)
+			continue
+		}
+		rst.columns[key] = m
+	}
+	return rst, diags
+}
+
+// normalizeSQLType returns @p sqlType in the form of FieldType.CompactStr, e.g.
+// "decimal(10,2)" of "DECIMAL (10, 2)".
+func normalizeSQLType(sqlType string) string {
+	rst := strings.ToLower(strings.TrimSpace(sqlType))
+	rst = spacesRegexp.ReplaceAllString(rst, " ")
+	for _, s := range []string{"(", ")", ","} {
+		rst = strings.ReplaceAll(rst, " "+s, s)
+		rst = strings.ReplaceAll(rst, s+" ", s)
+	}
+	return strings.TrimSpace(strings.ReplaceAll(rst, ")unsigned", ") unsigned"))
+}
+
+// mapping returns the mapping of column @p column of table @p table, or of the SQL type
+// @p ft if the column is not mapped. Lengths and unsigned are matched before bare names.
+func (m *TypeMap) mapping(table string, column string, ft *types.FieldType) (config.TypeMapping, bool) {
+	if m == nil {
+		return config.TypeMapping{}, false
+	}
+	if table != "" && column != "" {
+		if rst, ok := m.columns[strings.ToLower(table+"."+column)]; ok {
+			return rst, true
+		}
+	}
+	if ft == nil {
+		return config.TypeMapping{}, false
+	}
+	candidates := []string{ft.CompactStr(), types.TypeToStr(ft.GetType(), ft.GetCharset())}
+	if mysql.HasUnsignedFlag(ft.GetFlag()) {
+		candidates = append([]string{candidates[0] + " unsigned", candidates[1] + " unsigned"},
+			candidates...)
+	}
+	for _, c := range candidates {
+		if rst, ok := m.sqlTypes[strings.ToLower(c)]; ok {
+			return rst, true
+		}
+	}
+	return config.TypeMapping{}, false
+}
+
+func isEnum(ft *types.FieldType) bool {
+	return ft.GetType() == mysql.TypeEnum || ft.GetType() == mysql.TypeSet
+}
+
+// newEnum returns the type @p name of @p column of ENUM or SET type @p ft. Constants
+// are named after values, with characters not allowed in identifiers removed.
+func newEnum(name string, column string, ft *types.FieldType) *codegen.EnumTemplate {
+	rst := &codegen.EnumTemplate{Name: name, ItemName: name, Column: column}
+	if ft.GetType() == mysql.TypeSet {
+		rst.ItemName = name + "Item"
+		rst.IsSet = true
+	}
+	names := make(map[string]bool)
+	for i, v := range ft.GetElems() {
+		id := strings.Map(func(r rune) rune {
+			if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, strcase.ToCamel(v))
+		if id == "" {
+			id = "Empty"
+		}
+		id = rst.ItemName + id
+		if names[id] {
+			id = fmt.Sprintf("%s%d", id, i)
+		}
+		names[id] = true
+		rst.Values = append(rst.Values, codegen.EnumValue{Name: id, Value: v})
+	}
+	return rst
+}
+
+// Enums returns types of ENUM and SET columns that fields are of, sorted by name.
+func (m *TypeMap) Enums() []*codegen.EnumTemplate {
+	if m == nil {
+		return nil
+	}
+	rst := make([]*codegen.EnumTemplate, 0, len(m.used))
+	for _, e := range m.used {
+		rst = append(rst, e)
+	}
+	sort.Slice(rst, func(i, j int) bool { return rst[i].Name < rst[j].Name })
+	return rst
+}
+
+// enum returns the type of the ENUM or SET column @p column of table @p table, and
+// marks it used. Returns nil if it is not such a column, or @p ft is not its type.
+func (m *TypeMap) enum(table string, column string, ft *types.FieldType) *codegen.EnumTemplate {
+	if m == nil || ft == nil || !isEnum(ft) {
+		return nil
+	}
+	rst, ok := m.enums[strings.ToLower(table+"."+column)]
+	if ok {
+		m.used[rst.Name] = rst
+	}
+	return rst
+}
+
+// FieldType returns the Go type of a field of column @p column of table @p table, whose
+// SQL type is @p ft and derived Go type is @p t. Table and column are empty if the field
+// is not a column. @p list is true for params of IN patterns.
+func (m *TypeMap) FieldType(table string, column string, ft *types.FieldType,
+	t schema.GoType, list bool) codegen.GoType {
+	mapping, ok := m.mapping(table, column, ft)
+	if !ok {
+		if enum := m.enum(table, column, ft); enum != nil {
+			return m.null(codegen.GoType{
+				ID:        enum.Name,
+				IsList:    list,
+				IsPointer: !t.NotNull,
+			})
+		}
+		return m.null(calcFieldType(t, list))
+	}
+	pkg, name := mapping.GoType()
+	return m.null(codegen.GoType{
+		Pkg:       pkg,
+		ID:        name,
+		IsList:    list,
+		IsPointer: !t.NotNull,
+		IsJSON:    mapping.JSON != "",
+	})
+}
+
+// null returns @p t, whose nullability is represented by a pointer, in the way that
+// nullable values are represented.
+func (m *TypeMap) null(t codegen.GoType) codegen.GoType {
+	if m == nil || !t.IsPointer {
+		return t
+	}
+	switch m.nullable {
+	case config.NullableSQL:
+		inner := codegen.GoType{Pkg: t.Pkg, ID: t.ID}
+		id, ok := sqlNullTypes[inner.String()]
+		if !ok || t.IsJSON {
+			// no such type, keep the pointer.
+			return t
+		}
+		t.Pkg, t.ID, t.IsPointer = "database/sql", id, false
+	case config.NullableGeneric:
+		t.IsPointer, t.IsNull = false, true
+	}
+	return t
+}
+
+// NullableGeneric returns true if nullable values are of the generic type Null[T].
+func (m *TypeMap) NullableGeneric() bool {
+	return m != nil && m.nullable == config.NullableGeneric
+}
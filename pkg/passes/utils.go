@@ -1,13 +1,51 @@
 package passes
 
 import (
-	"fmt"
+	"github.com/pingcap/tidb/parser/ast"
+
+	"github.com/stumble/needle/pkg/config"
+	"github.com/stumble/needle/pkg/diagnostic"
+	"github.com/stumble/needle/pkg/driver"
+	"github.com/stumble/needle/pkg/visitors"
 )
 
-func mergeErrors(errs []error) error {
-	errStr := ""
-	for _, e := range errs {
-		errStr += e.Error() + "\n"
+// stmt is a query or a mutation.
+type stmt struct {
+	name   string
+	sql    config.SQLStmt
+	sqlMap config.SQLMap
+	pos    diagnostic.Position
+	node   ast.Node
+	status *driver.Status
+}
+
+func queryStmt(q *driver.Query) stmt {
+	return stmt{name: q.Config.Name, sql: q.Config.SQL, sqlMap: q.Config.SQLMap,
+		pos: q.Config.SQLPos, node: q.Node, status: &q.Status}
+}
+
+func mutationStmt(m *driver.Mutation) stmt {
+	return stmt{name: m.Config.Name, sql: m.Config.SQL, sqlMap: m.Config.SQLMap,
+		pos: m.Config.SQLPos, node: m.Node, status: &m.Status}
+}
+
+// poison the statement with visitor errors, returns the diagnostics.
+func (s stmt) poison(errs []error) diagnostic.List {
+	diags := s.diagnostics(errs)
+	s.status.Poison(diags)
+	return diags
+}
+
+// diagnostics converts visitor errors to diagnostics of this statement.
+func (s stmt) diagnostics(errs []error) diagnostic.List {
+	var rst diagnostic.List
+	for _, err := range errs {
+		e, ok := err.(visitors.Error)
+		if !ok {
+			rst.Errorf("", s.sqlMap.PosOf(s.sql, s.pos, 0), s.name, "%s", err)
+			continue
+		}
+		rst.Errorf(e.Type.String(), s.sqlMap.PosOf(s.sql, s.pos, e.Offset), s.name, "%s", e.Detail)
 	}
-	return fmt.Errorf("%s", errStr)
+	return rst
 }
@@ -37,8 +37,8 @@ func (c *ColumnInfo) Type() *types.FieldType {
 	return c.col.Tp
 }
 
-// GoType - field in go.
-func (c *ColumnInfo) GoType() GoType {
+// GoType - field in go, returns an error if the SQL type is not supported.
+func (c *ColumnInfo) GoType() (GoType, error) {
 	return EvalTypeToGoType(c.col.Tp)
 }
 
@@ -21,7 +21,7 @@ type SQLColumn interface {
 	NameExpr() *ast.ColumnNameExpr
 	NotNull() bool
 	Type() *types.FieldType
-	GoType() GoType
+	GoType() (GoType, error)
 }
 
 // SQLIndex - index only, immutable.
@@ -37,10 +37,14 @@ type GoTypeName = string
 const (
 	// GoTypeInt int64
 	GoTypeInt GoTypeName = "int64"
+	// GoTypeUint64 uint64, of unsigned integers.
+	GoTypeUint64 GoTypeName = "uint64"
 	// GoTypeFloat64 float64
 	GoTypeFloat64 GoTypeName = "float64"
-	// GoTypeString string
+	// GoTypeString string, of strings, and decimals by default to keep their precision.
 	GoTypeString GoTypeName = "string"
+	// GoTypeBytes []byte, of binary strings.
+	GoTypeBytes GoTypeName = "[]byte"
 	// GoTypeTime time
 	GoTypeTime GoTypeName = "time"
 	// GoTypeBool bool
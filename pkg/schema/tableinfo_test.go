@@ -48,7 +48,9 @@ func (suite *TableInfoTestSuite) TestBasic() {
 	for i, v := range tableInfo.Columns() {
 		suite.Equal(results[i].u, v.Name())
 		suite.Equal(results[i].nn, v.NotNull())
-		suite.Equal(results[i].t, v.GoType())
+		t, err := v.GoType()
+		suite.Require().NoError(err)
+		suite.Equal(results[i].t, t)
 	}
 }
 
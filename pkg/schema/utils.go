@@ -1,37 +1,59 @@
 package schema
 
 import (
+	"fmt"
+
+	"github.com/pingcap/tidb/parser/charset"
 	"github.com/pingcap/tidb/parser/mysql"
 	"github.com/pingcap/tidb/parser/types"
 )
 
-// EvalTypeToGoType - eval
-func EvalTypeToGoType(t *types.FieldType) GoType {
+// EvalTypeToGoType - eval, returns an error if @p t has no Go type, e.g. TIME.
+func EvalTypeToGoType(t *types.FieldType) (GoType, error) {
+	name, err := EvalTypeToGoTypeName(t)
+	if err != nil {
+		return GoType{}, err
+	}
 	return GoType{
-		Type:    EvalTypeToGoTypeName(t),
+		Type:    name,
 		NotNull: mysql.HasNotNullFlag(t.GetFlag()),
-	}
+	}, nil
 }
 
-// EvalTypeToGoTypeName - eval
-func EvalTypeToGoTypeName(t *types.FieldType) GoTypeName {
+// EvalTypeToGoTypeName - eval, returns an error if @p t has no Go type, e.g. TIME.
+func EvalTypeToGoTypeName(t *types.FieldType) (GoTypeName, error) {
 	// XXX(yumin): the first cond is a kind of hack, should visit this part later.
 	if (t.GetType() == mysql.TypeTiny && t.GetFlen() == 1) || mysql.HasIsBooleanFlag(t.GetFlag()) {
-		return GoTypeBool
+		return GoTypeBool, nil
 	}
-	// TODO(yumin): support type	decimal, timestamp, duration, and maybe enum
+	// TODO(yumin): support type	timestamp, duration, and maybe enum
 	et := t.EvalType()
 	switch et {
 	case types.ETInt:
-		return GoTypeInt
+		if mysql.HasUnsignedFlag(t.GetFlag()) {
+			return GoTypeUint64, nil
+		}
+		return GoTypeInt, nil
 	case types.ETReal:
-		return GoTypeFloat64
+		return GoTypeFloat64, nil
+	case types.ETDecimal:
+		// decimals are strings to keep their precision, types can be mapped to others.
+		return GoTypeString, nil
 	case types.ETDatetime:
-		return GoTypeTime
+		return GoTypeTime, nil
 	case types.ETString:
-		return GoTypeString
+		if IsBinary(t) {
+			return GoTypeBytes, nil
+		}
+		return GoTypeString, nil
 	case types.ETJson:
-		return GoTypeJson
+		return GoTypeJson, nil
 	}
-	panic("unsupported type: " + t.String())
+	return "", fmt.Errorf("unsupported type: %s", t)
+}
+
+// IsBinary returns true if @p t is a binary string, e.g. BLOB and VARBINARY.
+func IsBinary(t *types.FieldType) bool {
+	return t.EvalType() == types.ETString && mysql.HasBinaryFlag(t.GetFlag()) &&
+		t.GetCharset() == charset.CharsetBin
 }
@@ -5,6 +5,7 @@ import (
 	"reflect"
 
 	"github.com/pingcap/tidb/parser/ast"
+	driver "github.com/pingcap/tidb/types/parser_driver"
 	"github.com/rs/zerolog/log"
 )
 
@@ -72,6 +73,20 @@ func (b *baseVisitor) FindInCtxAnyOf(types ...ast.Node) (ast.Node, bool) {
 	return nil, false
 }
 
+// ctxOffset returns the offset in SQL text of the closest node in context that has
+// one, 0 if none.
+func (b *baseVisitor) ctxOffset() int {
+	for i := len(b.traceCtx) - 1; i >= 0; i-- {
+		if marker, ok := b.traceCtx[i].(*driver.ParamMarkerExpr); ok && marker.Offset > 0 {
+			return marker.Offset
+		}
+		if offset := b.traceCtx[i].OriginTextPosition(); offset > 0 {
+			return offset
+		}
+	}
+	return 0
+}
+
 func (b *baseVisitor) DisableLogging(y bool) {
 	b.disableLogging = y
 }
@@ -80,7 +95,12 @@ func (b *baseVisitor) Errors() []error {
 	return b.errors
 }
 
+// AppendErr - if offset of @p err is unknown, it is set to the offset of the closest
+// node in context that has one.
 func (b *baseVisitor) AppendErr(err Error) {
+	if err.Offset == 0 {
+		err.Offset = b.ctxOffset()
+	}
 	b.errors = append(b.errors, err)
 	if !b.disableLogging {
 		log.Debug().Err(err).Msgf("[%s]: AppendErr", b.name)
@@ -22,6 +22,8 @@ const (
 type Error struct {
 	Type   ErrorType
 	Detail string
+	// Offset is the byte offset of the failing node in the SQL text, 0 if unknown.
+	Offset int
 }
 
 // NewError -
@@ -40,16 +42,20 @@ func NewErrorf(t ErrorType, format string, arg ...interface{}) Error {
 	}
 }
 
-func (e Error) Error() string {
-	prefix := ""
-	if e.Type == ErrNotSupported {
-		prefix = "[NotSupported]"
-	} else if e.Type == ErrInvalidExpr {
-		prefix = "[InvalidExpr]"
-	} else if e.Type == ErrCompilerError {
-		prefix = "[CompilerError]"
-	} else if e.Type == ErrTypeCheck {
-		prefix = "[TypeCheck]"
+func (t ErrorType) String() string {
+	switch t {
+	case ErrNotSupported:
+		return "NotSupported"
+	case ErrInvalidExpr:
+		return "InvalidExpr"
+	case ErrTypeCheck:
+		return "TypeCheck"
+	case ErrCompilerError:
+		return "CompilerError"
 	}
-	return prefix + " " + e.Detail
+	return fmt.Sprintf("ErrorType(%d)", int(t))
+}
+
+func (e Error) Error() string {
+	return "[" + e.Type.String() + "] " + e.Detail
 }
@@ -0,0 +1,434 @@
+package visitors
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/charset"
+	"github.com/pingcap/tidb/parser/mysql"
+	"github.com/pingcap/tidb/parser/types"
+
+	"github.com/stumble/needle/pkg/utils"
+)
+
+// funcSig is the signature of a built-in function.
+type funcSig struct {
+	// minArgs and maxArgs bound the number of arguments, maxArgs is -1 if variadic.
+	// Keywords, e.g. DAY of DATE_ADD(d, INTERVAL 1 DAY), are not arguments.
+	minArgs int
+	maxArgs int
+	// ret returns the type of the result given types of arguments, ignoring nullability.
+	ret func(args []*types.FieldType) (*types.FieldType, error)
+	// null returns true if the result can be NULL given types of arguments.
+	null func(args []*types.FieldType) bool
+	// args are kinds of arguments that type markers passed as them, the last one is of
+	// the rest arguments of variadic functions. Arguments not listed are argAny.
+	args []argKind
+}
+
+// argKind is how a marker passed as an argument of a function is typed.
+type argKind int
+
+const (
+	// argAny markers are typed by the context of the call, e.g. CONCAT(?, 'a') = Name.
+	argAny argKind = iota
+	// argInt markers are integers, e.g. counts like LEFT(s, ?) and INTERVAL ? DAY.
+	argInt
+	// argUnified markers take the type that other argUnified arguments are converted to,
+	// e.g. branches of IF, or the type of the context if all of them are markers.
+	argUnified
+)
+
+// funcCatalog are signatures of supported built-in functions, by lower-cased names.
+// Functions that are not in the catalog fail type inference.
+var funcCatalog = map[string]funcSig{
+	// control flow functions.
+	ast.Coalesce: {1, -1, unifyArgs(0), allNull, []argKind{argUnified}},
+	ast.If:       {3, 3, unifyArgs(1), argNull(1, 2), []argKind{argAny, argUnified, argUnified}},
+	ast.Ifnull:   {2, 2, unifyArgs(0), allNull, []argKind{argUnified, argUnified}},
+	ast.Nullif:   {2, 2, argType(0), alwaysNull, nil},
+	ast.Greatest: {2, -1, unifyArgs(0), anyNull, nil},
+	ast.Least:    {2, -1, unifyArgs(0), anyNull, nil},
+	ast.IsNull:   {1, 1, returns(newBoolType), neverNull, nil},
+
+	// string functions.
+	ast.Concat:          {1, -1, returns(newStringType), anyNull, nil},
+	ast.ConcatWS:        {2, -1, returns(newStringType), argNull(0), nil},
+	ast.Lower:           {1, 1, returns(newStringType), anyNull, nil},
+	ast.Lcase:           {1, 1, returns(newStringType), anyNull, nil},
+	ast.Upper:           {1, 1, returns(newStringType), anyNull, nil},
+	ast.Ucase:           {1, 1, returns(newStringType), anyNull, nil},
+	ast.Substring:       {2, 3, returns(newStringType), anyNull, []argKind{argAny, argInt, argInt}},
+	ast.Substr:          {2, 3, returns(newStringType), anyNull, []argKind{argAny, argInt, argInt}},
+	ast.Mid:             {3, 3, returns(newStringType), anyNull, []argKind{argAny, argInt, argInt}},
+	ast.SubstringIndex:  {3, 3, returns(newStringType), anyNull, nil},
+	ast.Left:            {2, 2, returns(newStringType), anyNull, []argKind{argAny, argInt}},
+	ast.Right:           {2, 2, returns(newStringType), anyNull, []argKind{argAny, argInt}},
+	ast.Trim:            {1, 2, returns(newStringType), anyNull, nil},
+	ast.LTrim:           {1, 1, returns(newStringType), anyNull, nil},
+	ast.RTrim:           {1, 1, returns(newStringType), anyNull, nil},
+	ast.Lpad:            {3, 3, returns(newStringType), anyNull, []argKind{argAny, argInt}},
+	ast.Rpad:            {3, 3, returns(newStringType), anyNull, []argKind{argAny, argInt}},
+	ast.Replace:         {3, 3, returns(newStringType), anyNull, nil},
+	ast.Repeat:          {2, 2, returns(newStringType), anyNull, []argKind{argAny, argInt}},
+	ast.Reverse:         {1, 1, returns(newStringType), anyNull, nil},
+	ast.InsertFunc:      {4, 4, returns(newStringType), anyNull, nil},
+	ast.Space:           {1, 1, returns(newStringType), anyNull, []argKind{argInt}},
+	ast.Format:          {2, 3, returns(newStringType), anyNull, nil},
+	ast.Hex:             {1, 1, returns(newStringType), anyNull, nil},
+	ast.ToBase64:        {1, 1, returns(newStringType), anyNull, nil},
+	ast.MD5:             {1, 1, returns(newStringType), anyNull, nil},
+	ast.SHA1:            {1, 1, returns(newStringType), anyNull, nil},
+	ast.SHA:             {1, 1, returns(newStringType), anyNull, nil},
+	ast.SHA2:            {2, 2, returns(newStringType), anyNull, nil},
+	ast.Quote:           {1, 1, returns(newStringType), neverNull, nil}, // QUOTE(NULL) is 'NULL'.
+	ast.Elt:             {2, -1, returns(newStringType), alwaysNull, nil},
+	ast.Unhex:           {1, 1, returns(newBinaryType), alwaysNull, nil},
+	ast.FromBase64:      {1, 1, returns(newBinaryType), alwaysNull, nil},
+	ast.UUID:            {0, 0, returns(newStringType), neverNull, nil},
+	ast.CharLength:      {1, 1, returns(newIntType), anyNull, nil},
+	ast.CharacterLength: {1, 1, returns(newIntType), anyNull, nil},
+	ast.Length:          {1, 1, returns(newIntType), anyNull, nil},
+	ast.OctetLength:     {1, 1, returns(newIntType), anyNull, nil},
+	ast.BitLength:       {1, 1, returns(newIntType), anyNull, nil},
+	ast.ASCII:           {1, 1, returns(newIntType), anyNull, nil},
+	ast.Ord:             {1, 1, returns(newIntType), anyNull, nil},
+	ast.Strcmp:          {2, 2, returns(newIntType), anyNull, nil},
+	ast.Locate:          {2, 3, returns(newIntType), anyNull, nil},
+	ast.Position:        {2, 2, returns(newIntType), anyNull, nil},
+	ast.Instr:           {2, 2, returns(newIntType), anyNull, nil},
+	ast.FindInSet:       {2, 2, returns(newIntType), anyNull, nil},
+	ast.Field:           {2, -1, returns(newIntType), neverNull, nil},
+
+	// numeric functions.
+	ast.Abs:      {1, 1, numberArg(0), anyNull, nil},
+	ast.Ceil:     {1, 1, numberArg(0), anyNull, nil},
+	ast.Ceiling:  {1, 1, numberArg(0), anyNull, nil},
+	ast.Floor:    {1, 1, numberArg(0), anyNull, nil},
+	ast.Round:    {1, 2, numberArg(0), anyNull, []argKind{argAny, argInt}},
+	ast.Truncate: {2, 2, numberArg(0), anyNull, []argKind{argAny, argInt}},
+	ast.Mod:      {2, 2, unifyArgs(0), alwaysNull, nil}, // MOD(N, 0) is NULL.
+	ast.Sign:     {1, 1, returns(newIntType), anyNull, nil},
+	ast.CRC32:    {1, 1, returns(newIntType), anyNull, nil},
+	ast.Pow:      {2, 2, returns(newDoubleType), anyNull, nil},
+	ast.Power:    {2, 2, returns(newDoubleType), anyNull, nil},
+	ast.Exp:      {1, 1, returns(newDoubleType), anyNull, nil},
+	ast.Sin:      {1, 1, returns(newDoubleType), anyNull, nil},
+	ast.Cos:      {1, 1, returns(newDoubleType), anyNull, nil},
+	ast.Tan:      {1, 1, returns(newDoubleType), anyNull, nil},
+	ast.Atan:     {1, 2, returns(newDoubleType), anyNull, nil},
+	ast.Atan2:    {2, 2, returns(newDoubleType), anyNull, nil},
+	ast.Degrees:  {1, 1, returns(newDoubleType), anyNull, nil},
+	ast.Radians:  {1, 1, returns(newDoubleType), anyNull, nil},
+	// out of their domains, e.g. SQRT(-1), these are NULL.
+	ast.Sqrt:  {1, 1, returns(newDoubleType), alwaysNull, nil},
+	ast.Ln:    {1, 1, returns(newDoubleType), alwaysNull, nil},
+	ast.Log:   {1, 2, returns(newDoubleType), alwaysNull, nil},
+	ast.Log2:  {1, 1, returns(newDoubleType), alwaysNull, nil},
+	ast.Log10: {1, 1, returns(newDoubleType), alwaysNull, nil},
+	ast.Asin:  {1, 1, returns(newDoubleType), alwaysNull, nil},
+	ast.Acos:  {1, 1, returns(newDoubleType), alwaysNull, nil},
+	ast.Cot:   {1, 1, returns(newDoubleType), alwaysNull, nil},
+	ast.PI:    {0, 0, returns(newDoubleType), neverNull, nil},
+	ast.Rand:  {0, 1, returns(newDoubleType), neverNull, nil},
+
+	// date and time functions.
+	ast.Now:              {0, 1, returns(newDatetimeType), neverNull, nil},
+	ast.CurrentTimestamp: {0, 1, returns(newDatetimeType), neverNull, nil},
+	ast.LocalTime:        {0, 1, returns(newDatetimeType), neverNull, nil},
+	ast.LocalTimestamp:   {0, 1, returns(newDatetimeType), neverNull, nil},
+	ast.Sysdate:          {0, 1, returns(newDatetimeType), neverNull, nil},
+	ast.UTCTimestamp:     {0, 1, returns(newDatetimeType), neverNull, nil},
+	ast.Curdate:          {0, 0, returns(newDateType), neverNull, nil},
+	ast.CurrentDate:      {0, 0, returns(newDateType), neverNull, nil},
+	ast.UTCDate:          {0, 0, returns(newDateType), neverNull, nil},
+	ast.Date:             {1, 1, returns(newDateType), anyNull, nil},
+	ast.LastDay:          {1, 1, returns(newDateType), anyNull, nil},
+	ast.FromDays:         {1, 1, returns(newDateType), anyNull, nil},
+	ast.MakeDate:         {2, 2, returns(newDateType), alwaysNull, nil},
+	ast.AddDate:          {2, 2, argType(0), anyNull, []argKind{argAny, argInt}},
+	ast.DateAdd:          {2, 2, argType(0), anyNull, []argKind{argAny, argInt}},
+	ast.SubDate:          {2, 2, argType(0), anyNull, []argKind{argAny, argInt}},
+	ast.DateSub:          {2, 2, argType(0), anyNull, []argKind{argAny, argInt}},
+	ast.TimestampAdd:     {2, 2, argType(1), anyNull, []argKind{argInt}},
+	ast.ConvertTz:        {3, 3, argType(0), alwaysNull, nil}, // unknown time zones are NULL.
+	ast.StrToDate:        {2, 2, returns(newDatetimeType), alwaysNull, nil},
+	ast.FromUnixTime:     {1, 2, fromUnixTime, anyNull, nil},
+	ast.DateFormat:       {2, 2, returns(newStringType), anyNull, nil},
+	ast.DayName:          {1, 1, returns(newStringType), anyNull, nil},
+	ast.MonthName:        {1, 1, returns(newStringType), anyNull, nil},
+	ast.UnixTimestamp:    {0, 1, returns(newIntType), anyNull, nil},
+	ast.DateDiff:         {2, 2, returns(newIntType), anyNull, nil},
+	ast.TimestampDiff:    {2, 2, returns(newIntType), anyNull, nil},
+	ast.Extract:          {1, 1, returns(newIntType), anyNull, nil},
+	ast.ToDays:           {1, 1, returns(newIntType), anyNull, nil},
+	ast.ToSeconds:        {1, 1, returns(newIntType), anyNull, nil},
+	ast.Year:             {1, 1, returns(newIntType), anyNull, nil},
+	ast.Quarter:          {1, 1, returns(newIntType), anyNull, nil},
+	ast.Month:            {1, 1, returns(newIntType), anyNull, nil},
+	ast.Week:             {1, 2, returns(newIntType), anyNull, nil},
+	ast.WeekOfYear:       {1, 1, returns(newIntType), anyNull, nil},
+	ast.YearWeek:         {1, 2, returns(newIntType), anyNull, nil},
+	ast.Day:              {1, 1, returns(newIntType), anyNull, nil},
+	ast.DayOfMonth:       {1, 1, returns(newIntType), anyNull, nil},
+	ast.DayOfWeek:        {1, 1, returns(newIntType), anyNull, nil},
+	ast.DayOfYear:        {1, 1, returns(newIntType), anyNull, nil},
+	ast.Weekday:          {1, 1, returns(newIntType), anyNull, nil},
+	ast.Hour:             {1, 1, returns(newIntType), anyNull, nil},
+	ast.Minute:           {1, 1, returns(newIntType), anyNull, nil},
+	ast.Second:           {1, 1, returns(newIntType), anyNull, nil},
+	ast.MicroSecond:      {1, 1, returns(newIntType), anyNull, nil},
+
+	// information functions.
+	ast.LastInsertId: {0, 1, returns(newIntType), neverNull, nil},
+	ast.RowCount:     {0, 0, returns(newIntType), neverNull, nil},
+	ast.FoundRows:    {0, 0, returns(newIntType), neverNull, nil},
+
+	// JSON functions.
+	// col->'$.path' as well, it is NULL if the path does not exist.
+	ast.JSONExtract: {2, -1, returns(newJSONType), alwaysNull, nil},
+	// col->>'$.path' as well.
+	ast.JSONUnquote:       {1, 1, returns(newStringType), anyNull, nil},
+	ast.JSONQuote:         {1, 1, returns(newStringType), anyNull, nil},
+	ast.JSONObject:        {0, -1, returns(newJSONType), neverNull, nil},
+	ast.JSONArray:         {0, -1, returns(newJSONType), neverNull, nil},
+	ast.JSONSet:           {3, -1, returns(newJSONType), jsonUpdateNull, nil},
+	ast.JSONInsert:        {3, -1, returns(newJSONType), jsonUpdateNull, nil},
+	ast.JSONReplace:       {3, -1, returns(newJSONType), jsonUpdateNull, nil},
+	ast.JSONArrayAppend:   {3, -1, returns(newJSONType), jsonUpdateNull, nil},
+	ast.JSONArrayInsert:   {3, -1, returns(newJSONType), jsonUpdateNull, nil},
+	ast.JSONRemove:        {2, -1, returns(newJSONType), anyNull, nil},
+	ast.JSONMerge:         {2, -1, returns(newJSONType), anyNull, nil},
+	ast.JSONMergePatch:    {2, -1, returns(newJSONType), anyNull, nil},
+	ast.JSONMergePreserve: {2, -1, returns(newJSONType), anyNull, nil},
+	ast.JSONContains:      {2, 3, returns(newBoolType), pathNull(2), nil},
+	ast.JSONContainsPath:  {3, -1, returns(newBoolType), anyNull, nil},
+	ast.JSONLength:        {1, 2, returns(newIntType), pathNull(1), nil},
+	ast.JSONKeys:          {1, 2, returns(newJSONType), pathNull(1), nil},
+	ast.JSONSearch:        {3, -1, returns(newStringType), alwaysNull, nil},
+	ast.JSONType:          {1, 1, returns(newStringType), anyNull, nil},
+	ast.JSONValid:         {1, 1, returns(newBoolType), anyNull, nil},
+	ast.JSONDepth:         {1, 1, returns(newIntType), anyNull, nil},
+	ast.JSONPretty:        {1, 1, returns(newStringType), anyNull, nil},
+	ast.JSONStorageSize:   {1, 1, returns(newIntType), anyNull, nil},
+}
+
+// funcCallTypeInfer returns the type of the result of the built-in function call @p f.
+func funcCallTypeInfer(f *ast.FuncCallExpr) (*types.FieldType, error) {
+	sig, ok := funcCatalog[f.FnName.L]
+	if !ok {
+		return nil, NewErrorf(ErrNotSupported,
+			"unsupported function %s: %s", f.FnName.L, utils.RestoreNode(f))
+	}
+	var args []*types.FieldType
+	for _, arg := range funcArgs(f) {
+		args = append(args, arg.GetType())
+	}
+	if len(args) < sig.minArgs || (sig.maxArgs >= 0 && len(args) > sig.maxArgs) {
+		return nil, NewErrorf(ErrInvalidExpr,
+			"invoke %s with %d arguments: %s", f.FnName.L, len(args), utils.RestoreNode(f))
+	}
+	rst, err := sig.ret(args)
+	if err != nil {
+		return nil, NewErrorf(ErrTypeCheck,
+			"%s %s: %s", f.FnName.L, err.Error(), utils.RestoreNode(f))
+	}
+	rst = nullClone(rst)
+	if !sig.null(args) {
+		rst.AddFlag(mysql.NotNullFlag)
+	}
+	return rst, nil
+}
+
+// funcArgs returns arguments of the call @p f, without keywords.
+func funcArgs(f *ast.FuncCallExpr) []ast.ExprNode {
+	var rst []ast.ExprNode
+	for _, arg := range f.Args {
+		switch arg.(type) {
+		case *ast.TimeUnitExpr, *ast.TrimDirectionExpr, *ast.GetFormatSelectorExpr:
+			continue
+		}
+		rst = append(rst, arg)
+	}
+	return rst
+}
+
+// funcArgKind returns the kind of @p n, an argument of the call @p f.
+func funcArgKind(f *ast.FuncCallExpr, n ast.Node) argKind {
+	sig, ok := funcCatalog[f.FnName.L]
+	if !ok || len(sig.args) == 0 {
+		return argAny
+	}
+	for i, arg := range funcArgs(f) {
+		if arg != n {
+			continue
+		}
+		if i < len(sig.args) {
+			return sig.args[i]
+		}
+		if sig.maxArgs < 0 {
+			return sig.args[len(sig.args)-1]
+		}
+	}
+	return argAny
+}
+
+// returns returns a ret function of signatures that always returns the type @p newType
+// creates.
+func returns(newType func() *types.FieldType) func([]*types.FieldType) (*types.FieldType, error) {
+	return func([]*types.FieldType) (*types.FieldType, error) {
+		return newType(), nil
+	}
+}
+
+// argType returns a ret function of signatures that returns the type of the @p i-th
+// argument.
+func argType(i int) func([]*types.FieldType) (*types.FieldType, error) {
+	return func(args []*types.FieldType) (*types.FieldType, error) {
+		return args[i].Clone(), nil
+	}
+}
+
+// numberArg is argType of the @p i-th argument, which must be a number.
+func numberArg(i int) func([]*types.FieldType) (*types.FieldType, error) {
+	return func(args []*types.FieldType) (*types.FieldType, error) {
+		if !isNumber(args[i].EvalType()) {
+			return nil, fmt.Errorf("on non-number %s", args[i])
+		}
+		return args[i].Clone(), nil
+	}
+}
+
+// unifyArgs returns a ret function of signatures that returns the type of arguments from
+// the @p from-th on, which are converted to the same type, e.g. branches of IF.
+func unifyArgs(from int) func([]*types.FieldType) (*types.FieldType, error) {
+	return func(args []*types.FieldType) (*types.FieldType, error) {
+		return unifyTypes(args[from:])
+	}
+}
+
+// unifyTypes returns the type that values of types @p ts are converted to. NULLs take
+// the type of others, numbers are widened, and other types must be of the same kind.
+func unifyTypes(ts []*types.FieldType) (*types.FieldType, error) {
+	var rst *types.FieldType
+	for _, t := range ts {
+		if t.GetType() == mysql.TypeNull {
+			continue
+		}
+		if rst == nil {
+			rst = t
+			continue
+		}
+		et, other := rst.EvalType(), t.EvalType()
+		if et == other {
+			continue
+		}
+		if !isNumber(et) || !isNumber(other) {
+			return nil, fmt.Errorf("type mismatch(%s, %s)", rst, t)
+		}
+		if numberRank(other) > numberRank(et) {
+			rst = t
+		}
+	}
+	if rst == nil {
+		return nil, errors.New("type cannot be inferred from NULLs")
+	}
+	return rst.Clone(), nil
+}
+
+// fromUnixTime is the ret function of FROM_UNIXTIME, a string if it is formatted.
+func fromUnixTime(args []*types.FieldType) (*types.FieldType, error) {
+	if len(args) > 1 {
+		return newStringType(), nil
+	}
+	return newDatetimeType(), nil
+}
+
+// anyNull is NULL if any argument is NULL, the rule of most functions.
+func anyNull(args []*types.FieldType) bool {
+	for _, arg := range args {
+		if !mysql.HasNotNullFlag(arg.GetFlag()) {
+			return true
+		}
+	}
+	return false
+}
+
+// allNull is NULL if all arguments are NULL, e.g. COALESCE.
+func allNull(args []*types.FieldType) bool {
+	for _, arg := range args {
+		if mysql.HasNotNullFlag(arg.GetFlag()) {
+			return false
+		}
+	}
+	return true
+}
+
+func alwaysNull([]*types.FieldType) bool {
+	return true
+}
+
+func neverNull([]*types.FieldType) bool {
+	return false
+}
+
+// argNull returns a null function of signatures that is NULL if any of the arguments at
+// @p indices is NULL, e.g. the separator of CONCAT_WS.
+func argNull(indices ...int) func([]*types.FieldType) bool {
+	return func(args []*types.FieldType) bool {
+		for _, i := range indices {
+			if !mysql.HasNotNullFlag(args[i].GetFlag()) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// pathNull returns a null function of signatures of JSON functions whose optional path is
+// the @p i-th argument, which is NULL if the path does not exist.
+func pathNull(i int) func([]*types.FieldType) bool {
+	return func(args []*types.FieldType) bool {
+		return len(args) > i || anyNull(args)
+	}
+}
+
+// jsonUpdateNull is NULL if the document or any path of JSON_SET(doc, path, val, ...)
+// and alike is NULL, NULL values are JSON nulls.
+func jsonUpdateNull(args []*types.FieldType) bool {
+	for i, arg := range args {
+		if (i == 0 || i%2 == 1) && !mysql.HasNotNullFlag(arg.GetFlag()) {
+			return true
+		}
+	}
+	return false
+}
+
+func newIntType() *types.FieldType {
+	return types.NewFieldType(mysql.TypeLonglong)
+}
+
+func newDoubleType() *types.FieldType {
+	return types.NewFieldType(mysql.TypeDouble)
+}
+
+func newDatetimeType() *types.FieldType {
+	return types.NewFieldType(mysql.TypeDatetime)
+}
+
+func newDateType() *types.FieldType {
+	return types.NewFieldType(mysql.TypeDate)
+}
+
+func newJSONType() *types.FieldType {
+	return types.NewFieldType(mysql.TypeJSON)
+}
+
+func newBinaryType() *types.FieldType {
+	rst := types.NewFieldType(mysql.TypeLongBlob)
+	rst.SetCharset(charset.CharsetBin)
+	rst.SetCollate(charset.CollationBin)
+	rst.AddFlag(mysql.BinaryFlag)
+	return rst
+}
@@ -161,7 +161,7 @@ func (suite *NameResolveTestSuite) TestImplicitName() {
                 createdAt datetime
             );`,
 			},
-			[]error{Error{Type: 1, Detail: "ambiguous expression: username, multiple defs: [user happyhourwinner]"}, Error{Type: 1, Detail: "cannot find the column of (username)"}},
+			[]error{Error{Type: 1, Detail: "ambiguous expression: username, multiple defs: [user happyhourwinner]", Offset: 25}, Error{Type: 1, Detail: "cannot find the column of (username)", Offset: 25}},
 			"",
 		},
 	}
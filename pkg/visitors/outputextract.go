@@ -1,9 +1,10 @@
 package visitors
 
 import (
-	"errors"
+	"fmt"
 
 	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/types"
 
 	"github.com/stumble/needle/pkg/schema"
 	"github.com/stumble/needle/pkg/utils"
@@ -14,6 +15,12 @@ type GoVar struct {
 	TableName string
 	Name      string
 	Type      schema.GoType
+	// SQLType is the type of the expression.
+	SQLType *types.FieldType
+	// Column is the column that the var is read from, nil if it is computed.
+	Column *ast.ColumnName
+	// Table is the table of Column, not its alias, empty if it is computed.
+	Table string
 }
 
 // OutputExtractVisitor -
@@ -42,14 +49,16 @@ func (s *OutputExtractVisitor) Enter(n ast.Node) (ast.Node, bool) {
 		return n, true
 	}
 
+	aliases := tableAliases(selectStmt)
 	for _, f := range selectStmt.Fields.Fields {
 		if f.WildCard != nil {
-			panic("wildcard is not eliminated, midend skipped?")
+			s.AppendErr(NewErrorf(ErrCompilerError,
+				"wildcard is not eliminated, midend skipped?: %s", utils.RestoreNode(n)))
+			return n, true
 		}
-		vv, err := calcGoVar(f)
+		vv, err := calcGoVar(f, aliases)
 		if err != nil {
-			s.AppendErr(NewErrorf(ErrInvalidExpr, "failed to construct govar name: %s",
-				utils.RestoreNode(n)))
+			s.AppendErr(err.(Error))
 			return n, true
 		}
 		s.Output = append(s.Output, *vv)
@@ -67,12 +76,28 @@ func (s *OutputExtractVisitor) Leave(n ast.Node) (ast.Node, bool) {
 
 // columnNameExpr: (Table, ColName)
 // function:       ("", AsName)
-func calcGoVar(field *ast.SelectField) (*GoVar, error) {
+// returns an Error if the name or the Go type of @p field cannot be decided. Tables of
+// columns are resolved by @p aliases.
+func calcGoVar(field *ast.SelectField, aliases map[string]string) (*GoVar, error) {
+	t, err := schema.EvalTypeToGoType(field.Expr.GetType())
+	if err != nil {
+		return nil, Error{Type: ErrNotSupported, Offset: field.Offset,
+			Detail: fmt.Sprintf("%s: %s", err, utils.RestoreNode(field))}
+	}
+	var column *ast.ColumnName
+	table := ""
+	if v, ok := field.Expr.(*ast.ColumnNameExpr); ok {
+		column = v.Name
+		table = resolveTable(aliases, v.Name.Table.String())
+	}
 	if field.AsName.String() != "" {
 		return &GoVar{
 			TableName: "",
 			Name:      field.AsName.String(),
-			Type:      schema.EvalTypeToGoType(field.Expr.GetType()),
+			Type:      t,
+			SQLType:   field.Expr.GetType(),
+			Column:    column,
+			Table:     table,
 		}, nil
 	}
 	switch v := field.Expr.(type) {
@@ -80,9 +105,13 @@ func calcGoVar(field *ast.SelectField) (*GoVar, error) {
 		return &GoVar{
 			TableName: v.Name.Table.String(),
 			Name:      v.Name.Name.String(),
-			Type:      schema.EvalTypeToGoType(v.GetType()),
+			Type:      t,
+			SQLType:   v.GetType(),
+			Column:    column,
+			Table:     table,
 		}, nil
 	default:
-		return nil, errors.New("failed to calc GoVar name")
+		return nil, Error{Type: ErrInvalidExpr, Offset: field.Offset,
+			Detail: "failed to construct govar name: " + utils.RestoreNode(field)}
 	}
 }
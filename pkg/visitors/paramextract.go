@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/iancoleman/strcase"
 	"github.com/pingcap/tidb/parser/ast"
 	driver "github.com/pingcap/tidb/types/parser_driver"
 
@@ -25,11 +26,10 @@ type GoParam struct {
 	InPattern bool
 	Order     int
 	Marker    *driver.ParamMarkerExpr
-}
-
-// GoType return GoType of the param.
-func (g GoParam) GoType() schema.GoType {
-	return schema.EvalTypeToGoType(g.Marker.GetType())
+	Type      schema.GoType
+	// Table is the table of the column that the param is named after, where TableName
+	// is its alias, empty if the param is not named after a column.
+	Table string
 }
 
 func (g GoParam) String() string {
@@ -37,7 +37,7 @@ func (g GoParam) String() string {
 	if g.InPattern {
 		in = "[]"
 	}
-	return fmt.Sprintf("{$%d, %s.%s%s: %s}", g.Order, g.TableName, g.Name, in, g.GoType())
+	return fmt.Sprintf("{$%d, %s.%s%s: %s}", g.Order, g.TableName, g.Name, in, g.Type)
 }
 
 // ParamExtractVisitor - only mysql driver are supported, backend pass.
@@ -46,6 +46,9 @@ type ParamExtractVisitor struct {
 	*baseVisitor
 
 	Params []GoParam
+
+	// aliases are tables of the statement by their aliases.
+	aliases map[string]string
 }
 
 // NewParamExtractVisitor -
@@ -66,6 +69,7 @@ func (c *ParamExtractVisitor) findNameInContext(n ast.Node) (string, string, boo
 		(*ast.PatternInExpr)(nil),
 		(*ast.InsertStmt)(nil),
 		(*ast.Assignment)(nil),
+		(*ast.CaseExpr)(nil),
 	)
 	if !ok {
 		return "", "", false
@@ -113,11 +117,96 @@ func (c *ParamExtractVisitor) findNameInContext(n ast.Node) (string, string, boo
 		}
 	case *ast.Assignment:
 		return v.Column.Name.String(), v.Column.Table.String(), true
+	case *ast.CaseExpr:
+		return c.findNameInCase(v, n)
 	}
 
 	return "", "", false
 }
 
+// findNameInCase returns name and table of @p n, a param of CASE @p v. WHEN of a CASE
+// of a column is named after the column, and so are results of a CASE that is compared
+// with or assigned to a column. Others are named after the alias of the selected CASE,
+// suffixed by Case, When, Then or Else.
+func (c *ParamExtractVisitor) findNameInCase(v *ast.CaseExpr, n ast.Node) (string, string, bool) {
+	role := ""
+	if v.Value != nil && v.Value == n {
+		role = "Case"
+	}
+	for _, when := range v.WhenClauses {
+		if when.Expr == n {
+			if value, isRef := v.Value.(*ast.ColumnNameExpr); isRef {
+				return value.Name.Name.String(), value.Name.Table.String(), true
+			}
+			role = "When"
+		} else if when.Result == n {
+			role = "Then"
+		}
+	}
+	if v.ElseClause != nil && v.ElseClause == n {
+		role = "Else"
+	}
+	if role == "" {
+		return "", "", false
+	}
+	alias, column, table := c.enclosingName(v)
+	if column != "" {
+		if role == "Then" || role == "Else" {
+			return column, table, true
+		}
+		alias = column
+	}
+	return alias + role, "", true
+}
+
+// findNameInCall returns name and table of @p n, a param of the call @p v that the
+// function types. Unified arguments are named like results of a CASE, and integers
+// after the alias or the column of the call, suffixed by the function name, e.g.
+// CreatedAtDateSub of CreatedAt > DATE_SUB(NOW(), INTERVAL ? DAY).
+func (c *ParamExtractVisitor) findNameInCall(v *ast.FuncCallExpr, n ast.Node) (string, string, bool) {
+	kind := funcArgKind(v, n)
+	if kind == argAny {
+		return "", "", false
+	}
+	alias, column, table := c.enclosingName(v)
+	if column != "" {
+		if kind == argUnified {
+			return column, table, true
+		}
+		alias = column
+	}
+	return alias + strcase.ToCamel(v.FnName.L), "", true
+}
+
+// enclosingName returns the alias of the select field, or the column and table that
+// are compared with or assigned to, of the closest node enclosing @p v that names it.
+func (c *ParamExtractVisitor) enclosingName(v ast.Node) (alias, column, table string) {
+	var ctx ast.Node
+	for i := len(c.traceCtx) - 1; i > 0; i-- {
+		if c.traceCtx[i] != v {
+			continue
+		}
+		for j := i - 1; j >= 0 && ctx == nil; j-- {
+			switch c.traceCtx[j].(type) {
+			case *ast.SelectField, *ast.Assignment, *ast.BinaryOperationExpr:
+				ctx = c.traceCtx[j]
+			}
+		}
+		break
+	}
+	switch x := ctx.(type) {
+	case *ast.SelectField:
+		alias = x.AsName.String()
+	case *ast.Assignment:
+		column, table = x.Column.Name.String(), x.Column.Table.String()
+	case *ast.BinaryOperationExpr:
+		if left, isRef := x.L.(*ast.ColumnNameExpr); isRef {
+			column, table = left.Name.Name.String(), left.Name.Table.String()
+		}
+	}
+	return alias, column, table
+}
+
 func (c *ParamExtractVisitor) isInList() bool {
 	_, ok := c.FindInCtx((*ast.PatternInExpr)(nil))
 	return ok
@@ -126,14 +215,31 @@ func (c *ParamExtractVisitor) isInList() bool {
 // Enter - Implements Visitor
 func (c *ParamExtractVisitor) Enter(n ast.Node) (ast.Node, bool) {
 	c.baseVisitor.Enter(n)
+	if c.aliases == nil {
+		c.aliases = tableAliases(n)
+	}
 	switch v := n.(type) {
 	case *driver.ParamMarkerExpr: // interface
-		name, table, ok := c.findNameInContext(n)
+		name, table, ok := "", "", false
+		// n is the top of the context, and its parent is under it.
+		if len(c.traceCtx) > 1 {
+			if call, isCall := c.traceCtx[len(c.traceCtx)-2].(*ast.FuncCallExpr); isCall {
+				name, table, ok = c.findNameInCall(call, n)
+			}
+		}
+		if !ok {
+			name, table, ok = c.findNameInContext(n)
+		}
 		if !ok {
 			c.AppendErr(NewErrorf(ErrCompilerError, "Failed to infer name of %s",
 				utils.RestoreNode(v)))
 			return n, true
 		}
+		t, err := schema.EvalTypeToGoType(v.GetType())
+		if err != nil {
+			c.AppendErr(NewErrorf(ErrNotSupported, "%s: param %s", err, name))
+			return n, true
+		}
 		isInList := c.isInList()
 		c.Params = append(c.Params, GoParam{
 			Name:      name,
@@ -141,6 +247,8 @@ func (c *ParamExtractVisitor) Enter(n ast.Node) (ast.Node, bool) {
 			InPattern: isInList,
 			Order:     0, // will be set in the end.
 			Marker:    v,
+			Type:      t,
+			Table:     resolveTable(c.aliases, table),
 		})
 	}
 	return n, false
@@ -1,6 +1,8 @@
 package visitors
 
 import (
+	"strings"
+
 	"github.com/pingcap/tidb/parser/ast"
 
 	"github.com/stumble/needle/pkg/schema"
@@ -8,16 +10,17 @@ import (
 )
 
 // StarElimVisitor - eliminate * in select by replacing it with a list of fields.
+// Of @p tables, it is the one selected from, or the first if none of them is.
 type StarElimVisitor struct {
 	*baseVisitor
-	table schema.SQLTable
+	tables []schema.SQLTable
 }
 
 // NewStarElimVisitor -
-func NewStarElimVisitor(tb schema.SQLTable) *StarElimVisitor {
+func NewStarElimVisitor(tables ...schema.SQLTable) *StarElimVisitor {
 	return &StarElimVisitor{
 		baseVisitor: newBaseVisitor("StarElim"),
-		table:       tb,
+		tables:      tables,
 	}
 }
 
@@ -31,7 +34,7 @@ func (s *StarElimVisitor) Enter(n ast.Node) (ast.Node, bool) {
 		fields := v.Fields.Fields
 		if hasWildcard(fields) {
 			if len(fields) == 1 {
-				v.Fields = s.makeTableFields()
+				v.Fields = s.makeTableFields(s.starTable(v))
 			} else {
 				s.AppendErr(NewErrorf(ErrInvalidExpr,
 					"* with extra fields are not allowed: %s", utils.RestoreNode(n)))
@@ -47,9 +50,25 @@ func (s *StarElimVisitor) Leave(n ast.Node) (ast.Node, bool) {
 	return n, true
 }
 
-func (s *StarElimVisitor) makeTableFields() *ast.FieldList {
+// starTable returns the table that * of @p stmt stands for.
+func (s *StarElimVisitor) starTable(stmt *ast.SelectStmt) schema.SQLTable {
+	if stmt.From != nil && stmt.From.TableRefs != nil && stmt.From.TableRefs.Right == nil {
+		if source, ok := stmt.From.TableRefs.Left.(*ast.TableSource); ok {
+			if name, ok := source.Source.(*ast.TableName); ok {
+				for _, tb := range s.tables {
+					if strings.EqualFold(tb.Name(), name.Name.O) {
+						return tb
+					}
+				}
+			}
+		}
+	}
+	return s.tables[0]
+}
+
+func (s *StarElimVisitor) makeTableFields(tb schema.SQLTable) *ast.FieldList {
 	rst := make([]*ast.SelectField, 0)
-	for _, col := range s.table.StarColumns() {
+	for _, col := range tb.StarColumns() {
 		selectField := &ast.SelectField{
 			Expr: col.NameExpr(),
 		}
@@ -44,6 +44,27 @@ func (suite *StarElimTestSuite) TestStarElimBasic() {
 		utils.RestoreNode(stmt))
 }
 
+func (suite *StarElimTestSuite) TestStarElimTableName() {
+	p := parser.NewSQLParser()
+	var tables []schema.SQLTable
+	for _, sql := range []string{
+		"CREATE TABLE Persons (PersonID int, LastName varchar(255));",
+		"CREATE TABLE Orders (OrderID int, PersonID int);",
+	} {
+		tableast, err := p.ParseOneStmt(sql)
+		suite.Require().Nil(err)
+		tables = append(tables, schema.NewTableInfo(tableast.(*ast.CreateTableStmt), nil))
+	}
+
+	// table names are case-insensitive.
+	stmt, err := p.ParseOneStmt("SELECT * FROM orders")
+	suite.Require().Nil(err)
+	starElim := NewStarElimVisitor(tables...)
+	stmt.Accept(starElim)
+	suite.Require().Nil(starElim.Errors())
+	suite.Equal("SELECT OrderID,PersonID FROM orders", utils.RestoreNode(stmt))
+}
+
 func TestStarElimTestSuite(t *testing.T) {
 	suite.Run(t, new(StarElimTestSuite))
 }
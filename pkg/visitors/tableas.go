@@ -1,6 +1,8 @@
 package visitors
 
 import (
+	"strings"
+
 	"github.com/pingcap/tidb/parser/ast"
 )
 
@@ -68,3 +70,41 @@ func (c *TableAsVisitor) Enter(n ast.Node) (ast.Node, bool) {
 func (c *TableAsVisitor) Leave(n ast.Node) (ast.Node, bool) {
 	return n, true
 }
+
+// aliasVisitor collects tables by their lower cased aliases, of a statement and its
+// subqueries, whose aliases are unique.
+type aliasVisitor struct {
+	aliases map[string]string
+}
+
+// Enter - Implements Visitor
+func (a *aliasVisitor) Enter(n ast.Node) (ast.Node, bool) {
+	if table, ok := n.(*ast.TableSource); ok {
+		name, simple := table.Source.(*ast.TableName)
+		if simple && table.AsName.String() != "" {
+			a.aliases[strings.ToLower(table.AsName.String())] = name.Name.String()
+		}
+	}
+	return n, false
+}
+
+// Leave - Implements Visitor
+func (a *aliasVisitor) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// tableAliases returns tables of @p n by their lower cased aliases.
+func tableAliases(n ast.Node) map[string]string {
+	rst := &aliasVisitor{aliases: make(map[string]string)}
+	n.Accept(rst)
+	return rst.aliases
+}
+
+// resolveTable returns the table aliased as @p name in @p aliases, or @p name if it is
+// not an alias.
+func resolveTable(aliases map[string]string, name string) string {
+	if table, ok := aliases[strings.ToLower(name)]; ok {
+		return table
+	}
+	return name
+}
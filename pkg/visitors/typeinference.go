@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/charset"
 	"github.com/pingcap/tidb/parser/mysql"
 	"github.com/pingcap/tidb/parser/opcode"
 	"github.com/pingcap/tidb/parser/types"
@@ -24,7 +25,7 @@ type columnRef struct {
 	tmpVarType *types.FieldType
 }
 
-func (r columnRef) t() *types.FieldType {
+func (r columnRef) t() (*types.FieldType, error) {
 	var tp *types.FieldType
 	if r.col != nil {
 		tp = r.col.Type()
@@ -33,12 +34,12 @@ func (r columnRef) t() *types.FieldType {
 		tp = r.tmpVarType
 	}
 	if tp == nil {
-		panic(fmt.Errorf("type nil: %+v", r))
+		return nil, NewErrorf(ErrCompilerError, "type of %s not resolved", r.name)
 	}
 	if r.nullable {
-		return nullClone(tp)
+		return nullClone(tp), nil
 	}
-	return tp.Clone()
+	return tp.Clone(), nil
 }
 
 type refStack struct {
@@ -53,19 +54,23 @@ func newRefStack() refStack {
 	}
 }
 
-func (r *refStack) PushNames(refs ...columnRef) {
-	r.stack = append(r.stack, refs)
+// PushNames pushes a frame of @p refs. Nothing is pushed if any of them has no type.
+func (r *refStack) PushNames(refs ...columnRef) error {
 	for _, ref := range refs {
 		if ref.col == nil && ref.tmpVarType == nil {
-			panic(fmt.Errorf("invalid push: %+v", ref))
+			return NewErrorf(ErrCompilerError, "invalid push of untyped ref: %s", ref.name)
 		}
+	}
+	r.stack = append(r.stack, refs)
+	for _, ref := range refs {
 		r.dict[ref.name] = append(r.dict[ref.name], ref)
 	}
+	return nil
 }
 
-func (r *refStack) PopNames() {
+func (r *refStack) PopNames() error {
 	if len(r.stack) == 0 {
-		panic("pop on empty stack")
+		return NewError(ErrCompilerError, "pop on empty stack")
 	}
 	top := r.stack[len(r.stack)-1]
 	for _, ref := range top {
@@ -73,6 +78,7 @@ func (r *refStack) PopNames() {
 		r.dict[ref.name] = val[:len(val)-1]
 	}
 	r.stack = r.stack[:len(r.stack)-1]
+	return nil
 }
 
 func (r *refStack) Lookup(name string) (columnRef, bool) {
@@ -119,14 +125,14 @@ func makeFQColName(tb string, col string) string {
 	return tb + "." + col
 }
 
-func (t *TypeInferenceVisitor) typeLookup(nameExpr *ast.ColumnName) (*types.FieldType, bool) {
+func (t *TypeInferenceVisitor) typeLookup(nameExpr *ast.ColumnName) (*types.FieldType, error) {
 	tb := nameExpr.Table.String()
 	name := makeFQColName(tb, nameExpr.Name.String())
 	colRef, ok := t.refStack.Lookup(name)
 	if !ok {
-		return nil, false
+		return nil, NewErrorf(ErrInvalidExpr, "column not defined: %s", nameExpr)
 	}
-	return colRef.t(), true
+	return colRef.t()
 }
 
 // Enter - Implements Visitor
@@ -159,9 +165,9 @@ func (t *TypeInferenceVisitor) Enter(n ast.Node) (ast.Node, bool) {
 		params := v.Lists[0]
 		cols := v.Columns
 		for i := range params {
-			coltype, ok := t.typeLookup(cols[i])
-			if !ok {
-				t.AppendErr(NewErrorf(ErrInvalidExpr, "column not defined: %s", cols[i].Name))
+			coltype, err := t.typeLookup(cols[i])
+			if err != nil {
+				t.AppendErr(err.(Error))
 				return n, true
 			}
 			// nullable input parameter.
@@ -178,15 +184,23 @@ func (t *TypeInferenceVisitor) Enter(n ast.Node) (ast.Node, bool) {
 }
 
 func (t *TypeInferenceVisitor) popColumnRefs() {
-	t.refStack.PopNames()
+	if err := t.refStack.PopNames(); err != nil {
+		t.AppendErr(err.(Error))
+	}
 }
 
+// pushColumnRefs pushes columns of @p tref. On errors, an empty frame is pushed so
+// that it is balanced with the pop on leaving the statement.
 func (t *TypeInferenceVisitor) pushColumnRefs(tref *ast.TableRefsClause) error {
 	columnRefs, ok := t.makeColumnRefs(tref)
 	if !ok {
+		_ = t.refStack.PushNames()
 		return NewErrorf(ErrTypeCheck, "failed to find table def: %s", utils.RestoreNode(tref))
 	}
-	t.refStack.PushNames(columnRefs...)
+	if err := t.refStack.PushNames(columnRefs...); err != nil {
+		_ = t.refStack.PushNames()
+		return err
+	}
 	return nil
 }
 
@@ -299,9 +313,9 @@ func (t *TypeInferenceVisitor) Leave(n ast.Node) (ast.Node, bool) {
 	case *ast.SelectStmt, *ast.DeleteStmt, *ast.UpdateStmt, *ast.InsertStmt:
 		t.popColumnRefs()
 	case *ast.ColumnNameExpr:
-		coltype, ok := t.typeLookup(v.Name)
-		if !ok {
-			t.AppendErr(NewErrorf(ErrInvalidExpr, "column not defined: %s", v.Name))
+		coltype, err := t.typeLookup(v.Name)
+		if err != nil {
+			t.AppendErr(err.(Error))
 			return n, true
 		}
 		v.SetType(coltype)
@@ -310,6 +324,18 @@ func (t *TypeInferenceVisitor) Leave(n ast.Node) (ast.Node, bool) {
 		if v.GetType().GetType() != mysql.TypeUnspecified {
 			break
 		}
+		kind := argAny
+		if call, ok := t.parent().(*ast.FuncCallExpr); ok {
+			kind = funcArgKind(call, n)
+		}
+		if kind == argUnified {
+			// typed on leaving the call, when all arguments are visited.
+			return n, true
+		}
+		if kind == argInt {
+			v.SetType(newNotNullIntType())
+			break
+		}
 		bop, ok := t.FindInCtxAnyOf(
 			(*ast.Limit)(nil),
 			(*ast.PatternInExpr)(nil),
@@ -317,6 +343,7 @@ func (t *TypeInferenceVisitor) Leave(n ast.Node) (ast.Node, bool) {
 			(*ast.BetweenExpr)(nil),
 			(*ast.BinaryOperationExpr)(nil),
 			(*ast.Assignment)(nil),
+			(*ast.CaseExpr)(nil),
 		)
 		if !ok {
 			t.AppendErr(NewErrorf(ErrInvalidExpr, "ParamMarker type cannot be inferred: %s",
@@ -324,6 +351,27 @@ func (t *TypeInferenceVisitor) Leave(n ast.Node) (ast.Node, bool) {
 			return n, true
 		}
 		switch op := bop.(type) {
+		case *ast.CaseExpr:
+			if isCaseResult(op, n) {
+				// typed on leaving the CASE, when all results are visited.
+				return n, true
+			}
+			if value, ok := op.Value.(ast.ParamMarkerExpr); ok &&
+				value.GetType().GetType() == mysql.TypeUnspecified {
+				// the value, or compared with it, typed on leaving the CASE, when all
+				// WHEN expressions are visited.
+				return n, true
+			}
+			for _, when := range op.WhenClauses {
+				if when.Expr != n {
+					continue
+				}
+				if op.Value != nil {
+					v.SetType(notNullClone(op.Value.GetType()))
+				} else {
+					v.SetType(notNullClone(newBoolType()))
+				}
+			}
 		case *ast.BinaryOperationExpr:
 			v.SetType(notNullClone(op.L.GetType()))
 		case *ast.PatternInExpr:
@@ -336,8 +384,8 @@ func (t *TypeInferenceVisitor) Leave(n ast.Node) (ast.Node, bool) {
 			v.SetType(newNotNullIntType())
 		case *ast.Assignment:
 			// nullable input parameter.
-			coltype, ok := t.typeLookup(op.Column)
-			if ok {
+			coltype, err := t.typeLookup(op.Column)
+			if err == nil {
 				if v.GetType().GetType() == mysql.TypeUnspecified {
 					v.SetType(coltype)
 				} else {
@@ -385,38 +433,22 @@ func (t *TypeInferenceVisitor) Leave(n ast.Node) (ast.Node, bool) {
 			v.SetType(target.Clone())
 		}
 	case *ast.FuncCallExpr:
-		// TODO(yumin): Support more functions.
-		// For function calls we handled some types.
-		switch v.FnName.L {
-		case ast.Coalesce:
-			// user MUST PLACE the type in the order of (nullable, nullable, notnullable)?
-			if len(v.Args) == 0 {
-				t.AppendErr(NewErrorf(ErrTypeCheck,
-					"invoke %s with zero arguments", ast.Coalesce))
-			} else {
-				lastType := v.Args[len(v.Args)-1].GetType().Clone()
-				t.LogWarn("partial support of coalesce function %s, "+
-					"type resolve to the last parameter: %s, notnull: %t",
-					utils.RestoreNode(v), lastType, (lastType.GetFlag()&mysql.NotNullFlag) != 0)
-				v.SetType(lastType)
-			}
-		case ast.AddDate, ast.DateAdd, ast.Date:
-			v.SetType(v.Args[0].GetType().Clone())
-		case ast.UTCTimestamp:
-			v.SetType(newNotNullDatetimeType())
-		case ast.LastInsertId:
-			v.SetType(newNotNullIntType())
-		case ast.Curdate, ast.Now:
-			v.SetType(newNotNullDatetimeType())
-		default:
-			if len(v.Args) >= 1 {
-				defaultType := v.Args[0].GetType()
-				v.SetType(defaultType.Clone())
-				t.LogWarn("unsupported function: %s, type-check defaults to: %s",
-					v.FnName.L, defaultType)
-			} else {
-				t.AppendErr(NewErrorf(ErrTypeCheck, "cannot infer type of %s", v.FnName.L))
-			}
+		if err := t.typeUnifiedArgs(v); err != nil {
+			t.AppendErr(err.(Error))
+			return n, true
+		}
+		ftype, err := funcCallTypeInfer(v)
+		if err != nil {
+			t.AppendErr(err.(Error))
+		} else {
+			v.SetType(ftype)
+		}
+	case *ast.CaseExpr:
+		ctype, err := t.caseTypeInfer(v)
+		if err != nil {
+			t.AppendErr(err.(Error))
+		} else {
+			v.SetType(ctype)
 		}
 	case *ast.FuncCastExpr:
 		switch v.FunctionType {
@@ -469,6 +501,175 @@ func (t *TypeInferenceVisitor) Leave(n ast.Node) (ast.Node, bool) {
 // 	return true
 // }
 
+// isCaseResult returns true if @p n is a THEN or the ELSE result of @p c.
+func isCaseResult(c *ast.CaseExpr, n ast.Node) bool {
+	for _, when := range c.WhenClauses {
+		if when.Result == n {
+			return true
+		}
+	}
+	return c.ElseClause != nil && c.ElseClause == n
+}
+
+// caseTypeInfer returns the type of the CASE @p c being left, which results are
+// converted to. Markers of results take the type of what the CASE is compared with or
+// assigned to, or of other results. It is nullable if any result is, or ELSE is missing.
+func (t *TypeInferenceVisitor) caseTypeInfer(c *ast.CaseExpr) (*types.FieldType, error) {
+	if err := caseValueTypeInfer(c); err != nil {
+		return nil, err
+	}
+	results := make([]ast.ExprNode, 0, len(c.WhenClauses)+1)
+	for _, when := range c.WhenClauses {
+		results = append(results, when.Result)
+	}
+	if c.ElseClause != nil {
+		results = append(results, c.ElseClause)
+	}
+	var markers []ast.ExprNode
+	var known []*types.FieldType
+	for _, result := range results {
+		if _, ok := result.(ast.ParamMarkerExpr); ok &&
+			result.GetType().GetType() == mysql.TypeUnspecified {
+			markers = append(markers, result)
+		} else if result.GetType().GetType() != mysql.TypeNull {
+			known = append(known, result.GetType())
+		}
+	}
+	if len(markers) > 0 {
+		mtype := t.contextType()
+		if mtype == nil && len(known) > 0 {
+			unified, err := unifyTypes(known)
+			if err != nil {
+				return nil, NewErrorf(ErrTypeCheck, "CASE %s: %s", err.Error(), utils.RestoreNode(c))
+			}
+			mtype = notNullClone(unified)
+		}
+		if mtype == nil {
+			return nil, NewErrorf(ErrInvalidExpr, "ParamMarker type cannot be inferred: %s",
+				utils.RestoreNode(c))
+		}
+		for _, marker := range markers {
+			marker.SetType(mtype.Clone())
+			known = append(known, mtype)
+		}
+	}
+	if len(known) == 0 {
+		return nil, NewErrorf(ErrTypeCheck, "CASE of only NULLs: %s", utils.RestoreNode(c))
+	}
+	rst, err := unifyTypes(known)
+	if err != nil {
+		return nil, NewErrorf(ErrTypeCheck, "CASE %s: %s", err.Error(), utils.RestoreNode(c))
+	}
+	rst = nullClone(rst)
+	nullable := c.ElseClause == nil
+	for _, result := range results {
+		nullable = nullable || !mysql.HasNotNullFlag(result.GetType().GetFlag())
+	}
+	if !nullable {
+		rst.AddFlag(mysql.NotNullFlag)
+	}
+	return rst, nil
+}
+
+// caseValueTypeInfer types the marker of the value of CASE @p c, and markers of WHEN
+// expressions compared with it, with the type that other WHEN expressions are converted to.
+func caseValueTypeInfer(c *ast.CaseExpr) error {
+	if _, ok := c.Value.(ast.ParamMarkerExpr); !ok ||
+		c.Value.GetType().GetType() != mysql.TypeUnspecified {
+		return nil
+	}
+	markers := []ast.ExprNode{c.Value}
+	var known []*types.FieldType
+	for _, when := range c.WhenClauses {
+		if _, ok := when.Expr.(ast.ParamMarkerExpr); ok &&
+			when.Expr.GetType().GetType() == mysql.TypeUnspecified {
+			markers = append(markers, when.Expr)
+		} else if when.Expr.GetType().GetType() != mysql.TypeNull {
+			known = append(known, when.Expr.GetType())
+		}
+	}
+	if len(known) == 0 {
+		return NewErrorf(ErrInvalidExpr, "ParamMarker type cannot be inferred: %s",
+			utils.RestoreNode(c))
+	}
+	unified, err := unifyTypes(known)
+	if err != nil {
+		return NewErrorf(ErrTypeCheck, "CASE %s: %s", err.Error(), utils.RestoreNode(c))
+	}
+	for _, marker := range markers {
+		marker.SetType(notNullClone(unified))
+	}
+	return nil
+}
+
+// parent returns the parent of the node being left, nil if it is the root.
+func (t *TypeInferenceVisitor) parent() ast.Node {
+	if len(t.traceCtx) == 0 {
+		return nil
+	}
+	return t.traceCtx[len(t.traceCtx)-1]
+}
+
+// typeUnifiedArgs types markers of argUnified arguments of the call @p f being left, with
+// the type that other such arguments are converted to, or the type of what the call is
+// compared with or assigned to if all of them are markers.
+func (t *TypeInferenceVisitor) typeUnifiedArgs(f *ast.FuncCallExpr) error {
+	var markers []ast.ExprNode
+	var known []*types.FieldType
+	for _, arg := range funcArgs(f) {
+		if funcArgKind(f, arg) != argUnified {
+			continue
+		}
+		if _, ok := arg.(ast.ParamMarkerExpr); ok &&
+			arg.GetType().GetType() == mysql.TypeUnspecified {
+			markers = append(markers, arg)
+		} else if arg.GetType().GetType() != mysql.TypeNull {
+			known = append(known, arg.GetType())
+		}
+	}
+	if len(markers) == 0 {
+		return nil
+	}
+	var mtype *types.FieldType
+	if len(known) > 0 {
+		unified, err := unifyTypes(known)
+		if err != nil {
+			return NewErrorf(ErrTypeCheck, "%s %s: %s", f.FnName.L, err.Error(), utils.RestoreNode(f))
+		}
+		mtype = notNullClone(unified)
+	} else {
+		mtype = t.contextType()
+	}
+	if mtype == nil {
+		return NewErrorf(ErrInvalidExpr, "ParamMarker type cannot be inferred: %s",
+			utils.RestoreNode(f))
+	}
+	for _, marker := range markers {
+		marker.SetType(mtype.Clone())
+	}
+	return nil
+}
+
+// contextType returns the type of what the CASE or the function call being left is
+// compared with or assigned to, nil if unknown.
+func (t *TypeInferenceVisitor) contextType() *types.FieldType {
+	op, ok := t.FindInCtxAnyOf((*ast.BinaryOperationExpr)(nil), (*ast.Assignment)(nil))
+	if !ok {
+		return nil
+	}
+	switch v := op.(type) {
+	case *ast.BinaryOperationExpr:
+		if v.L.GetType().GetType() != mysql.TypeUnspecified {
+			return notNullClone(v.L.GetType())
+		}
+	case *ast.Assignment:
+		if coltype, err := t.typeLookup(v.Column); err == nil {
+			return coltype
+		}
+	}
+	return nil
+}
+
 func bopTypeCheck(bop *ast.BinaryOperationExpr) (*types.FieldType, error) {
 	lt := bop.L.GetType().Clone()
 	rt := bop.R.GetType().Clone()
@@ -486,10 +687,18 @@ func bopTypeCheck(bop *ast.BinaryOperationExpr) (*types.FieldType, error) {
 		// XXX(yumin): introduce a new assumption that on implicit mysql type conversion
 		// the return type is converted back to the left hand side expression type. This
 		// is not correct but a work around for SET X = X + 1 case for now.
-		if etleft != etright {
+		if etleft != etright && !(isNumber(etleft) && isNumber(etright)) {
 			return nil, fmt.Errorf("subterm type not equal: (%s, %s)", lt.String(), rt.String())
 			// return lt, nil
 		}
+		// numbers are converted to the wider one, e.g. DECIMAL * INT is a DECIMAL.
+		if numberRank(etright) > numberRank(etleft) {
+			notNull := mysql.HasNotNullFlag(lt.GetFlag()) && mysql.HasNotNullFlag(rt.GetFlag())
+			lt = nullClone(rt)
+			if notNull {
+				lt.AddFlag(mysql.NotNullFlag)
+			}
+		}
 	}
 
 	if isAnyOf(bop.Op, []opcode.Op{
@@ -506,8 +715,7 @@ func bopTypeCheck(bop *ast.BinaryOperationExpr) (*types.FieldType, error) {
 		opcode.BitNeg,
 		opcode.IntDiv,
 	}) {
-		et := lt.EvalType()
-		if !(et == types.ETInt || et == types.ETReal || et == types.ETDecimal) {
+		if !isNumber(lt.EvalType()) {
 			return nil, errors.New("algorithmatic b-op on non-numbers")
 		}
 		return lt, nil
@@ -516,6 +724,23 @@ func bopTypeCheck(bop *ast.BinaryOperationExpr) (*types.FieldType, error) {
 	return newBoolType(), nil
 }
 
+func isNumber(et types.EvalType) bool {
+	return et == types.ETInt || et == types.ETDecimal || et == types.ETReal
+}
+
+// numberRank orders numbers by how wide they are, 0 if @p et is not a number.
+func numberRank(et types.EvalType) int {
+	switch et {
+	case types.ETInt:
+		return 1
+	case types.ETDecimal:
+		return 2
+	case types.ETReal:
+		return 3
+	}
+	return 0
+}
+
 // nullClone returns a type with NotNullFlag to be false.
 func nullClone(t *types.FieldType) *types.FieldType {
 	tp := t.Clone()
@@ -536,9 +761,10 @@ func newNotNullIntType() *types.FieldType {
 	return rst
 }
 
-func newNotNullDatetimeType() *types.FieldType {
-	rst := types.NewFieldType(mysql.TypeDatetime)
-	rst.AddFlag(mysql.NotNullFlag)
+func newStringType() *types.FieldType {
+	rst := types.NewFieldType(mysql.TypeLongBlob)
+	rst.SetCharset(charset.CharsetUTF8MB4)
+	rst.SetCollate(charset.CollationUTF8MB4)
 	return rst
 }
 
@@ -572,7 +798,13 @@ func aggregateFuncTypeInfer(f *ast.AggregateFuncExpr) (*types.FieldType, error)
 		// sum, max, and min function will return null when there's no matching rows.
 		t.AndFlag(^mysql.NotNullFlag)
 		return t, nil
-	case ast.AggFuncAvg, ast.AggFuncVarPop, ast.AggFuncVarSamp, ast.AggFuncStddevPop, ast.AggFuncStddevSamp:
+	case ast.AggFuncAvg:
+		// avg of decimals is a decimal, which keeps its precision.
+		if f.Args[0].GetType().EvalType() == types.ETDecimal {
+			return nullClone(f.Args[0].GetType()), nil
+		}
+		return types.NewFieldType(mysql.TypeFloat), nil
+	case ast.AggFuncVarPop, ast.AggFuncVarSamp, ast.AggFuncStddevPop, ast.AggFuncStddevSamp:
 		return types.NewFieldType(mysql.TypeFloat), nil
 	default:
 		return nil, NewErrorf(ErrCompilerError,
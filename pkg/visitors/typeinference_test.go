@@ -4,12 +4,13 @@ import (
 	// "fmt"
 	"testing"
 
-	// "github.com/pingcap/tidb/parser/ast"
+	"github.com/pingcap/tidb/parser/ast"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/stumble/needle/pkg/config"
 	"github.com/stumble/needle/pkg/driver"
-	// "github.com/stumble/needle/pkg/parser"
+	"github.com/stumble/needle/pkg/parser"
+	"github.com/stumble/needle/pkg/schema"
 )
 
 // To test type inference,
@@ -31,6 +32,201 @@ func (suite *TypeInferenceTestSuite) TestBasic() {
 	}
 }
 
+func (suite *TypeInferenceTestSuite) TestFunctions() {
+	p := parser.NewSQLParser()
+	tableast, err := p.ParseOneStmt(`
+CREATE TABLE Users (
+  ID BIGINT NOT NULL,
+  Name VARCHAR(64) NOT NULL,
+  Nick VARCHAR(64),
+  Score DECIMAL(10, 2),
+  Extra JSON,
+  CreatedAt DATETIME NOT NULL);`)
+	suite.Require().Nil(err)
+	tables := []schema.SQLTable{schema.NewTableInfo(tableast.(*ast.CreateTableStmt), nil)}
+
+	for _, c := range []struct {
+		expr    string
+		goType  schema.GoTypeName
+		notNull bool
+	}{
+		{"CONCAT(Users.Name, 1)", schema.GoTypeString, true},
+		{"CONCAT(Users.Name, Users.Nick)", schema.GoTypeString, false},
+		{"CONCAT_WS(',', Users.Name, Users.Nick)", schema.GoTypeString, true},
+		{"IF(Users.ID > 1, Users.Name, 'none')", schema.GoTypeString, true},
+		{"IF(Users.ID > 1, Users.Name, NULL)", schema.GoTypeString, false},
+		{"IFNULL(Users.Nick, Users.Name)", schema.GoTypeString, true},
+		{"IFNULL(Users.Score, 0)", schema.GoTypeString, true},
+		{"COALESCE(Users.Nick, NULL)", schema.GoTypeString, false},
+		{"NULLIF(Users.Name, '')", schema.GoTypeString, false},
+		{"GREATEST(Users.ID, 1.5e0)", schema.GoTypeFloat64, true},
+		{"CHAR_LENGTH(Users.Name)", schema.GoTypeInt, true},
+		{"CHAR_LENGTH(Users.Nick)", schema.GoTypeInt, false},
+		{"ROUND(Users.Score, 1)", schema.GoTypeString, false},
+		{"ROUND(Users.ID)", schema.GoTypeInt, true},
+		{"SQRT(Users.ID)", schema.GoTypeFloat64, false},
+		{"DATE(Users.CreatedAt)", schema.GoTypeTime, true},
+		{"DATE_ADD(Users.CreatedAt, INTERVAL 1 DAY)", schema.GoTypeTime, true},
+		{"TIMESTAMPDIFF(DAY, Users.CreatedAt, NOW())", schema.GoTypeInt, true},
+		{"DATE_FORMAT(Users.CreatedAt, '%Y')", schema.GoTypeString, true},
+		{"STR_TO_DATE(Users.Name, '%Y')", schema.GoTypeTime, false},
+		{"UTC_TIMESTAMP()", schema.GoTypeTime, true},
+		{"LAST_INSERT_ID()", schema.GoTypeInt, true},
+		{"Users.Extra->'$.a'", schema.GoTypeJson, false},
+		{"JSON_OBJECT('name', Users.Nick)", schema.GoTypeJson, true},
+		{"JSON_LENGTH(Users.Extra)", schema.GoTypeInt, false},
+	} {
+		stmt, err := p.ParseOneStmt("SELECT " + c.expr + " AS X FROM Users;")
+		suite.Require().Nil(err, c.expr)
+		ti := NewTypeInferenceVisitor(tables)
+		stmt.Accept(ti)
+		suite.Require().Nil(ti.Errors(), c.expr)
+		t, err := schema.EvalTypeToGoType(stmt.(*ast.SelectStmt).Fields.Fields[0].Expr.GetType())
+		suite.Require().Nil(err, c.expr)
+		suite.Equal(c.goType, t.Type, c.expr)
+		suite.Equal(c.notNull, t.NotNull, c.expr)
+	}
+
+	for _, c := range []struct {
+		expr    string
+		errType ErrorType
+	}{
+		{"SOUNDEX(Users.Name)", ErrNotSupported},
+		{"CONCAT()", ErrInvalidExpr},
+		{"IF(Users.ID > 1, Users.Name, Users.CreatedAt)", ErrTypeCheck},
+		{"ROUND(Users.Name)", ErrTypeCheck},
+		{"COALESCE(?, ?)", ErrInvalidExpr},
+	} {
+		stmt, err := p.ParseOneStmt("SELECT " + c.expr + " AS X FROM Users;")
+		suite.Require().Nil(err, c.expr)
+		ti := NewTypeInferenceVisitor(tables)
+		stmt.Accept(ti)
+		suite.Require().Len(ti.Errors(), 1, c.expr)
+		suite.Equal(c.errType, ti.Errors()[0].(Error).Type, c.expr)
+	}
+
+	// markers of arguments that functions type.
+	for _, c := range []struct {
+		sql    string
+		params []schema.GoTypeName
+		names  []string
+	}{
+		{"SELECT ROUND(Users.Score, ?) AS X FROM Users;",
+			[]schema.GoTypeName{schema.GoTypeInt}, []string{"XRound"}},
+		{"SELECT LEFT(Users.Name, ?) AS X FROM Users;",
+			[]schema.GoTypeName{schema.GoTypeInt}, []string{"XLeft"}},
+		{"SELECT LPAD(Users.Name, ?, '0') AS X FROM Users;",
+			[]schema.GoTypeName{schema.GoTypeInt}, []string{"XLpad"}},
+		{"SELECT Users.ID AS X FROM Users WHERE Users.CreatedAt > DATE_SUB(NOW(), INTERVAL ? DAY);",
+			[]schema.GoTypeName{schema.GoTypeInt}, []string{"CreatedAtDateSub"}},
+		{"SELECT COALESCE(Users.Nick, ?) AS X FROM Users;",
+			[]schema.GoTypeName{schema.GoTypeString}, []string{"XCoalesce"}},
+		{"SELECT IFNULL(Users.Score, ?) AS X FROM Users;",
+			[]schema.GoTypeName{schema.GoTypeString}, []string{"XIfnull"}},
+		{"SELECT IF(Users.ID > ?, ?, Users.ID) AS X FROM Users;",
+			[]schema.GoTypeName{schema.GoTypeInt, schema.GoTypeInt}, []string{"ID", "XIf"}},
+		{"SELECT Users.ID AS X FROM Users WHERE Users.Name = COALESCE(?, ?);",
+			[]schema.GoTypeName{schema.GoTypeString, schema.GoTypeString}, []string{"Name", "Name"}},
+	} {
+		stmt, err := p.ParseOneStmt(c.sql)
+		suite.Require().Nil(err, c.sql)
+		ti := NewTypeInferenceVisitor(tables)
+		stmt.Accept(ti)
+		suite.Require().Nil(ti.Errors(), c.sql)
+
+		params := NewParamExtractVisitor()
+		stmt.Accept(params)
+		suite.Require().Nil(params.Errors(), c.sql)
+		suite.Require().Len(params.Params, len(c.params), c.sql)
+		for i, param := range params.Params {
+			suite.Equal(c.params[i], param.Type.Type, c.sql)
+			suite.True(param.Type.NotNull, c.sql)
+			suite.Equal(c.names[i], param.Name, c.sql)
+		}
+	}
+}
+
+func (suite *TypeInferenceTestSuite) TestCase() {
+	p := parser.NewSQLParser()
+	tableast, err := p.ParseOneStmt(`
+CREATE TABLE Users (
+  ID BIGINT NOT NULL,
+  Name VARCHAR(64) NOT NULL,
+  Nick VARCHAR(64),
+  Score DECIMAL(10, 2) NOT NULL);`)
+	suite.Require().Nil(err)
+	tables := []schema.SQLTable{schema.NewTableInfo(tableast.(*ast.CreateTableStmt), nil)}
+
+	for _, c := range []struct {
+		sql     string
+		goType  schema.GoTypeName
+		notNull bool
+		params  []schema.GoTypeName
+	}{
+		{"SELECT CASE WHEN Users.ID > 1 THEN Users.Name ELSE 'none' END AS X FROM Users;",
+			schema.GoTypeString, true, nil},
+		{"SELECT CASE WHEN Users.ID > 1 THEN Users.Name END AS X FROM Users;",
+			schema.GoTypeString, false, nil},
+		{"SELECT CASE WHEN Users.ID > 1 THEN Users.Name ELSE Users.Nick END AS X FROM Users;",
+			schema.GoTypeString, false, nil},
+		{"SELECT CASE Users.ID WHEN 1 THEN Users.Score ELSE 0 END AS X FROM Users;",
+			schema.GoTypeString, true, nil},
+		{"SELECT CASE Users.Name WHEN ? THEN ? ELSE 1.5e0 END AS X FROM Users;",
+			schema.GoTypeFloat64, true, []schema.GoTypeName{schema.GoTypeString, schema.GoTypeFloat64}},
+		{"SELECT CASE WHEN ? THEN Users.ID ELSE NULL END AS X FROM Users;",
+			schema.GoTypeInt, false, []schema.GoTypeName{schema.GoTypeBool}},
+		{"SELECT Users.ID AS X FROM Users WHERE Users.Name = CASE WHEN Users.ID > ? THEN ? ELSE ? END;",
+			schema.GoTypeInt, true, []schema.GoTypeName{schema.GoTypeInt, schema.GoTypeString, schema.GoTypeString}},
+		{"SELECT CASE ? WHEN Users.ID THEN Users.Name WHEN ? THEN 'max' ELSE 'none' END AS X FROM Users;",
+			schema.GoTypeString, true, []schema.GoTypeName{schema.GoTypeInt, schema.GoTypeInt}},
+	} {
+		stmt, err := p.ParseOneStmt(c.sql)
+		suite.Require().Nil(err, c.sql)
+		ti := NewTypeInferenceVisitor(tables)
+		stmt.Accept(ti)
+		suite.Require().Nil(ti.Errors(), c.sql)
+		t, err := schema.EvalTypeToGoType(stmt.(*ast.SelectStmt).Fields.Fields[0].Expr.GetType())
+		suite.Require().Nil(err, c.sql)
+		suite.Equal(c.goType, t.Type, c.sql)
+		suite.Equal(c.notNull, t.NotNull, c.sql)
+
+		params := NewParamExtractVisitor()
+		stmt.Accept(params)
+		suite.Require().Nil(params.Errors(), c.sql)
+		suite.Require().Len(params.Params, len(c.params), c.sql)
+		for i, param := range params.Params {
+			suite.Equal(c.params[i], param.Type.Type, c.sql)
+			suite.True(param.Type.NotNull, c.sql)
+		}
+	}
+
+	// a marker of the value is named after the alias.
+	stmt, err := p.ParseOneStmt("SELECT CASE ? WHEN 1 THEN Users.Name END AS Label FROM Users;")
+	suite.Require().Nil(err)
+	ti := NewTypeInferenceVisitor(tables)
+	stmt.Accept(ti)
+	suite.Require().Nil(ti.Errors())
+	params := NewParamExtractVisitor()
+	stmt.Accept(params)
+	suite.Require().Nil(params.Errors())
+	suite.Require().Len(params.Params, 1)
+	suite.Equal("LabelCase", params.Params[0].Name)
+	suite.Equal(schema.GoTypeInt, params.Params[0].Type.Type)
+
+	for _, sql := range []string{
+		"SELECT CASE ? WHEN ? THEN Users.Name END AS X FROM Users;",
+		"SELECT CASE WHEN Users.ID > 1 THEN Users.Name ELSE Users.ID END AS X FROM Users;",
+		"SELECT CASE WHEN Users.ID > 1 THEN ? ELSE ? END AS X FROM Users;",
+		"SELECT CASE WHEN Users.ID > 1 THEN NULL END AS X FROM Users;",
+	} {
+		stmt, err := p.ParseOneStmt(sql)
+		suite.Require().Nil(err, sql)
+		ti := NewTypeInferenceVisitor(tables)
+		stmt.Accept(ti)
+		suite.NotEmpty(ti.Errors(), sql)
+	}
+}
+
 func TestTypeInferenceTestSuite(t *testing.T) {
 	suite.Run(t, new(TypeInferenceTestSuite))
 }
@@ -0,0 +1,162 @@
+package usersrepo
+
+// Round-trips rows of the repo generated of runtimeXML in needle_test.go through a
+// fake database/sql driver, which returns strings as []byte the way MySQL drivers do.
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var columns = []string{"ID", "Name", "Visits", "Role", "Flags", "Tags"}
+
+// fakeDriver stores rows inserted by INSERT, and selects them by ID.
+type fakeDriver struct {
+	rows map[int64][]driver.Value
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{d}, nil
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string,
+	args []driver.NamedValue) (driver.Result, error) {
+	if !strings.HasPrefix(query, "INSERT") || len(args) != len(columns) {
+		return nil, errors.New("unexpected exec: " + query)
+	}
+	row := make([]driver.Value, len(args))
+	for i, arg := range args {
+		row[i] = arg.Value
+	}
+	c.d.rows[row[0].(int64)] = row
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string,
+	args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.HasPrefix(query, "SELECT") || len(args) != 1 {
+		return nil, errors.New("unexpected query: " + query)
+	}
+	rows := &fakeRows{}
+	if row, ok := c.d.rows[args[0].Value.(int64)]; ok {
+		rows.rows = append(rows.rows, row)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, v := range r.rows[0] {
+		if s, ok := v.(string); ok {
+			v = []byte(s)
+		}
+		dest[i] = v
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// executer runs statements on the database without a cache.
+type executer struct {
+	db *sql.DB
+}
+
+func (e executer) Invalidate(f InvalidateFunc) error { return f() }
+
+func (e executer) Query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return e.db.QueryContext(ctx, query, args...)
+}
+
+func (e executer) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return e.db.ExecContext(ctx, query, args...)
+}
+
+func (e executer) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	return e.db.PrepareContext(ctx, query)
+}
+
+func TestRoundTrip(t *testing.T) {
+	sql.Register("fake", &fakeDriver{rows: make(map[int64][]driver.Value)})
+	db, err := sql.Open("fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := NewUsers(nil, executer{db})
+	ctx := context.Background()
+
+	for _, user := range []User{
+		{
+			Id:     1,
+			Name:   NullOf("Ada"),
+			Visits: NullOf(uint64(42)),
+			Role:   UserRoleAdmin,
+			Flags:  NullOf(UserFlags{UserFlagsItemNew, UserFlagsItemVip}),
+			Tags:   NullOf([]string{"a", "b"}),
+		},
+		{Id: 2, Role: UserRoleMember},
+	} {
+		if _, err := repo.InsertUser(ctx, &user, nil, nil); err != nil {
+			t.Fatalf("insert %d: %s", user.Id, err)
+		}
+		got, err := repo.GetUser(ctx, &GetUserArgs{Id: user.Id})
+		if err != nil {
+			t.Fatalf("get %d: %s", user.Id, err)
+		}
+		if got == nil || !reflect.DeepEqual(*got, user) {
+			t.Errorf("get %d: got %+v, want %+v", user.Id, got, user)
+		}
+	}
+	if got, err := repo.GetUser(ctx, &GetUserArgs{Id: 3}); err != nil || got != nil {
+		t.Errorf("get 3: got %+v, %v, want nil", got, err)
+	}
+
+	// values in cache keys.
+	for _, c := range []struct {
+		v    interface{}
+		want string
+	}{
+		{NullOf("Ada"), "Ada"},
+		{Null[string]{}, "<nil>"},
+		{NullOf(uint64(42)), "42"},
+		{UserFlags{UserFlagsItemNew, UserFlagsItemVip}, "new,vip"},
+		{NullOf(UserFlags{UserFlagsItemVip}), "vip"},
+		{jsonField{NullOf([]string{"a"})}, `["a"]`},
+		{jsonField{Null[[]string]{}}, "null"},
+		{NullOf(struct{ A int }{1}), `{"A":1}`},
+	} {
+		if got := valueToString(c.v); got != c.want {
+			t.Errorf("valueToString(%#v) = %q, want %q", c.v, got, c.want)
+		}
+	}
+}